@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+func setHeaders(w http.ResponseWriter, r *http.Request, methods string) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", methods+", OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+}
+
+// requireAdmin answers the request itself unless the caller, already
+// authenticated by session.RequireAuth, is an admin. It returns their id.
+func requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, _ := session.CurrentUser(r)
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+		return "", false
+	}
+	return user.ID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// PromoteConfigured gives the admin role to the accounts listed, by username
+// or email, in the admin_users setting. It is how the first admin gets
+// created; later ones can be promoted through the API.
+func PromoteConfigured() {
+	for _, name := range config.Current.AdminUsers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		res, err := db.DB.Exec("UPDATE users SET role = ? WHERE username = ? OR email = ?", session.RoleAdmin, name, name)
+		if err != nil {
+			logger.LogError("Error promoting admin "+name, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Println("admin_users: no account matches", name)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"net/http"
+
+	"social-net/audit"
+)
+
+// AuditLog pages through every audit event, newest first. ?user_id= narrows
+// to events done by or targeting one account, ?action= to one action.
+func AuditLog(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "GET")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	f := audit.ParseFilter(r)
+	f.UserID = r.URL.Query().Get("user_id")
+	audit.WriteEvents(w, f)
+}
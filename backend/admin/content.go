@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"social-net/audit"
+	"social-net/comments"
+	"social-net/events"
+	"social-net/groups"
+	logger "social-net/log"
+	"social-net/posts"
+)
+
+var removers = map[string]func(id string) error{
+	"post":          posts.RemovePost,
+	"comment":       comments.RemoveComment,
+	"group":         groups.RemoveGroup,
+	"group_post":    groups.RemoveGroupPost,
+	"group_comment": groups.RemoveGroupComment,
+	"event":         events.RemoveEvent,
+}
+
+// DeleteContent removes any {type, id}: a post, comment, group, group_post,
+// group_comment or event, with whatever depends on it.
+func DeleteContent(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ID == "" {
+		http.Error(w, "type and id are required", http.StatusBadRequest)
+		return
+	}
+	remove, ok := removers[request.Type]
+	if !ok {
+		http.Error(w, "Unknown content type", http.StatusBadRequest)
+		return
+	}
+
+	if err := remove(request.ID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		logger.LogError("Error deleting "+request.Type, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	audit.Log(r, adminID, "content_deleted", request.Type, request.ID, nil)
+	log.Println("[Admin] Deleted", request.Type, request.ID, "by", adminID)
+	writeJSON(w, http.StatusOK, map[string]string{"type": request.Type, "id": request.ID, "message": "Deleted"})
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"social-net/db"
+	logger "social-net/log"
+)
+
+var statQueries = []struct {
+	name  string
+	query string
+	now   bool
+}{
+	{"users", "SELECT COUNT(*) FROM users", false},
+	{"admins", "SELECT COUNT(*) FROM users WHERE role = 'admin'", false},
+	{"suspended_users", "SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > ?)", true},
+	{"unverified_users", "SELECT COUNT(*) FROM users WHERE verified_at IS NULL", false},
+	{"pending_deletions", "SELECT COUNT(*) FROM users WHERE delete_after IS NOT NULL", false},
+	{"active_sessions", "SELECT COUNT(*) FROM sessions WHERE expires_at > ?", true},
+	{"signed_in_users", "SELECT COUNT(DISTINCT user_id) FROM sessions WHERE expires_at > ?", true},
+	{"posts", "SELECT COUNT(*) FROM posts", false},
+	{"comments", "SELECT COUNT(*) FROM comments", false},
+	{"groups", "SELECT COUNT(*) FROM groups", false},
+	{"group_posts", "SELECT COUNT(*) FROM group_posts", false},
+	{"group_comments", "SELECT COUNT(*) FROM group_comments", false},
+	{"events", "SELECT COUNT(*) FROM events", false},
+	{"messages", "SELECT COUNT(*) FROM messages", false},
+	{"group_messages", "SELECT COUNT(*) FROM group_messages", false},
+	{"follows", "SELECT COUNT(*) FROM Followers", false},
+}
+
+// Stats returns platform wide counters.
+func Stats(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "GET")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	now := time.Now()
+	stats := map[string]int{}
+	for _, s := range statQueries {
+		var args []interface{}
+		if s.now {
+			args = append(args, now)
+		}
+		var n int
+		if err := db.DB.QueryRow(s.query, args...).Scan(&n); err != nil {
+			logger.LogError("Error computing stat "+s.name, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		stats[s.name] = n
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
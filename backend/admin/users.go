@@ -0,0 +1,294 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-net/audit"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+type User struct {
+	ID         string              `json:"id"`
+	Username   string              `json:"username"`
+	Email      string              `json:"email"`
+	FirstName  string              `json:"firstname"`
+	LastName   string              `json:"lastname"`
+	Avatar     string              `json:"avatar"`
+	Role       string              `json:"role"`
+	Verified   bool                `json:"verified"`
+	Suspension *session.Suspension `json:"suspension,omitempty"`
+}
+
+// ListUsers pages through accounts. ?q= searches usernames, emails and
+// names; ?status= narrows to "active", "suspended" or "admin".
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "GET")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	now := time.Now()
+	where := " WHERE 1=1"
+	args := []interface{}{}
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		where += " AND (username LIKE ? OR email LIKE ? OR first_name LIKE ? OR last_name LIKE ?)"
+		pattern := "%" + search + "%"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	switch q.Get("status") {
+	case "":
+	case "active":
+		where += " AND (suspended_at IS NULL OR (suspended_until IS NOT NULL AND suspended_until <= ?))"
+		args = append(args, now)
+	case "suspended":
+		where += " AND suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > ?)"
+		args = append(args, now)
+	case "admin":
+		where += " AND role = ?"
+		args = append(args, session.RoleAdmin)
+	default:
+		http.Error(w, "Invalid status filter", http.StatusBadRequest)
+		return
+	}
+
+	var total int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		logger.LogError("Error counting users", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT id, username, email, first_name, last_name, COALESCE(avatar, ''), role, verified_at IS NOT NULL,
+		suspended_at, suspended_until, suspension_reason FROM users`+where+" ORDER BY username LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		logger.LogError("Error listing users", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		var since, until sql.NullTime
+		var reason string
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.FirstName, &u.LastName, &u.Avatar, &u.Role, &u.Verified, &since, &until, &reason); err != nil {
+			logger.LogError("Error scanning user", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if since.Valid && (!until.Valid || until.Time.After(now)) {
+			u.Suspension = &session.Suspension{Since: since.Time, Reason: reason}
+			if until.Valid {
+				u.Suspension.Until = &until.Time
+			}
+		}
+		users = append(users, u)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+type moderationRequest struct {
+	UserID string  `json:"user_id"`
+	Reason string  `json:"reason"`
+	Hours  float64 `json:"hours"`
+	Role   string  `json:"role"`
+}
+
+// targetUser decodes the request and loads the username of its target.
+// Admins cannot act on their own account.
+func targetUser(w http.ResponseWriter, r *http.Request, adminID string) (moderationRequest, string, bool) {
+	var request moderationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return request, "", false
+	}
+	if request.UserID == adminID {
+		http.Error(w, "You cannot change your own account", http.StatusBadRequest)
+		return request, "", false
+	}
+	username, ok := session.GetUsernameFromUserID(request.UserID)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return request, "", false
+	}
+	return request, username, true
+}
+
+// suspend blocks the account until the given time, or for good when until is
+// nil, then signs it out everywhere, revokes its access tokens and closes
+// its live connections.
+func suspend(userID string, username string, until *time.Time, reason string) error {
+	var end interface{}
+	if until != nil {
+		end = *until
+	}
+	_, err := db.DB.Exec("UPDATE users SET suspended_at = ?, suspended_until = ?, suspension_reason = ? WHERE id = ?",
+		time.Now(), end, reason, userID)
+	if err != nil {
+		return err
+	}
+	session.Deletesession(userID)
+	session.RevokeAccessTokens(userID)
+	session.UserSuspended(userID, username)
+	return nil
+}
+
+func moderate(w http.ResponseWriter, r *http.Request, ban bool) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	request, username, ok := targetUser(w, r, adminID)
+	if !ok {
+		return
+	}
+	if session.IsAdmin(request.UserID) {
+		http.Error(w, "Admins must be demoted before they can be suspended", http.StatusBadRequest)
+		return
+	}
+
+	var until *time.Time
+	event := "account_banned"
+	if !ban {
+		if request.Hours <= 0 {
+			http.Error(w, "hours must be positive", http.StatusBadRequest)
+			return
+		}
+		end := time.Now().Add(time.Duration(request.Hours * float64(time.Hour)))
+		until = &end
+		event = "account_suspended"
+	}
+
+	if err := suspend(request.UserID, username, until, strings.TrimSpace(request.Reason)); err != nil {
+		logger.LogError("Error suspending user", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	audit.Log(r, adminID, event, "user", request.UserID, audit.Meta{"reason": request.Reason, "until": until})
+	log.Println("[Admin]", event, username, "by", adminID)
+
+	s, _ := session.UserSuspension(request.UserID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": request.UserID, "suspension": s})
+}
+
+// SuspendUser blocks an account for {hours}.
+func SuspendUser(w http.ResponseWriter, r *http.Request) {
+	moderate(w, r, false)
+}
+
+// BanUser blocks an account until it is unbanned.
+func BanUser(w http.ResponseWriter, r *http.Request) {
+	moderate(w, r, true)
+}
+
+// UnbanUser lifts a suspension or ban.
+func UnbanUser(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	request, username, ok := targetUser(w, r, adminID)
+	if !ok {
+		return
+	}
+
+	res, err := db.DB.Exec("UPDATE users SET suspended_at = NULL, suspended_until = NULL, suspension_reason = '' WHERE id = ? AND suspended_at IS NOT NULL", request.UserID)
+	if err != nil {
+		logger.LogError("Error unbanning user", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "User is not suspended", http.StatusConflict)
+		return
+	}
+	audit.Log(r, adminID, "account_unbanned", "user", request.UserID, nil)
+	log.Println("[Admin] account_unbanned", username, "by", adminID)
+	writeJSON(w, http.StatusOK, map[string]string{"user_id": request.UserID, "message": "User unbanned"})
+}
+
+// SetRole promotes a user to admin or demotes them back.
+func SetRole(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	request, username, ok := targetUser(w, r, adminID)
+	if !ok {
+		return
+	}
+	if request.Role != session.RoleUser && request.Role != session.RoleAdmin {
+		http.Error(w, "role must be \"user\" or \"admin\"", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.DB.Exec("UPDATE users SET role = ? WHERE id = ?", request.Role, request.UserID); err != nil {
+		logger.LogError("Error updating role", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	audit.Log(r, adminID, "role_changed", "user", request.UserID, audit.Meta{"role": request.Role})
+	log.Println("[Admin] role of", username, "set to", request.Role, "by", adminID)
+	writeJSON(w, http.StatusOK, map[string]string{"user_id": request.UserID, "role": request.Role})
+}
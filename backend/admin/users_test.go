@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestAdminEndpointsRequireAdmin(t *testing.T) {
+	dbtest.Open(t)
+	admin := dbtest.User(t, "u-admin", "admin", "admin@test.local", true)
+	member := dbtest.User(t, "u-member", "member", "member@test.local", true)
+	dbtest.Exec(t, "UPDATE users SET role = 'admin' WHERE id = 'u-admin'")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+	}{
+		{"list users", ListUsers, http.MethodGet, ""},
+		{"suspend", SuspendUser, http.MethodPost, `{"user_id": "u-admin", "hours": 1}`},
+		{"ban", BanUser, http.MethodPost, `{"user_id": "u-admin"}`},
+		{"unban", UnbanUser, http.MethodPost, `{"user_id": "u-admin"}`},
+		{"set role", SetRole, http.MethodPost, `{"user_id": "u-member", "role": "admin"}`},
+		{"delete content", DeleteContent, http.MethodPost, `{"type": "post", "id": "p-missing"}`},
+		{"stats", Stats, http.MethodGet, ""},
+		{"audit log", AuditLog, http.MethodGet, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			session.RequireAuth(tt.handler)(w, dbtest.SignedIn(t, tt.method, "/", strings.NewReader(tt.body), member))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("member: status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+			if !dbtest.Exists(t, "SELECT 1 FROM users WHERE id = 'u-member' AND role != 'admin'") {
+				t.Fatal("member promoted themselves")
+			}
+
+			if tt.method != http.MethodGet {
+				return
+			}
+			w = httptest.NewRecorder()
+			session.RequireAuth(tt.handler)(w, dbtest.SignedIn(t, tt.method, "/", nil, admin))
+			if w.Code != http.StatusOK {
+				t.Errorf("admin: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+		})
+	}
+}
+
+func TestSuspendSignsOutEverywhere(t *testing.T) {
+	dbtest.Open(t)
+	admin := dbtest.User(t, "u-admin", "admin", "admin@test.local", true)
+	target := dbtest.User(t, "u-target", "target", "target@test.local", true)
+	dbtest.User(t, "u-other-admin", "otheradmin", "otheradmin@test.local", true)
+	dbtest.Exec(t, "UPDATE users SET role = 'admin' WHERE id IN ('u-admin', 'u-other-admin')")
+
+	withCookie := dbtest.SignedIn(t, http.MethodGet, "/", nil, target)
+	pat, _, err := session.CreateAccessToken(target, "cli", []string{session.ScopeRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withToken := httptest.NewRequest(http.MethodGet, "/", nil)
+	withToken.Header.Set("Authorization", "Bearer "+pat)
+	for _, r := range []*http.Request{withCookie, withToken} {
+		if _, err := session.Authenticate(r); err != nil {
+			t.Fatalf("before the suspension: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"another admin", `{"user_id": "u-other-admin", "hours": 1}`, http.StatusBadRequest},
+		{"no duration", `{"user_id": "u-target"}`, http.StatusBadRequest},
+		{"member", `{"user_id": "u-target", "hours": 1, "reason": "spam"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		session.RequireAuth(SuspendUser)(w, dbtest.SignedIn(t, http.MethodPost, "/", strings.NewReader(tt.body), admin))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	rows := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"suspension", "SELECT 1 FROM users WHERE id = 'u-target' AND suspended_at IS NOT NULL AND suspended_until IS NOT NULL AND suspension_reason = 'spam'", true},
+		{"sessions of the target", "SELECT 1 FROM sessions WHERE user_id = 'u-target'", false},
+		{"live access tokens of the target", "SELECT 1 FROM personal_access_tokens WHERE user_id = 'u-target' AND revoked_at IS NULL", false},
+		{"other admin", "SELECT 1 FROM users WHERE id = 'u-other-admin' AND suspended_at IS NULL", true},
+		{"audit entry", "SELECT 1 FROM audit_log WHERE action = 'account_suspended' AND actor_id = 'u-admin' AND target_id = 'u-target'", true},
+	}
+	for _, tt := range rows {
+		if got := dbtest.Exists(t, tt.query); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	for name, r := range map[string]*http.Request{"session cookie": withCookie, "access token": withToken} {
+		if _, err := session.Authenticate(r); err == nil {
+			t.Errorf("%s still works after the suspension", name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+// Event is one row of the audit log. The table is append-only: triggers
+// reject updates and deletes, so events outlive the accounts they mention.
+type Event struct {
+	ID         string          `json:"id"`
+	ActorID    string          `json:"actor_id,omitempty"`
+	Actor      string          `json:"actor,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	Metadata   json.RawMessage `json:"metadata"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Meta holds the free-form details of an event.
+type Meta map[string]interface{}
+
+func init() {
+	session.OnSecurityEvent(func(r *http.Request, action string, targetType string, targetID string) {
+		Log(r, session.CurrentUserID(r), action, targetType, targetID, nil)
+	})
+}
+
+// Log records that actorID (empty when unknown, e.g. a failed login) did
+// action on the target. Failures are logged but never block the request.
+func Log(r *http.Request, actorID string, action string, targetType string, targetID string, meta Meta) {
+	if meta == nil {
+		meta = Meta{}
+	}
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		logger.LogError("Error encoding audit metadata", err)
+		metadata = []byte("{}")
+	}
+	var actor interface{}
+	if actorID != "" {
+		actor = actorID
+	}
+	var ip, userAgent string
+	if r != nil {
+		ip, userAgent = session.ClientIP(r), r.UserAgent()
+	}
+
+	id, _ := uuid.NewV7()
+	_, err = db.DB.Exec(`INSERT INTO audit_log (id, actor_id, action, target_type, target_id, ip, user_agent, metadata, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), actor, action, targetType, targetID, ip, userAgent, string(metadata), time.Now())
+	if err != nil {
+		logger.LogError("Error recording audit event", err)
+	}
+}
+
+// Filter selects events for Query. UserID matches events the user did or
+// that targeted their account.
+type Filter struct {
+	UserID string
+	Action string
+	Limit  int
+	Offset int
+}
+
+func Query(f Filter) ([]Event, int, error) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+	if f.UserID != "" {
+		where += " AND (a.actor_id = ? OR (a.target_type = 'user' AND a.target_id = ?))"
+		args = append(args, f.UserID, f.UserID)
+	}
+	if f.Action != "" {
+		where += " AND a.action = ?"
+		args = append(args, f.Action)
+	}
+
+	var total int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM audit_log a"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.DB.Query(`SELECT a.id, COALESCE(a.actor_id, ''), COALESCE(u.username, ''), a.action, a.target_type, a.target_id,
+		a.ip, a.user_agent, a.metadata, a.created_at
+		FROM audit_log a LEFT JOIN users u ON u.id = a.actor_id`+where+" ORDER BY a.created_at DESC, a.id DESC LIMIT ? OFFSET ?",
+		append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var metadata string
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID,
+			&e.IP, &e.UserAgent, &metadata, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		e.Metadata = json.RawMessage(metadata)
+		events = append(events, e)
+	}
+	return events, total, rows.Err()
+}
+
+// ParseFilter reads ?action=, ?limit= and ?offset= from the request.
+func ParseFilter(r *http.Request) Filter {
+	q := r.URL.Query()
+	f := Filter{Action: q.Get("action")}
+	f.Limit, _ = strconv.Atoi(q.Get("limit"))
+	if f.Limit <= 0 || f.Limit > 100 {
+		f.Limit = 50
+	}
+	f.Offset, _ = strconv.Atoi(q.Get("offset"))
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return f
+}
+
+// MyEvents pages through the caller's own events.
+func MyEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f := ParseFilter(r)
+	f.UserID = session.CurrentUserID(r)
+	WriteEvents(w, f)
+}
+
+// WriteEvents answers with the page of events selected by f.
+func WriteEvents(w http.ResponseWriter, f Filter) {
+	events, total, err := Query(f)
+	if err != nil {
+		logger.LogError("Error listing audit events", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"total":  total,
+		"limit":  f.Limit,
+		"offset": f.Offset,
+	})
+}
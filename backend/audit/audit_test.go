@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+	"social-net/session"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	dbtest.Open(t)
+	Log(nil, "", "login_failed", "user", "u-someone", Meta{"reason": "password"})
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"update", "UPDATE audit_log SET action = 'login'"},
+		{"delete", "DELETE FROM audit_log"},
+		{"delete of a user's events", "DELETE FROM audit_log WHERE target_id = 'u-someone'"},
+	}
+	for _, tt := range tests {
+		if _, err := db.DB.Exec(tt.query); err == nil {
+			t.Errorf("%s was allowed", tt.name)
+		}
+	}
+	if !dbtest.Exists(t, "SELECT 1 FROM audit_log WHERE action = 'login_failed' AND target_id = 'u-someone' AND json_extract(metadata, '$.reason') = 'password'") {
+		t.Error("the event changed")
+	}
+}
+
+func TestAuditLogKeepsSecurityEvents(t *testing.T) {
+	dbtest.Open(t)
+	migrations := &migrate.FileMigrationSource{Dir: config.Current.MigrationsDir}
+	files, _ := filepath.Glob(filepath.Join(config.Current.MigrationsDir, "*.sql"))
+	// Go back to just before the audit log replaced security_events.
+	if _, err := migrate.ExecMax(db.DB, "sqlite3", migrations, migrate.Down, len(files)-28); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.Exec(t, `INSERT INTO security_events (id, user_id, event, ip, user_agent, details, created_at) VALUES
+		('se-user', 'u-old', 'password_changed', '203.0.113.7', 'curl', 'from settings', '2024-01-01 10:00:00'),
+		('se-anonymous', NULL, 'login_failed', '203.0.113.8', 'curl', 'unknown email', '2024-01-01 11:00:00')`)
+	if _, err := migrate.Exec(db.DB, "sqlite3", migrations, migrate.Up); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"event of a user", `SELECT 1 FROM audit_log WHERE id = 'se-user' AND actor_id = 'u-old' AND action = 'password_changed'
+			AND target_type = 'user' AND target_id = 'u-old' AND ip = '203.0.113.7' AND user_agent = 'curl'
+			AND json_extract(metadata, '$.details') = 'from settings'`},
+		{"anonymous event", `SELECT 1 FROM audit_log WHERE id = 'se-anonymous' AND actor_id IS NULL AND action = 'login_failed'
+			AND target_type = '' AND target_id = '' AND json_extract(metadata, '$.details') = 'unknown email'`},
+	}
+	for _, tt := range tests {
+		if !dbtest.Exists(t, tt.query) {
+			t.Errorf("%s was not kept", tt.name)
+		}
+	}
+}
+
+func TestMyEvents(t *testing.T) {
+	dbtest.Open(t)
+	me := dbtest.User(t, "u-me", "me", "me@test.local", true)
+	dbtest.User(t, "u-other", "other", "other@test.local", true)
+	dbtest.Exec(t, `INSERT INTO audit_log (id, actor_id, action, target_type, target_id, created_at) VALUES
+		('a-mine', 'u-me', 'password_changed', 'user', 'u-me', '2024-01-01 10:00:00'),
+		('a-about-me', 'u-admin', 'account_suspended', 'user', 'u-me', '2024-01-01 11:00:00'),
+		('a-other', 'u-other', 'password_changed', 'user', 'u-other', '2024-01-01 12:00:00'),
+		('a-my-post', 'u-other', 'post_deleted', 'post', 'u-me', '2024-01-01 13:00:00'),
+		('a-anonymous', NULL, 'login_failed', 'user', 'u-other', '2024-01-01 14:00:00')`)
+
+	tests := []struct {
+		name      string
+		target    string
+		want      []string
+		wantTotal int
+	}{
+		{"all", "/", []string{"a-about-me", "a-mine"}, 2},
+		{"one action", "/?action=password_changed", []string{"a-mine"}, 1},
+		{"page", "/?limit=1&offset=1", []string{"a-mine"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			session.RequireAuth(MyEvents)(w, dbtest.SignedIn(t, http.MethodGet, tt.target, nil, me))
+			var page struct {
+				Events []Event `json:"events"`
+				Total  int     `json:"total"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+				t.Fatalf("status %d: %v", w.Code, err)
+			}
+			var got []string
+			for _, e := range page.Events {
+				got = append(got, e.ID)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", page.Total, tt.wantTotal)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("events = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("events = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
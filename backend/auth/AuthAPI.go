@@ -2,13 +2,16 @@ package auth
 
 import (
 	"net/http"
+
+	"social-net/config"
+	"social-net/session"
 )
 
 func Auth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -19,6 +22,30 @@ func Auth(w http.ResponseWriter, r *http.Request) {
 		Register(w, r)
 	} else if r.URL.Path == "/api/auth/logout" {
 		Logout(w, r)
+	} else if r.URL.Path == "/api/auth/forgot" {
+		ForgotPassword(w, r)
+	} else if r.URL.Path == "/api/auth/reset" {
+		ResetPassword(w, r)
+	} else if r.URL.Path == "/api/auth/verify" {
+		VerifyEmail(w, r)
+	} else if r.URL.Path == "/api/auth/resend" {
+		session.RequireAuth(ResendVerification)(w, r)
+	} else if r.URL.Path == "/api/auth/2fa/setup" {
+		session.RequireAuth(SetupTwoFactor)(w, r)
+	} else if r.URL.Path == "/api/auth/2fa/enable" {
+		session.RequireAuth(EnableTwoFactor)(w, r)
+	} else if r.URL.Path == "/api/auth/2fa/disable" {
+		session.RequireAuth(DisableTwoFactor)(w, r)
+	} else if r.URL.Path == "/api/auth/2fa/login" {
+		TwoFactorLogin(w, r)
+	} else if r.URL.Path == "/api/auth/username" {
+		CheckUsername(w, r)
+	} else if r.URL.Path == "/api/auth/oidc/providers" {
+		OIDCProvidersList(w, r)
+	} else if r.URL.Path == "/api/auth/oidc/login" {
+		OIDCLogin(w, r)
+	} else if r.URL.Path == "/api/auth/oidc/callback" {
+		OIDCCallback(w, r)
 	} else {
 		http.Error(w, "Invalid endpoint", http.StatusNotFound)
 	}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+// UpdateProfile edits the caller's profile. It takes the same multipart shape
+// as Register: a "user" JSON field plus an optional "avatar" file. Fields
+// left out of the JSON keep their current value.
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	if err := r.ParseMultipartForm(config.Current.MaxRequestSize); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var current User
+	var avatar string
+	err := db.DB.QueryRow("SELECT username, first_name, last_name, date_of_birth, bio, nickname, avatar FROM users WHERE id = ?", userID).Scan(
+		&current.Username, &current.FirstName, &current.LastName, &current.Birthday, &current.Bio, &current.Nickname, &avatar)
+	if err != nil {
+		logger.LogError("Error loading profile", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var changes struct {
+		FirstName *string `json:"firstname"`
+		LastName  *string `json:"lastname"`
+		Birthday  *string `json:"birthday"`
+		Bio       *string `json:"bio"`
+		Nickname  *string `json:"nickname"`
+	}
+	if userJson := r.FormValue("user"); userJson != "" {
+		if err := json.Unmarshal([]byte(userJson), &changes); err != nil {
+			http.Error(w, "Invalid user JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	updated := current
+	if changes.FirstName != nil {
+		updated.FirstName = strings.TrimSpace(*changes.FirstName)
+	}
+	if changes.LastName != nil {
+		updated.LastName = strings.TrimSpace(*changes.LastName)
+	}
+	if changes.Birthday != nil {
+		updated.Birthday = strings.TrimSpace(*changes.Birthday)
+	}
+	if changes.Bio != nil {
+		updated.Bio = *changes.Bio
+	}
+	if changes.Nickname != nil {
+		updated.Nickname = strings.TrimSpace(*changes.Nickname)
+	}
+
+	if err := validateProfile(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newAvatar := avatar
+	file, handler, err := r.FormFile("avatar")
+	if err == nil && file != nil {
+		defer file.Close()
+
+		newAvatar, err = saveAvatar(file, handler, current.Username)
+		if err != nil {
+			http.Error(w, err.Error(), avatarErrorStatus(err))
+			return
+		}
+	}
+
+	_, err = db.DB.Exec("UPDATE users SET first_name = ?, last_name = ?, date_of_birth = ?, bio = ?, nickname = ?, avatar = ? WHERE id = ?",
+		updated.FirstName, updated.LastName, updated.Birthday, updated.Bio, updated.Nickname, newAvatar, userID)
+	if err != nil {
+		logger.LogError("Error updating profile", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if newAvatar != avatar && avatar != "" {
+		if err := os.Remove(filepath.Join(config.Current.UploadsDir, filepath.Base(avatar))); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to remove old avatar:", err)
+		}
+	}
+
+	Senddata(w, 0, "Profile updated", map[string]string{
+		"firstname": updated.FirstName,
+		"lastname":  updated.LastName,
+		"birthday":  updated.Birthday,
+		"bio":       updated.Bio,
+		"nickname":  updated.Nickname,
+		"avatar":    newAvatar,
+	})
+}
+
+// ChangePassword needs the current password and signs out every other
+// session of the account.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := session.CurrentUser(r)
+	userID := user.ID
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CurrentPassword == "" {
+		Senddata(w, 1, "Current and new password are required", nil)
+		return
+	}
+	if err := ValidatePassword(request.NewPassword); err != nil {
+		Senddata(w, 1, err.Error(), nil)
+		return
+	}
+
+	var pass string
+	if err := db.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&pass); err != nil {
+		logger.LogError("Error fetching password", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if !Validate(pass, request.CurrentPassword) {
+		Senddata(w, 2, "Invalid password", "Error Password")
+		return
+	}
+
+	if _, err := db.DB.Exec("UPDATE users SET password = ? WHERE id = ?", Hashpwd(request.NewPassword), userID); err != nil {
+		logger.LogError("Error updating password", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	session.DeleteOtherSessions(userID, user.SessionID)
+	session.RevokeAccessTokens(userID)
+
+	log.Println("[ChangePassword] Password changed for user:", userID)
+	audit.Log(r, userID, "password_changed", "user", userID, nil)
+	Senddata(w, 0, "Password changed", nil)
+}
+
+// ChangeEmail switches the account to a new address, which has to be
+// verified again before the account is fully usable.
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	var request struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Password == "" {
+		Senddata(w, 1, "Password and email are required", nil)
+		return
+	}
+	request.Email = strings.TrimSpace(request.Email)
+	if err := ValidateEmail(request.Email); err != nil {
+		Senddata(w, 1, err.Error(), nil)
+		return
+	}
+
+	var pass, email string
+	if err := db.DB.QueryRow("SELECT password, email FROM users WHERE id = ?", userID).Scan(&pass, &email); err != nil {
+		logger.LogError("Error fetching user", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if !Validate(pass, request.Password) {
+		Senddata(w, 2, "Invalid password", "Error Password")
+		return
+	}
+	if strings.EqualFold(email, request.Email) {
+		Senddata(w, 1, "That is already your email", nil)
+		return
+	}
+
+	var taken bool
+	db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND id != ?)", request.Email, userID).Scan(&taken)
+	if taken {
+		Senddata(w, 1, "Email is already in use", nil)
+		return
+	}
+
+	if _, err := db.DB.Exec("UPDATE users SET email = ?, verified_at = NULL WHERE id = ?", request.Email, userID); err != nil {
+		logger.LogError("Error updating email", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if err := SendVerificationEmail(userID, request.Email); err != nil {
+		logger.LogError("Error sending verification email", err)
+	}
+
+	log.Println("[ChangeEmail] Email changed for user:", userID)
+	audit.Log(r, userID, "email_changed", "user", userID, audit.Meta{"email": request.Email})
+	Senddata(w, 0, "Email changed, check your inbox to verify the new address", nil)
+}
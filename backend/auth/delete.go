@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	"social-net/export"
+	logger "social-net/log"
+	"social-net/session"
+	"social-net/utils"
+)
+
+// DeletionScheduled returns when the account will be removed, if a deletion
+// is pending.
+func DeletionScheduled(userID string) (time.Time, bool) {
+	var deleteAfter sql.NullTime
+	err := db.DB.QueryRow("SELECT delete_after FROM users WHERE id = ?", userID).Scan(&deleteAfter)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogError("Error checking account deletion", err)
+	}
+	return deleteAfter.Time, deleteAfter.Valid
+}
+
+// DeleteAccount schedules the caller's account for deletion once the
+// configured grace period has passed, so the user can change their mind.
+// Every other session is signed out; the current one stays so the request
+// can be undone.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := session.CurrentUser(r)
+	userID := user.ID
+
+	var request struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Password == "" {
+		Senddata(w, 1, "Password is required", nil)
+		return
+	}
+
+	var pass string
+	if err := db.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&pass); err != nil {
+		logger.LogError("Error fetching password", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if !Validate(pass, request.Password) {
+		Senddata(w, 2, "Invalid password", "Error Password")
+		return
+	}
+
+	if when, pending := DeletionScheduled(userID); pending {
+		Senddata(w, 1, "Account deletion is already scheduled", map[string]time.Time{"delete_after": when})
+		return
+	}
+
+	deleteAfter := time.Now().Add(config.Current.AccountDeletionGrace)
+	if _, err := db.DB.Exec("UPDATE users SET delete_after = ? WHERE id = ?", deleteAfter, userID); err != nil {
+		logger.LogError("Error scheduling account deletion", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	session.DeleteOtherSessions(userID, user.SessionID)
+
+	log.Println("[DeleteAccount] Deletion scheduled for user:", userID)
+	audit.Log(r, userID, "account_deletion_scheduled", "user", userID, audit.Meta{"delete_after": deleteAfter})
+	Senddata(w, 0, "Account scheduled for deletion", map[string]time.Time{"delete_after": deleteAfter})
+}
+
+// CancelAccountDeletion undoes a pending deletion during the grace period.
+func CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	res, err := db.DB.Exec("UPDATE users SET delete_after = NULL WHERE id = ? AND delete_after IS NOT NULL", userID)
+	if err != nil {
+		logger.LogError("Error cancelling account deletion", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		Senddata(w, 1, "No account deletion is pending", nil)
+		return
+	}
+
+	log.Println("[CancelAccountDeletion] Deletion cancelled for user:", userID)
+	audit.Log(r, userID, "account_deletion_cancelled", "user", userID, nil)
+	Senddata(w, 0, "Account deletion cancelled", nil)
+}
+
+// PurgeAccount removes the user and everything they created. Groups they own
+// go to another accepted member, preferring admins, or are deleted when no
+// one else is left. Uploaded files are removed once the rows are gone.
+func PurgeAccount(userID string) error {
+	var username string
+	if err := db.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		return err
+	}
+
+	// Files of groups that are handed over below are still in use, so
+	// RemoveUploads keeps them.
+	files, err := utils.UploadNames(`SELECT avatar FROM users WHERE id = ?1
+		UNION ALL SELECT image FROM posts WHERE user_id = ?1
+		UNION ALL SELECT image FROM post_revisions WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?1)
+		UNION ALL SELECT image FROM comments WHERE author = ?2 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)
+			OR post_id IN (SELECT id FROM posts WHERE content = '' AND repost_of IN (SELECT id FROM posts WHERE user_id = ?1))
+		UNION ALL SELECT image FROM group_posts WHERE user_id = ?1 OR group_id IN (SELECT id FROM groups WHERE creator_id = ?1)
+		UNION ALL SELECT image FROM group_comments WHERE author = ?2 OR group_post_id IN
+			(SELECT id FROM group_posts WHERE user_id = ?1 OR group_id IN (SELECT id FROM groups WHERE creator_id = ?1))`, userID, username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupIDs []string
+	rows, err := tx.Query("SELECT id FROM groups WHERE creator_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var groupID string
+		if err := rows.Scan(&groupID); err != nil {
+			rows.Close()
+			return err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	rows.Close()
+
+	for _, groupID := range groupIDs {
+		var heir string
+		err := tx.QueryRow(`SELECT user_id FROM group_members WHERE group_id = ? AND user_id != ? AND status = 'accepted'
+			ORDER BY is_admin DESC LIMIT 1`, groupID, userID).Scan(&heir)
+		if err == nil {
+			if _, err := tx.Exec("UPDATE groups SET creator_id = ? WHERE id = ?", heir, groupID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE group_members SET is_admin = '1' WHERE group_id = ? AND user_id = ?", groupID, heir); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		queries := append(utils.TargetCleanup("group_comment", "SELECT c.id FROM group_comments c JOIN group_posts p ON p.id = c.group_post_id WHERE p.group_id = ?"),
+			utils.TargetCleanup("group_post", "SELECT id FROM group_posts WHERE group_id = ?")...)
+		for _, query := range append(queries,
+			"DELETE FROM group_comments WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?)",
+			"DELETE FROM group_posts WHERE group_id = ?",
+			"DELETE FROM event_responses WHERE event_id IN (SELECT id FROM events WHERE group_id = ?)",
+			"DELETE FROM events WHERE group_id = ?",
+			"DELETE FROM group_messages WHERE group_id = ?",
+			"DELETE FROM group_members WHERE group_id = ?",
+			"DELETE FROM notifications WHERE related_entity_id = ?",
+			"DELETE FROM groups WHERE id = ?",
+		) {
+			if _, err := tx.Exec(query, groupID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Plain reposts of the user's posts go with them, including by other
+	// users; quotes stay and only lose the link to the post they quoted.
+	reposts := "SELECT id FROM posts WHERE content = '' AND repost_of IN (SELECT id FROM posts WHERE user_id = ?)"
+	queries := append(utils.TargetCleanup("comment", "SELECT id FROM comments WHERE post_id IN ("+reposts+")"), utils.TargetCleanup("post", reposts)...)
+	for _, query := range append(queries,
+		"DELETE FROM comments WHERE post_id IN ("+reposts+")",
+		"DELETE FROM notifications WHERE related_entity_id IN ("+reposts+")",
+		"DELETE FROM posts WHERE id IN ("+reposts+")",
+		"UPDATE posts SET repost_of = NULL WHERE repost_of IN (SELECT id FROM posts WHERE user_id = ?)",
+	) {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+
+	// Reactions, hashtags, mentions and bookmarks of the content deleted below.
+	ownContent := `((target_type = 'post' AND target_id IN (SELECT id FROM posts WHERE user_id = ?))
+			OR (target_type = 'comment' AND target_id IN (SELECT id FROM comments WHERE author = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)))
+			OR (target_type = 'group_post' AND target_id IN (SELECT id FROM group_posts WHERE user_id = ?))
+			OR (target_type = 'group_comment' AND target_id IN (SELECT id FROM group_comments WHERE author = ? OR group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?))))`
+	ownContentArgs := []interface{}{userID, username, userID, userID, username, userID}
+
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM reactions WHERE user_id = ? OR " + ownContent, append([]interface{}{userID}, ownContentArgs...)},
+		{"DELETE FROM hashtags WHERE " + ownContent, ownContentArgs},
+		{"DELETE FROM mentions WHERE user_id = ? OR author_id = ? OR " + ownContent, append([]interface{}{userID, userID}, ownContentArgs...)},
+		{"DELETE FROM bookmarks WHERE user_id = ? OR " + ownContent, append([]interface{}{userID}, ownContentArgs...)},
+		{"DELETE FROM bookmark_collections WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM comments WHERE author = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)", []interface{}{username, userID}},
+		{"DELETE FROM postsPrivacy WHERE user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)", []interface{}{userID, userID}},
+		{"DELETE FROM post_revisions WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)", []interface{}{userID}},
+		{"DELETE FROM posts WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM group_comments WHERE author = ? OR group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?)", []interface{}{username, userID}},
+		{"DELETE FROM group_posts WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM group_messages WHERE sender_id = ?", []interface{}{userID}},
+		{"DELETE FROM group_members WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM event_responses WHERE user_id = ? OR event_id IN (SELECT id FROM events WHERE creator_id = ?)", []interface{}{userID, userID}},
+		{"DELETE FROM events WHERE creator_id = ?", []interface{}{userID}},
+		{"DELETE FROM messages WHERE sender_id = ? OR receiver_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM Followers WHERE follower_id = ? OR followed_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM notifications WHERE user_id = ? OR sender_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM sessions WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM personal_access_tokens WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_identities WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM username_history WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM password_resets WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM email_verifications WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM recovery_codes WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM login_challenges WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM two_factor WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM login_throttle WHERE throttle_key = ?", []interface{}{"account:" + userID}},
+		{"DELETE FROM users WHERE id = ?", []interface{}{userID}},
+	} {
+		if _, err := tx.Exec(c.query, c.args...); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := export.RemoveUserExports(userID); err != nil {
+		logger.LogError("Error removing data exports", err)
+	}
+	utils.RemoveUploads(files)
+	return nil
+}
+
+// PurgeDeletedAccounts removes every account whose grace period is over.
+func PurgeDeletedAccounts() (int, error) {
+	rows, err := db.DB.Query("SELECT id FROM users WHERE delete_after IS NOT NULL AND delete_after <= ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	purged := 0
+	for _, userID := range userIDs {
+		if err := PurgeAccount(userID); err != nil {
+			logger.LogError("Error purging account "+userID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartDeletionSweeper purges accounts past their grace period now and then
+// every interval.
+func StartDeletionSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := PurgeDeletedAccounts()
+			if err != nil {
+				logger.LogError("Error purging deleted accounts", err)
+			} else if n > 0 {
+				log.Printf("Purged %d deleted account(s)", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestPurgeAccount(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.User(t, "u-leaving", "leaving", "leaving@test.local", true)
+	dbtest.User(t, "u-admin", "admin", "admin@test.local", true)
+	dbtest.User(t, "u-member", "member", "member@test.local", true)
+	dbtest.User(t, "u-pending", "pending", "pending@test.local", true)
+	dbtest.User(t, "u-other", "other", "other@test.local", true)
+
+	dbtest.Exec(t,
+		// g-handover has an admin to take over, g-member-only a plain member,
+		// g-alone only a pending request, and g-other belongs to someone else.
+		"INSERT INTO groups (id, creator_id, title, description) VALUES ('g-handover', 'u-leaving', 'Handover', ''), ('g-member-only', 'u-leaving', 'Member only', ''), ('g-alone', 'u-leaving', 'Alone', ''), ('g-other', 'u-other', 'Other', '')",
+		`INSERT INTO group_members (group_id, user_id, status, is_admin) VALUES
+			('g-handover', 'u-leaving', 'accepted', 1), ('g-handover', 'u-member', 'accepted', 0), ('g-handover', 'u-admin', 'accepted', 1), ('g-handover', 'u-pending', 'pending', 1),
+			('g-member-only', 'u-leaving', 'accepted', 1), ('g-member-only', 'u-member', 'accepted', 0),
+			('g-alone', 'u-leaving', 'accepted', 1), ('g-alone', 'u-pending', 'pending', 0),
+			('g-other', 'u-other', 'accepted', 1), ('g-other', 'u-leaving', 'accepted', 0)`,
+		`INSERT INTO group_posts (id, group_id, user_id, title, content, creation_date) VALUES
+			('gp-handover', 'g-handover', 'u-member', 'Stays', '', CURRENT_TIMESTAMP),
+			('gp-alone', 'g-alone', 'u-leaving', 'Goes with the group', '', CURRENT_TIMESTAMP),
+			('gp-by-leaving', 'g-other', 'u-leaving', 'Goes with the author', '', CURRENT_TIMESTAMP),
+			('gp-other', 'g-other', 'u-other', 'Stays', '', CURRENT_TIMESTAMP)`,
+		`INSERT INTO group_comments (id, group_post_id, author, content, creation_date) VALUES
+			('gc-alone', 'gp-alone', 'other', 'In a deleted group', CURRENT_TIMESTAMP),
+			('gc-by-leaving', 'gp-other', 'leaving', 'By the user', CURRENT_TIMESTAMP),
+			('gc-other', 'gp-other', 'other', 'Stays', CURRENT_TIMESTAMP)`,
+		"INSERT INTO events (id, title, description, event_datetime, creator_id, group_id) VALUES ('e-alone', 'Party', '', CURRENT_TIMESTAMP, 'u-other', 'g-alone'), ('e-by-leaving', 'Meetup', '', CURRENT_TIMESTAMP, 'u-leaving', 'g-other')",
+		"INSERT INTO event_responses (id, user_id, event_id, option) VALUES ('er-alone', 'u-other', 'e-alone', 1), ('er-leaving', 'u-leaving', 'e-other', 1), ('er-on-leaving-event', 'u-other', 'e-by-leaving', 1)",
+		"INSERT INTO group_messages (id, group_id, sender_id, content) VALUES ('gm-alone', 'g-alone', 'u-other', 'Hi'), ('gm-by-leaving', 'g-other', 'u-leaving', 'Hi'), ('gm-other', 'g-other', 'u-other', 'Hi')",
+
+		`INSERT INTO posts (id, user_id, author, title, content, creation_date, status, repost_of) VALUES
+			('p-leaving', 'u-leaving', 'leaving', 'Goodbye', 'Goodbye', CURRENT_TIMESTAMP, 'semi-private', NULL),
+			('p-other', 'u-other', 'other', 'Staying', 'Staying', CURRENT_TIMESTAMP, 'public', NULL),
+			('p-plain', 'u-other', 'other', '', '', CURRENT_TIMESTAMP, 'public', 'p-leaving'),
+			('p-quote', 'u-other', 'other', '', 'So long', CURRENT_TIMESTAMP, 'public', 'p-leaving'),
+			('p-repost-by-leaving', 'u-leaving', 'leaving', '', '', CURRENT_TIMESTAMP, 'public', 'p-other')`,
+		"INSERT INTO post_revisions (id, post_id, title, content, status, created_at) VALUES ('rev-leaving', 'p-leaving', 'Hi', 'Hi', 'public', CURRENT_TIMESTAMP)",
+		"INSERT INTO postsPrivacy (id, post_id, user_id) VALUES ('pp-leaving-post', 'p-leaving', 'u-other'), ('pp-leaving-audience', 'p-other', 'u-leaving')",
+		`INSERT INTO comments (id, post_id, author, content, creation_date) VALUES
+			('c-on-leaving-post', 'p-leaving', 'other', 'Bye', CURRENT_TIMESTAMP),
+			('c-by-leaving', 'p-other', 'leaving', 'Bye', CURRENT_TIMESTAMP),
+			('c-other', 'p-other', 'other', 'Stays', CURRENT_TIMESTAMP)`,
+		`INSERT INTO reactions (id, target_type, target_id, user_id, reaction, created_at) VALUES
+			('r-by-leaving', 'post', 'p-other', 'u-leaving', 'like', CURRENT_TIMESTAMP),
+			('r-on-leaving-post', 'post', 'p-leaving', 'u-other', 'like', CURRENT_TIMESTAMP),
+			('r-on-plain-repost', 'post', 'p-plain', 'u-member', 'like', CURRENT_TIMESTAMP),
+			('r-on-group-post', 'group_post', 'gp-alone', 'u-other', 'like', CURRENT_TIMESTAMP),
+			('r-other', 'comment', 'c-other', 'u-member', 'like', CURRENT_TIMESTAMP)`,
+		"INSERT INTO hashtags (target_type, target_id, tag, created_at) VALUES ('post', 'p-leaving', 'bye', CURRENT_TIMESTAMP), ('post', 'p-other', 'stay', CURRENT_TIMESTAMP)",
+		`INSERT INTO mentions (target_type, target_id, user_id, author_id, created_at) VALUES
+			('post', 'p-other', 'u-leaving', 'u-other', CURRENT_TIMESTAMP),
+			('comment', 'c-other', 'u-member', 'u-other', CURRENT_TIMESTAMP)`,
+		"INSERT INTO bookmark_collections (id, user_id, name, created_at) VALUES ('bc-leaving', 'u-leaving', 'Saved', CURRENT_TIMESTAMP)",
+		`INSERT INTO bookmarks (id, user_id, target_type, target_id, collection_id, created_at) VALUES
+			('b-by-leaving', 'u-leaving', 'post', 'p-other', 'bc-leaving', CURRENT_TIMESTAMP),
+			('b-on-leaving-post', 'u-other', 'post', 'p-leaving', NULL, CURRENT_TIMESTAMP),
+			('b-other', 'u-member', 'post', 'p-other', NULL, CURRENT_TIMESTAMP)`,
+		"INSERT INTO messages (id, sender_id, receiver_id, content, creation_date) VALUES ('m-to-leaving', 'u-other', 'u-leaving', 'Hi', CURRENT_TIMESTAMP), ('m-other', 'u-other', 'u-member', 'Hi', CURRENT_TIMESTAMP)",
+		"INSERT INTO Followers (id, follower_id, followed_id, status) VALUES ('f-leaving', 'u-other', 'u-leaving', 'accepted'), ('f-other', 'u-member', 'u-other', 'accepted')",
+		`INSERT INTO notifications (id, user_id, sender_id, type, content, related_entity_id) VALUES
+			('n-to-leaving', 'u-leaving', 'u-other', 'follow', '', NULL),
+			('n-from-leaving', 'u-other', 'u-leaving', 'follow', '', NULL),
+			('n-group', 'u-other', 'u-other', 'group', '', 'g-alone'),
+			('n-other', 'u-member', 'u-other', 'follow', '', NULL)`,
+		"INSERT INTO sessions (session_id, user_id, token, expires_at) VALUES ('s-leaving', 'u-leaving', 't-leaving', '2999-01-01'), ('s-other', 'u-other', 't-other', '2999-01-01')",
+		"INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, created_at) VALUES ('pat-leaving', 'u-leaving', 'cli', 'h1', 'snp_', 'read', CURRENT_TIMESTAMP)",
+		"INSERT INTO user_identities (id, user_id, provider, subject, created_at) VALUES ('id-leaving', 'u-leaving', 'mock', 'sub', CURRENT_TIMESTAMP)",
+		"INSERT INTO username_history (old_username, user_id, renamed_at, expires_at) VALUES ('formerly', 'u-leaving', CURRENT_TIMESTAMP, '2999-01-01')",
+		"INSERT INTO password_resets (id, user_id, token_hash, expires_at, created_at) VALUES ('pr-leaving', 'u-leaving', 'h2', '2999-01-01', CURRENT_TIMESTAMP)",
+		"INSERT INTO email_verifications (id, user_id, email, token_hash, expires_at, created_at) VALUES ('ev-leaving', 'u-leaving', 'leaving@test.local', 'h3', '2999-01-01', CURRENT_TIMESTAMP)",
+		"INSERT INTO two_factor (user_id, secret, enabled, created_at) VALUES ('u-leaving', 'secret', 1, CURRENT_TIMESTAMP)",
+		"INSERT INTO recovery_codes (id, user_id, code_hash) VALUES ('rc-leaving', 'u-leaving', 'h4')",
+		"INSERT INTO login_challenges (id, user_id, token_hash, expires_at) VALUES ('lc-leaving', 'u-leaving', 'h5', '2999-01-01')",
+		"INSERT INTO login_throttle (throttle_key, failures, last_failure) VALUES ('account:u-leaving', 2, CURRENT_TIMESTAMP), ('account:u-other', 1, CURRENT_TIMESTAMP)",
+	)
+
+	if err := PurgeAccount("u-leaving"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"group goes to the accepted admin", "SELECT 1 FROM groups WHERE id = 'g-handover' AND creator_id = 'u-admin'", true},
+		{"heir stays an admin", "SELECT 1 FROM group_members WHERE group_id = 'g-handover' AND user_id = 'u-admin' AND is_admin = '1'", true},
+		{"handed over group keeps its posts", "SELECT 1 FROM group_posts WHERE id = 'gp-handover'", true},
+		{"group without an admin goes to a member", "SELECT 1 FROM groups WHERE id = 'g-member-only' AND creator_id = 'u-member'", true},
+		{"member becomes admin", "SELECT 1 FROM group_members WHERE group_id = 'g-member-only' AND user_id = 'u-member' AND is_admin = '1'", true},
+		{"group with no one else", "SELECT 1 FROM groups WHERE id = 'g-alone'", false},
+		{"its members", "SELECT 1 FROM group_members WHERE group_id = 'g-alone'", false},
+		{"its posts", "SELECT 1 FROM group_posts WHERE id = 'gp-alone'", false},
+		{"its comments", "SELECT 1 FROM group_comments WHERE id = 'gc-alone'", false},
+		{"its events", "SELECT 1 FROM events WHERE id = 'e-alone'", false},
+		{"its event responses", "SELECT 1 FROM event_responses WHERE id = 'er-alone'", false},
+		{"its messages", "SELECT 1 FROM group_messages WHERE id = 'gm-alone'", false},
+		{"its notifications", "SELECT 1 FROM notifications WHERE id = 'n-group'", false},
+		{"reactions on its posts", "SELECT 1 FROM reactions WHERE id = 'r-on-group-post'", false},
+		{"other group", "SELECT 1 FROM groups WHERE id = 'g-other'", true},
+		{"membership elsewhere", "SELECT 1 FROM group_members WHERE user_id = 'u-leaving'", false},
+		{"group posts elsewhere", "SELECT 1 FROM group_posts WHERE id = 'gp-by-leaving'", false},
+		{"group comments elsewhere", "SELECT 1 FROM group_comments WHERE id = 'gc-by-leaving'", false},
+		{"others' group content", "SELECT 1 FROM group_posts p JOIN group_comments c ON c.group_post_id = p.id WHERE p.id = 'gp-other' AND c.id = 'gc-other'", true},
+		{"own events", "SELECT 1 FROM events WHERE id = 'e-by-leaving'", false},
+		{"event responses", "SELECT 1 FROM event_responses WHERE id IN ('er-leaving', 'er-on-leaving-event')", false},
+		{"own group messages", "SELECT 1 FROM group_messages WHERE id = 'gm-by-leaving'", false},
+		{"others' group messages", "SELECT 1 FROM group_messages WHERE id = 'gm-other'", true},
+
+		{"own posts and reposts", "SELECT 1 FROM posts WHERE user_id = 'u-leaving'", false},
+		{"plain repost by another user", "SELECT 1 FROM posts WHERE id = 'p-plain'", false},
+		{"quote by another user", "SELECT 1 FROM posts WHERE id = 'p-quote' AND repost_of IS NULL", true},
+		{"revisions", "SELECT 1 FROM post_revisions WHERE id = 'rev-leaving'", false},
+		{"audience lists", "SELECT 1 FROM postsPrivacy WHERE id IN ('pp-leaving-post', 'pp-leaving-audience')", false},
+		{"comments on and by the user", "SELECT 1 FROM comments WHERE id IN ('c-on-leaving-post', 'c-by-leaving')", false},
+		{"reactions by, on and through the user", "SELECT 1 FROM reactions WHERE id IN ('r-by-leaving', 'r-on-leaving-post', 'r-on-plain-repost')", false},
+		{"hashtags of own posts", "SELECT 1 FROM hashtags WHERE target_id = 'p-leaving'", false},
+		{"mentions of the user", "SELECT 1 FROM mentions WHERE user_id = 'u-leaving'", false},
+		{"bookmarks by and of the user", "SELECT 1 FROM bookmarks WHERE id IN ('b-by-leaving', 'b-on-leaving-post')", false},
+		{"bookmark collections", "SELECT 1 FROM bookmark_collections WHERE user_id = 'u-leaving'", false},
+		{"messages", "SELECT 1 FROM messages WHERE id = 'm-to-leaving'", false},
+		{"followers", "SELECT 1 FROM Followers WHERE id = 'f-leaving'", false},
+		{"notifications", "SELECT 1 FROM notifications WHERE id IN ('n-to-leaving', 'n-from-leaving')", false},
+		{"sessions", "SELECT 1 FROM sessions WHERE user_id = 'u-leaving'", false},
+		{"access tokens", "SELECT 1 FROM personal_access_tokens WHERE user_id = 'u-leaving'", false},
+		{"identities", "SELECT 1 FROM user_identities WHERE user_id = 'u-leaving'", false},
+		{"username history", "SELECT 1 FROM username_history WHERE user_id = 'u-leaving'", false},
+		{"password resets", "SELECT 1 FROM password_resets WHERE user_id = 'u-leaving'", false},
+		{"email verifications", "SELECT 1 FROM email_verifications WHERE user_id = 'u-leaving'", false},
+		{"two-factor secret", "SELECT 1 FROM two_factor WHERE user_id = 'u-leaving'", false},
+		{"recovery codes", "SELECT 1 FROM recovery_codes WHERE user_id = 'u-leaving'", false},
+		{"login challenges", "SELECT 1 FROM login_challenges WHERE user_id = 'u-leaving'", false},
+		{"login throttle", "SELECT 1 FROM login_throttle WHERE throttle_key = 'account:u-leaving'", false},
+		{"user", "SELECT 1 FROM users WHERE id = 'u-leaving'", false},
+
+		{"others' posts", "SELECT 1 FROM posts WHERE id = 'p-other'", true},
+		{"others' comments", "SELECT 1 FROM comments WHERE id = 'c-other'", true},
+		{"others' reactions", "SELECT 1 FROM reactions WHERE id = 'r-other'", true},
+		{"others' hashtags", "SELECT 1 FROM hashtags WHERE target_id = 'p-other'", true},
+		{"others' mentions", "SELECT 1 FROM mentions WHERE user_id = 'u-member'", true},
+		{"others' bookmarks", "SELECT 1 FROM bookmarks WHERE id = 'b-other'", true},
+		{"others' messages", "SELECT 1 FROM messages WHERE id = 'm-other'", true},
+		{"others' followers", "SELECT 1 FROM Followers WHERE id = 'f-other'", true},
+		{"others' notifications", "SELECT 1 FROM notifications WHERE id = 'n-other'", true},
+		{"others' sessions", "SELECT 1 FROM sessions WHERE session_id = 's-other'", true},
+		{"others' login throttle", "SELECT 1 FROM login_throttle WHERE throttle_key = 'account:u-other'", true},
+	}
+	for _, tt := range tests {
+		if got := dbtest.Exists(t, tt.query); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAccountDeletionGracePeriod(t *testing.T) {
+	dbtest.Open(t)
+	previous := config.Current
+	cfg := *previous
+	cfg.AccountDeletionGrace = 48 * time.Hour
+	config.Current = &cfg
+	t.Cleanup(func() { config.Current = previous })
+
+	userID := dbtest.User(t, "u-deleting", "deleting", "deleting@test.local", true)
+	if _, err := db.DB.Exec("UPDATE users SET password = ? WHERE id = ?", Hashpwd("secret12"), userID); err != nil {
+		t.Fatal(err)
+	}
+	session.Setsession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), userID)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		want    int
+	}{
+		{"wrong password", DeleteAccount, `{"password":"wrong"}`, http.StatusUnauthorized},
+		{"nothing to cancel", CancelAccountDeletion, ``, http.StatusBadRequest},
+		{"schedule", DeleteAccount, `{"password":"secret12"}`, http.StatusOK},
+		{"schedule twice", DeleteAccount, `{"password":"secret12"}`, http.StatusBadRequest},
+		{"cancel", CancelAccountDeletion, ``, http.StatusOK},
+		{"schedule again", DeleteAccount, `{"password":"secret12"}`, http.StatusOK},
+	}
+	var current string
+	for _, tt := range tests {
+		r := dbtest.SignedIn(t, http.MethodPost, "/", strings.NewReader(tt.body), userID)
+		cookie, _ := r.Cookie("token")
+		current = session.CurrentSessionID(cookie.Value)
+		w := httptest.NewRecorder()
+		session.RequireAuth(tt.handler)(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	when, pending := DeletionScheduled(userID)
+	if !pending || when.Before(time.Now().Add(47*time.Hour)) || when.After(time.Now().Add(48*time.Hour)) {
+		t.Errorf("deletion scheduled = %v at %v, want in 48h", pending, when)
+	}
+	// Scheduling signs out every other session.
+	var sessions []string
+	rows, err := db.DB.Query("SELECT session_id FROM sessions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		sessions = append(sessions, id)
+	}
+	rows.Close()
+	if len(sessions) != 1 || sessions[0] != current {
+		t.Errorf("sessions left = %v, want only %s", sessions, current)
+	}
+
+	// The account stays until the grace period is over.
+	if n, err := PurgeDeletedAccounts(); err != nil || n != 0 {
+		t.Errorf("during the grace period: purged %d, %v", n, err)
+	}
+	if !dbtest.Exists(t, "SELECT 1 FROM users WHERE id = 'u-deleting'") {
+		t.Error("account purged during the grace period")
+	}
+}
+
+func TestDeletionSweeper(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.User(t, "u-due", "due", "due@test.local", true)
+	dbtest.User(t, "u-waiting", "waiting", "waiting@test.local", true)
+	dbtest.User(t, "u-staying", "staying", "staying@test.local", true)
+	if _, err := db.DB.Exec("UPDATE users SET delete_after = ? WHERE id = 'u-due'", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec("UPDATE users SET delete_after = ? WHERE id = 'u-waiting'", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sweeper purges once right away, then waits for the interval.
+	StartDeletionSweeper(time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for dbtest.Exists(t, "SELECT 1 FROM users WHERE id = 'u-due'") {
+		if time.Now().After(deadline) {
+			t.Fatal("the sweeper did not purge the account past its grace period")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"u-due", false},
+		{"u-waiting", true},
+		{"u-staying", true},
+	}
+	for _, tt := range tests {
+		if got := dbtest.Exists(t, "SELECT 1 FROM users WHERE id = '"+tt.user+"'"); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.user, got, tt.want)
+		}
+	}
+}
@@ -6,14 +6,16 @@ import (
 	"log"
 	"net/http"
 
+	"social-net/config"
 	"social-net/db"
+	"social-net/session"
 )
 
 func GetAvatar(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		log.Println("[GetAvatar] OPTIONS request received, returning 200 OK")
@@ -33,7 +35,7 @@ func GetAvatar(w http.ResponseWriter, r *http.Request) {
 		SELECT avatar FROM users WHERE username = ?
 	`
 		fmt.Println("username", ava.Username)
-		rows, err := db.DB.Query(query, ava.Username)
+		rows, err := db.DB.Query(query, session.CurrentUsername(ava.Username))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
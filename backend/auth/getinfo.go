@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
 	"social-net/session"
@@ -20,38 +22,24 @@ type Info struct {
 	Bio       string
 	Password  string
 	Avatar    string
+	Verified  bool
+	Role      string
+	// DeleteAfter is set while the account is scheduled for deletion.
+	DeleteAfter *time.Time `json:",omitempty"`
 }
 
 func Getinfo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		logger.LogError("Unauthorized: Missing token", err)
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-
-	token := cookie.Value
-	userID, ok := session.GetUserIDFromToken(token)
-	if !ok || userID == "" {
-		logger.LogError("Unauthorized: Missing token", err)
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
-	username, ok := session.GetUsernameFromUserID(userID)
-	if !ok || username == "" {
-		logger.LogError("Unauthorized: Invalid token", err)
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	user, _ := session.CurrentUser(r)
+	username := user.Username
 	var info Info
 
 	avatar := ""
-	err = db.DB.QueryRow("SELECT id, username, email, first_name, last_name, date_of_birth,bio, avatar FROM users WHERE username=?", username).Scan(&info.ID, &info.Username, &info.Email, &info.Firstname, &info.Lastname, &info.Date, &info.Bio, &avatar)
+	err := db.DB.QueryRow("SELECT id, username, email, first_name, last_name, date_of_birth,bio, avatar FROM users WHERE username=?", username).Scan(&info.ID, &info.Username, &info.Email, &info.Firstname, &info.Lastname, &info.Date, &info.Bio, &avatar)
 	if err != nil {
 		logger.LogError("Error retrieving user information", err)
 		if err == sql.ErrNoRows {
@@ -66,6 +54,12 @@ func Getinfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	info.Verified = IsVerified(info.ID)
+	info.Role = session.UserRole(info.ID)
+	if when, pending := DeletionScheduled(info.ID); pending {
+		info.DeleteAfter = &when
+	}
+
 	if avatar != "" {
 		info.Avatar = avatar
 	} else {
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 
+	"social-net/audit"
+	"social-net/config"
 	"social-net/db"
 	"social-net/session"
 )
@@ -22,10 +24,10 @@ type User struct {
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	log.Println("[Login] Headers set:", w.Header())
 
@@ -68,11 +70,23 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 		if user.Username != "" && user.Password != "" && user.FirstName == "" {
 			log.Println("[Login] Login attempt for user:", user.Username)
+			accountKey, accountID := accountThrottleKey(user.Username)
+			ipKey := ipThrottleKey(r)
+			if wait := loginRetryAfter(accountKey, ipKey); wait > 0 {
+				log.Println("[Login] Login locked for user:", user.Username)
+				sendLockedOut(w, wait)
+				return
+			}
 			var pass string
 			err := db.DB.QueryRow("SELECT password FROM users WHERE username = ? OR email = ?", user.Username, user.Username).Scan(&pass)
 			log.Println("[Login] DB password fetch result:", pass, "err:", err)
 			if !Validate(pass, user.Password) {
 				log.Println("[Login] Invalid password for user:", user.Username)
+				if lock := loginFailed(r, accountKey, accountID, audit.Meta{"username": user.Username}); lock > 0 {
+					sendLockedOut(w, lock)
+					return
+				}
+				audit.Log(r, "", "login_failed", "user", accountID, audit.Meta{"username": user.Username})
 				Senddata(w, 2, "Invalid password", "Error Password")
 				return
 			}
@@ -95,7 +109,34 @@ func Login(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			log.Println("[Login] User ID fetched:", user_id)
+			if s, suspended := session.UserSuspension(user_id); suspended {
+				log.Println("[Login] Suspended user tried to log in:", user.Username)
+				Senddata(w, 2, suspensionMessage(s), s)
+				return
+			}
+			if TwoFactorEnabled(user_id) {
+				challenge, err := startLoginChallenge(user_id)
+				if err != nil {
+					log.Println("[Login] Error creating two-factor challenge:", err)
+					http.Error(w, "Unknown Internal Error, Try again", http.StatusInternalServerError)
+					return
+				}
+				response := map[string]interface{}{
+					"message":    "Two-factor code required",
+					"status":     0,
+					"two_factor": true,
+					"challenge":  challenge,
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+			// With two-factor enabled the counter is only cleared once the
+			// code is accepted, so each password login does not buy more
+			// guesses at the second factor.
+			clearLoginFailures(accountKey)
 			session.Setsession(w, r, user_id)
+			audit.Log(r, user_id, "login", "user", user_id, audit.Meta{"method": "password"})
 			log.Println("[Login] Session set for user ID:", user_id)
 			response := map[string]interface{}{
 				"xyz":     user.Username,
@@ -111,3 +152,14 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+func suspensionMessage(s session.Suspension) string {
+	msg := "Your account has been banned"
+	if s.Until != nil {
+		msg = "Your account is suspended until " + s.Until.Format("2006-01-02 15:04")
+	}
+	if s.Reason != "" {
+		msg += ": " + s.Reason
+	}
+	return msg
+}
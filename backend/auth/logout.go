@@ -3,17 +3,18 @@ package auth
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
+	"social-net/audit"
+	"social-net/config"
 	logger "social-net/log"
 	"social-net/session"
 )
 
 func Logout(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	cookie, err := r.Cookie("token")
 	if err != nil {
@@ -31,18 +32,14 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = session.Deletesession(userid)
+	err = session.DeleteSessionByToken(token)
 	if err != nil {
 		logger.LogError("Failed to delete session", err)
 		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   "",
-		Expires: time.Now().Add(-time.Hour),
-		Path:    "/",
-	})
+	session.ClearTokenCookie(w)
+	audit.Log(r, userid, "logout", "user", userid, nil)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"social-net/config"
 	"social-net/db"
 	"social-net/session"
 
@@ -21,10 +23,10 @@ import (
 )
 
 func Register(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
@@ -45,7 +47,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := r.ParseMultipartForm(10 << 20)
+	err := r.ParseMultipartForm(config.Current.MaxRequestSize)
 	if err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
@@ -67,6 +69,18 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if user.Username != "" {
+		user.Username = NormalizeUsername(user.Username)
+		if err := checkUsername(user.Username, ""); err != nil {
+			if isUsernameError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				log.Println("DB error:", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
 
 	newpss := Hashpwd(user.Password)
 	privacy := "public"
@@ -76,53 +90,11 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	if err == nil && file != nil {
 		defer file.Close()
 
-		if handler.Size > 2*1024*1024 {
-			http.Error(w, "Avatar file too large", http.StatusBadRequest)
-			return
-		}
-
-		buff := make([]byte, 512)
-		_, _ = file.Read(buff)
-		contentType := http.DetectContentType(buff)
-		file.Seek(0, io.SeekStart)
-
-		allowedTypes := []string{"image/jpeg", "image/png", "image/gif"}
-		valid := false
-		for _, t := range allowedTypes {
-			if t == contentType {
-				valid = true
-				break
-			}
-		}
-		if !valid {
-			http.Error(w, "Invalid avatar file type", http.StatusBadRequest)
-			return
-		}
-
-		ext := filepath.Ext(handler.Filename)
-		safeFilename := fmt.Sprintf("%s_%d%s", user.Username, time.Now().Unix(), ext)
-
-		path := "./uploads"
-		_, err := os.Stat(path)
-		if os.IsNotExist(err) {
-			os.Mkdir(path, os.ModePerm)
-		}
-		savePath := filepath.Join(path, safeFilename)
-
-		out, err := os.Create(savePath)
-		if err != nil {
-			log.Println("Failed to save avatar:", err)
-			http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
-			return
-		}
-		defer out.Close()
-		_, err = io.Copy(out, file)
+		avatarFilename, err = saveAvatar(file, handler, user.Username)
 		if err != nil {
-			log.Println("Failed to write avatar:", err)
-			http.Error(w, "Failed to write avatar", http.StatusInternalServerError)
+			http.Error(w, err.Error(), avatarErrorStatus(err))
 			return
 		}
-		avatarFilename = safeFilename
 	}
 	user_id, err := uuid.NewV7()
 	if err != nil {
@@ -131,7 +103,10 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username := generateUSername(user.FirstName, user.LastName)
+	username := user.Username
+	if username == "" {
+		username = generateUSername(user.FirstName, user.LastName)
+	}
 	_, err = db.DB.Exec(`
 		INSERT INTO users (id, username, email, password, first_name, last_name, date_of_birth, bio, privacy, avatar, nickname)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
@@ -141,16 +116,29 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	if err := SendVerificationEmail(user_id.String(), user.Email); err != nil {
+		log.Println("Failed to send verification email:", err)
+	}
 	session.Setsession(w, r, user_id.String())
 	log.Println("[Register] Success:", username)
-	json.NewEncoder(w).Encode(map[string]string{"message": "register successful"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "register successful", "username": username})
 }
 
 func ValidateUser(u *User) error {
-	if u.Email == "" || !regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`).MatchString(u.Email) {
+	if err := ValidateEmail(u.Email); err != nil {
+		return err
+	}
+	return validateProfile(u)
+}
+
+func ValidateEmail(email string) error {
+	if email == "" || !regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`).MatchString(email) {
 		return errors.New("invalid email")
 	}
+	return nil
+}
 
+func validateProfile(u *User) error {
 	if u.FirstName == "" || !regexp.MustCompile(`^[a-zA-Z]{1,30}$`).MatchString(u.FirstName) {
 		return errors.New("invalid first name")
 	}
@@ -164,25 +152,108 @@ func ValidateUser(u *User) error {
 	if err != nil || year < 1940 || year > 2007 {
 		return errors.New("invalid or out-of-range birth year")
 	}
+	if len(u.Bio) > 500 {
+		return errors.New("bio must not exceed 500 characters")
+	}
+	if len(u.Nickname) > 30 {
+		return errors.New("nickname must not exceed 30 characters")
+	}
 	return nil
 }
 
+var (
+	errAvatarTooLarge = errors.New("Avatar file too large")
+	errAvatarType     = errors.New("Invalid avatar file type")
+)
+
+// saveAvatar checks an uploaded avatar and stores it under ./uploads,
+// returning the file name to keep on the user row.
+func saveAvatar(file multipart.File, handler *multipart.FileHeader, prefix string) (string, error) {
+	if handler.Size > config.Current.MaxImageSize {
+		return "", errAvatarTooLarge
+	}
+
+	buff := make([]byte, 512)
+	_, _ = file.Read(buff)
+	contentType := http.DetectContentType(buff)
+	file.Seek(0, io.SeekStart)
+
+	allowedTypes := []string{"image/jpeg", "image/png", "image/gif"}
+	valid := false
+	for _, t := range allowedTypes {
+		if t == contentType {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", errAvatarType
+	}
+
+	ext := filepath.Ext(handler.Filename)
+	safeFilename := fmt.Sprintf("%s_%d%s", prefix, time.Now().Unix(), ext)
+
+	path := config.Current.UploadsDir
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		os.Mkdir(path, os.ModePerm)
+	}
+	savePath := filepath.Join(path, safeFilename)
+
+	out, err := os.Create(savePath)
+	if err != nil {
+		log.Println("Failed to save avatar:", err)
+		return "", errors.New("Failed to save avatar")
+	}
+	defer out.Close()
+	_, err = io.Copy(out, file)
+	if err != nil {
+		log.Println("Failed to write avatar:", err)
+		return "", errors.New("Failed to write avatar")
+	}
+	return safeFilename, nil
+}
+
+func avatarErrorStatus(err error) int {
+	if err == errAvatarTooLarge || err == errAvatarType {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// generateUSername suggests a free username from the user's name, for
+// accounts created without choosing one.
 func generateUSername(firstName, lastName string) string {
-	firstInitial := strings.ToLower(string(firstName[0]))
-	lowerLast := strings.ToLower(lastName)
-	usernaem := firstInitial + lowerLast
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`
+	var initial string
+	if firstName != "" {
+		initial = firstName[:1]
+	}
+	base := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(initial+lastName))
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	if len(base) > 24 {
+		base = base[:24]
+	}
 	for i := 1; i < 100; i++ {
-		username := fmt.Sprintf("%s%d", usernaem, i)
-		var exists bool
-		err := db.DB.QueryRow(query, username).Scan(&exists)
+		username := fmt.Sprintf("%s%d", base, i)
+		if checkUsername(username, "") == nil {
+			return username
+		}
+	}
+	for {
+		suffix, _, err := GenerateToken()
 		if err != nil {
-			log.Println("DB error:", err)
 			return ""
 		}
-		if !exists {
+		username := base + "_" + suffix[:5]
+		if checkUsername(username, "") == nil {
 			return username
 		}
 	}
-	return fmt.Sprintf("%s%d", usernaem, time.Now().UnixNano())
 }
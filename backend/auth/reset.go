@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/mailer"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	resetTokenTTL = time.Hour
+	resetPath     = "/reset-password?token="
+)
+
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Email) == "" {
+		Senddata(w, 1, "Email is required", nil)
+		return
+	}
+
+	// The response is the same whether or not the address exists, so this
+	// endpoint cannot be used to find out who has an account.
+	const sent = "If that email is registered, a reset link has been sent"
+
+	var userID, email string
+	err := db.DB.QueryRow("SELECT id, email FROM users WHERE email = ?", strings.TrimSpace(request.Email)).Scan(&userID, &email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error looking up user for password reset", err)
+		}
+		Senddata(w, 0, sent, nil)
+		return
+	}
+
+	token, tokenHash, err := GenerateToken()
+	if err != nil {
+		logger.LogError("Error generating reset token", err)
+		Senddata(w, 3, "Unknown Internal Error, Try again", nil)
+		return
+	}
+	resetID, _ := uuid.NewV7()
+	now := time.Now()
+
+	_, err = db.DB.Exec("DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		logger.LogError("Error clearing old reset tokens", err)
+	}
+	_, err = db.DB.Exec("INSERT INTO password_resets (id, user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		resetID, userID, tokenHash, now.Add(resetTokenTTL), now)
+	if err != nil {
+		logger.LogError("Error storing reset token", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	body := "Someone asked to reset the password for your account.\n\n" +
+		"Open the link below within the next hour to choose a new password:\n" +
+		config.Current.FrontendURL + resetPath + token + "\n\n" +
+		"If this wasn't you, you can ignore this email."
+	if err := mailer.Default.Send(email, "Reset your password", body); err != nil {
+		logger.LogError("Error sending reset email", err)
+	}
+
+	Senddata(w, 0, sent, nil)
+}
+
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		Senddata(w, 1, "Token and password are required", nil)
+		return
+	}
+	if err := ValidatePassword(request.Password); err != nil {
+		Senddata(w, 1, err.Error(), nil)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.LogError("Error starting reset transaction", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	defer tx.Rollback()
+
+	var resetID, userID string
+	err = tx.QueryRow("SELECT id, user_id FROM password_resets WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		HashToken(request.Token), time.Now()).Scan(&resetID, &userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error looking up reset token", err)
+		}
+		Senddata(w, 2, "Invalid or expired reset link", nil)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = ? WHERE id = ?", time.Now(), resetID); err != nil {
+		logger.LogError("Error consuming reset token", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", Hashpwd(request.Password), userID); err != nil {
+		logger.LogError("Error updating password", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.LogError("Error committing password reset", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	session.Deletesession(userID)
+	session.RevokeAccessTokens(userID)
+	log.Println("[ResetPassword] Password reset for user:", userID)
+	audit.Log(r, userID, "password_reset", "user", userID, nil)
+	Senddata(w, 0, "Password has been reset, please log in again", nil)
+}
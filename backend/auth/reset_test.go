@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+	"social-net/mailer"
+	"social-net/session"
+)
+
+// fakeSMTP accepts mail on a local port and hands every message body to the
+// returned channel. It speaks just enough SMTP for net/smtp.SendMail.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var body strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				body.WriteString(line)
+			}
+			messages <- body.String()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+var resetLink = regexp.MustCompile(`reset-password\?token=([0-9a-f]+)`)
+
+func TestPasswordReset(t *testing.T) {
+	dbtest.Open(t)
+	addr, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	previous := mailer.Default
+	mailer.Default = &mailer.SMTPMailer{Host: host, Port: port, From: "no-reply@test.local"}
+	t.Cleanup(func() { mailer.Default = previous })
+
+	userID := dbtest.User(t, "u-reset", "resetme", "resetme@test.local", true)
+	if _, err := db.DB.Exec(`INSERT INTO sessions (session_id, user_id, token, expires_at, created_at, last_used_at, rotated_at)
+		VALUES ('s1', ?, 'old-token', ?, ?, ?, ?)`, userID, time.Now().Add(time.Hour), time.Now(), time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	accessToken, _, err := session.CreateAccessToken(userID, "script", []string{session.ScopeRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestToken := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/api/auth/forgot", strings.NewReader(`{"email":"resetme@test.local"}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("forgot: status %d: %s", w.Code, w.Body)
+		}
+		select {
+		case msg := <-messages:
+			m := resetLink.FindStringSubmatch(msg)
+			if m == nil {
+				t.Fatalf("no reset link in mail:\n%s", msg)
+			}
+			return m[1]
+		case <-time.After(5 * time.Second):
+			t.Fatal("no mail received")
+		}
+		return ""
+	}
+	reset := func(token string) int {
+		w := httptest.NewRecorder()
+		ResetPassword(w, httptest.NewRequest(http.MethodPost, "/api/auth/reset",
+			strings.NewReader(`{"token":"`+token+`","password":"new-secret"}`)))
+		return w.Code
+	}
+
+	superseded := requestToken()
+	token := requestToken()
+	expired := strings.Repeat("cd", 32)
+	if _, err := db.DB.Exec("INSERT INTO password_resets (id, user_id, token_hash, expires_at, created_at) VALUES ('r-expired', ?, ?, ?, ?)",
+		userID, HashToken(expired), time.Now().Add(-time.Minute), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"superseded token", superseded, http.StatusUnauthorized},
+		{"expired token", expired, http.StatusUnauthorized},
+		{"unknown token", strings.Repeat("ab", 32), http.StatusUnauthorized},
+		{"valid token", token, http.StatusOK},
+		{"token used twice", token, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reset(tt.token); got != tt.want {
+				t.Errorf("reset status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	var password string
+	var sessions int
+	db.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&password)
+	db.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", userID).Scan(&sessions)
+	if !Validate(password, "new-secret") {
+		t.Error("password was not changed")
+	}
+	if sessions != 0 {
+		t.Errorf("%d sessions survived the reset", sessions)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	if _, err := session.AuthCookie(r); err == nil {
+		t.Error("an access token survived the reset")
+	}
+}
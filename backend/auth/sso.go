@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	errSSOEmailTaken      = errors.New("an account with this email already exists, sign in with your password to use it")
+	errSSOEmailUnverified = errors.New("an account with this email already exists but its address is not verified, sign in with your password and verify it first")
+)
+
+// oidcStateCookie ties a sign-in flow to the browser that started it. It
+// holds the hash of the state, so a callback URL carrying someone else's
+// state is refused instead of signing this browser into their account.
+const oidcStateCookie = "oidc_state"
+
+func setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   config.Current.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ssoRedirect sends the browser back to the frontend, with an error message
+// when the sign-in failed.
+func ssoRedirect(w http.ResponseWriter, r *http.Request, path string, params url.Values) {
+	target := config.Current.FrontendURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func ssoFail(w http.ResponseWriter, r *http.Request, message string) {
+	ssoRedirect(w, r, "/login", url.Values{"sso_error": {message}})
+}
+
+// safeRedirect only keeps same-site paths so the flow cannot be used as an
+// open redirect.
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
+
+// OIDCProvidersList returns the configured providers for the login page.
+func OIDCProvidersList(w http.ResponseWriter, r *http.Request) {
+	list := []map[string]string{}
+	for _, p := range OIDCProviders {
+		list = append(list, map[string]string{
+			"name":         p.Name,
+			"display_name": p.DisplayName,
+			"login_url":    "/api/auth/oidc/login?provider=" + url.QueryEscape(p.Name),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i]["name"] < list[j]["name"] })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// OIDCLogin starts the authorization code flow with PKCE and redirects the
+// browser to the provider.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	p, ok := OIDCProviders[r.URL.Query().Get("provider")]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	state, stateHash, err := GenerateToken()
+	if err != nil {
+		http.Error(w, "Unknown Internal Error, Try again", http.StatusInternalServerError)
+		return
+	}
+	nonce, _, err := GenerateToken()
+	if err != nil {
+		http.Error(w, "Unknown Internal Error, Try again", http.StatusInternalServerError)
+		return
+	}
+	verifier, _, err := GenerateToken()
+	if err != nil {
+		http.Error(w, "Unknown Internal Error, Try again", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := p.authURL(state, nonce, verifier)
+	if err != nil {
+		logger.LogError("Error loading OIDC provider "+p.Name, err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	db.DB.Exec("DELETE FROM oidc_states WHERE expires_at <= ?", now)
+	_, err = db.DB.Exec("INSERT INTO oidc_states (state_hash, provider, code_verifier, nonce, redirect_to, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		stateHash, p.Name, verifier, nonce, safeRedirect(r.URL.Query().Get("redirect")), now.Add(oidcStateTTL))
+	if err != nil {
+		logger.LogError("Error storing OIDC state", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	setOIDCStateCookie(w, stateHash, int(oidcStateTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback finishes the flow: it checks the state, exchanges the code,
+// verifies the ID token and signs the matching user in.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cookie, cookieErr := r.Cookie(oidcStateCookie)
+	setOIDCStateCookie(w, "", -1)
+	if e := q.Get("error"); e != "" {
+		log.Println("[OIDCCallback] Provider returned error:", e, q.Get("error_description"))
+		ssoFail(w, r, "Sign-in was cancelled or denied")
+		return
+	}
+	state, code := q.Get("state"), q.Get("code")
+	if state == "" || code == "" {
+		ssoFail(w, r, "Invalid sign-in response")
+		return
+	}
+
+	stateHash := HashToken(state)
+	if cookieErr != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+		ssoFail(w, r, "Sign-in session is invalid, please try again")
+		return
+	}
+
+	// The state row is removed before anything else so it can only be used once.
+	var providerName, verifier, nonce, redirectTo string
+	var expiresAt time.Time
+	err := db.DB.QueryRow("SELECT provider, code_verifier, nonce, redirect_to, expires_at FROM oidc_states WHERE state_hash = ?", stateHash).
+		Scan(&providerName, &verifier, &nonce, &redirectTo, &expiresAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error loading OIDC state", err)
+		}
+		ssoFail(w, r, "Sign-in session is invalid, please try again")
+		return
+	}
+	db.DB.Exec("DELETE FROM oidc_states WHERE state_hash = ?", stateHash)
+	if expiresAt.Before(time.Now()) {
+		ssoFail(w, r, "Sign-in took too long, please try again")
+		return
+	}
+	p, ok := OIDCProviders[providerName]
+	if !ok {
+		ssoFail(w, r, "Unknown provider")
+		return
+	}
+
+	rawIDToken, err := p.exchange(code, verifier)
+	if err != nil {
+		logger.LogError("Error exchanging OIDC code with "+p.Name, err)
+		ssoFail(w, r, "Could not complete sign-in with "+p.DisplayName)
+		return
+	}
+	claims, err := p.verifyIDToken(rawIDToken, nonce)
+	if err != nil {
+		logger.LogError("Rejected ID token from "+p.Name, err)
+		ssoFail(w, r, "Could not complete sign-in with "+p.DisplayName)
+		return
+	}
+
+	userID, err := ssoUser(p, claims)
+	if err != nil {
+		if err == errSSOEmailTaken || err == errSSOEmailUnverified {
+			ssoFail(w, r, err.Error())
+			return
+		}
+		logger.LogError("Error resolving SSO user", err)
+		ssoFail(w, r, "Could not complete sign-in")
+		return
+	}
+	if s, suspended := session.UserSuspension(userID); suspended {
+		ssoFail(w, r, suspensionMessage(s))
+		return
+	}
+
+	// Like a password login, the sign-in is only complete once the second
+	// factor is accepted; until then it is recorded as pending.
+	if TwoFactorEnabled(userID) {
+		challenge, err := startLoginChallenge(userID)
+		if err != nil {
+			logger.LogError("Error creating two-factor challenge", err)
+			ssoFail(w, r, "Could not complete sign-in")
+			return
+		}
+		audit.Log(r, userID, "sso_login_pending", "user", userID, audit.Meta{"provider": p.Name})
+		ssoRedirect(w, r, "/login", url.Values{"two_factor": {"1"}, "challenge": {challenge}})
+		return
+	}
+
+	session.Setsession(w, r, userID)
+	audit.Log(r, userID, "sso_login", "user", userID, audit.Meta{"provider": p.Name})
+	log.Println("[OIDCCallback] Signed in through", p.Name, "user:", userID)
+	ssoRedirect(w, r, redirectTo, nil)
+}
+
+// ssoUser finds the account linked to the identity. On first login it links
+// an existing account with the same email when both the provider and the
+// account have verified it, or creates a new one. An unverified account may
+// have been registered by someone else with this address, who would keep
+// its password.
+func ssoUser(p *OIDCProvider, claims *oidcClaims) (string, error) {
+	var userID string
+	err := db.DB.QueryRow("SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?", p.Name, claims.Subject).Scan(&userID)
+	if err == nil {
+		db.DB.Exec("UPDATE user_identities SET last_login_at = ?, email = ? WHERE provider = ? AND subject = ?", time.Now(), claims.Email, p.Name, claims.Subject)
+		return userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email != "" {
+		var verifiedAt sql.NullTime
+		err = db.DB.QueryRow("SELECT id, verified_at FROM users WHERE email = ? COLLATE NOCASE", email).Scan(&userID, &verifiedAt)
+		switch {
+		case err == nil && !claims.emailVerified():
+			return "", errSSOEmailTaken
+		case err == nil && !verifiedAt.Valid:
+			return "", errSSOEmailUnverified
+		case err == nil:
+			return userID, linkIdentity(userID, p, claims)
+		case err != sql.ErrNoRows:
+			return "", err
+		}
+	}
+	if email == "" || ValidateEmail(email) != nil {
+		return "", errors.New("provider did not return a usable email address")
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		if f := strings.Fields(claims.Name); len(f) > 0 {
+			firstName, lastName = f[0], strings.Join(f[1:], " ")
+		}
+	}
+	if firstName == "" {
+		firstName = strings.SplitN(email, "@", 2)[0]
+	}
+	if lastName == "" {
+		lastName = firstName
+	}
+
+	// The account gets an unusable random password; the user can set one
+	// later through the reset flow.
+	password, _, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	newID, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	var verifiedAt interface{}
+	if claims.emailVerified() {
+		verifiedAt = time.Now()
+	}
+
+	username := generateUSername(firstName, lastName)
+	_, err = db.DB.Exec(`
+		INSERT INTO users (id, username, email, password, first_name, last_name, date_of_birth, bio, privacy, avatar, nickname, verified_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, '', 'public', '', ?, ?)`,
+		newID.String(), username, email, Hashpwd(password), firstName, lastName, claims.Birthdate, claims.Nickname, verifiedAt)
+	if err != nil {
+		return "", err
+	}
+	if verifiedAt == nil {
+		if err := SendVerificationEmail(newID.String(), email); err != nil {
+			log.Println("Failed to send verification email:", err)
+		}
+	}
+	log.Println("[OIDCCallback] Created user", username, "from", p.Name)
+	return newID.String(), linkIdentity(newID.String(), p, claims)
+}
+
+func linkIdentity(userID string, p *OIDCProvider, claims *oidcClaims) error {
+	identityID, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = db.DB.Exec("INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		identityID.String(), userID, p.Name, claims.Subject, claims.Email, now, now)
+	return err
+}
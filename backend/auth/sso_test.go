@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+// mockProvider is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that checks PKCE before handing out an RS256 ID token.
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is what the provider remembers about an authorization code.
+type mockGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, codes: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		grant, ok := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		m.mu.Unlock()
+		id, secret, _ := r.BasicAuth()
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		case id != "social-network" || secret != "s3cret":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		case pkceChallenge(r.Form.Get("code_verifier")) != grant.challenge:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, grant.claims)})
+		}
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize plays the provider's login page: it accepts the request built by
+// OIDCLogin and returns an authorization code for an ID token with claims,
+// after edit has had a chance to change them.
+func (m *mockProvider) authorize(t *testing.T, authURL string, subject string, email string, edit func(claims map[string]interface{}, grant *mockGrant)) (string, string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, m.URL+"/authorize") {
+		t.Fatalf("unexpected authorization URL %q", authURL)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "social-network" {
+		t.Fatalf("authorization request is missing PKCE or client_id: %s", authURL)
+	}
+	claims := map[string]interface{}{
+		"iss":            m.URL,
+		"sub":            subject,
+		"aud":            "social-network",
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          q.Get("nonce"),
+		"email":          email,
+		"email_verified": true,
+		"name":           "Sam Doe",
+	}
+	grant := mockGrant{challenge: q.Get("code_challenge"), claims: claims}
+	if edit != nil {
+		edit(claims, &grant)
+	}
+	code, _, _ := GenerateToken()
+	m.mu.Lock()
+	m.codes[code] = grant
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+// ssoFlow is one browser going through the sign-in.
+type ssoFlow struct {
+	authURL string
+	cookie  *http.Cookie
+}
+
+func startSSO(t *testing.T) ssoFlow {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login?provider=mock&redirect=/feed", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	flow := ssoFlow{authURL: w.Header().Get("Location")}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			flow.cookie = c
+		}
+	}
+	if flow.cookie == nil || !flow.cookie.HttpOnly {
+		t.Fatal("login did not set an HttpOnly state cookie")
+	}
+	return flow
+}
+
+// callback finishes a flow and returns where the browser was sent and
+// whether a session cookie was issued.
+func callback(state string, code string, cookie *http.Cookie) (string, bool) {
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	OIDCCallback(w, r)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "token" && c.Value != "" {
+			return w.Header().Get("Location"), true
+		}
+	}
+	return w.Header().Get("Location"), false
+}
+
+func setupSSO(t *testing.T) *mockProvider {
+	t.Helper()
+	dbtest.Open(t)
+	m := newMockProvider(t)
+	previous := OIDCProviders
+	OIDCProviders = map[string]*OIDCProvider{"mock": {
+		Name:         "mock",
+		DisplayName:  "Mock",
+		Issuer:       m.URL,
+		ClientID:     "social-network",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}}
+	t.Cleanup(func() { OIDCProviders = previous })
+	return m
+}
+
+func TestOIDCCallback(t *testing.T) {
+	m := setupSSO(t)
+
+	tests := []struct {
+		name string
+		// edit changes the ID token claims or the grant at the provider.
+		edit func(claims map[string]interface{}, grant *mockGrant)
+		// browser changes what the browser sends back to the callback.
+		browser func(flow *ssoFlow, state *string)
+		wantOK  bool
+	}{
+		{name: "valid sign-in", wantOK: true},
+		{name: "audience as a list", edit: func(c map[string]interface{}, _ *mockGrant) {
+			c["aud"] = []string{"other", "social-network"}
+		}, wantOK: true},
+		{name: "no state cookie", browser: func(f *ssoFlow, _ *string) { f.cookie = nil }},
+		{name: "state cookie from another flow", browser: func(f *ssoFlow, _ *string) {
+			f.cookie = startSSO(t).cookie
+		}},
+		{name: "state of another flow", browser: func(f *ssoFlow, state *string) {
+			_, *state = m.authorize(t, startSSO(t).authURL, "x", "x@test.local", nil)
+		}},
+		{name: "nonce mismatch", edit: func(c map[string]interface{}, _ *mockGrant) { c["nonce"] = "forged" }},
+		{name: "wrong PKCE verifier", edit: func(_ map[string]interface{}, g *mockGrant) {
+			g.challenge = pkceChallenge("some other verifier")
+		}},
+		{name: "wrong audience", edit: func(c map[string]interface{}, _ *mockGrant) { c["aud"] = "other-client" }},
+		{name: "wrong issuer", edit: func(c map[string]interface{}, _ *mockGrant) { c["iss"] = "https://evil.example" }},
+		{name: "expired ID token", edit: func(c map[string]interface{}, _ *mockGrant) {
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := startSSO(t)
+			subject := "subject-" + string(rune('a'+i))
+			code, state := m.authorize(t, flow.authURL, subject, subject+"@test.local", tt.edit)
+			if tt.browser != nil {
+				tt.browser(&flow, &state)
+			}
+			location, ok := callback(state, code, flow.cookie)
+			if ok != tt.wantOK {
+				t.Fatalf("signed in = %v, want %v (redirected to %s)", ok, tt.wantOK, location)
+			}
+			if ok && location != config.Current.FrontendURL+"/feed" {
+				t.Errorf("redirected to %s, want the requested page", location)
+			}
+			if !ok && !strings.Contains(location, "sso_error=") {
+				t.Errorf("failure redirected to %s without an error", location)
+			}
+		})
+	}
+
+	t.Run("state used twice", func(t *testing.T) {
+		flow := startSSO(t)
+		code, state := m.authorize(t, flow.authURL, "subject-replay", "replay@test.local", nil)
+		if _, ok := callback(state, code, flow.cookie); !ok {
+			t.Fatal("first callback failed")
+		}
+		code2, _ := m.authorize(t, flow.authURL, "subject-replay", "replay@test.local", nil)
+		if _, ok := callback(state, code2, flow.cookie); ok {
+			t.Error("a state was accepted twice")
+		}
+	})
+}
+
+func TestSSOLinksOnlyVerifiedAccounts(t *testing.T) {
+	m := setupSSO(t)
+	dbtest.User(t, "u-verified", "verified", "verified@test.local", true)
+	dbtest.User(t, "u-squatter", "squatter", "victim@test.local", false)
+
+	tests := []struct {
+		name          string
+		email         string
+		emailVerified bool
+		wantOK        bool
+		wantUser      string
+	}{
+		{"verified account is linked", "verified@test.local", true, true, "u-verified"},
+		{"unverified account is not linked", "victim@test.local", true, false, ""},
+		{"provider did not verify the email", "verified@test.local", false, false, ""},
+		{"new email creates an account", "fresh@test.local", true, true, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject := "link-" + string(rune('a'+i))
+			flow := startSSO(t)
+			code, state := m.authorize(t, flow.authURL, subject, tt.email, func(c map[string]interface{}, _ *mockGrant) {
+				c["email_verified"] = tt.emailVerified
+			})
+			if _, ok := callback(state, code, flow.cookie); ok != tt.wantOK {
+				t.Fatalf("signed in = %v, want %v", ok, tt.wantOK)
+			}
+
+			var userID string
+			err := db.DB.QueryRow("SELECT user_id FROM user_identities WHERE provider = 'mock' AND subject = ?", subject).Scan(&userID)
+			if !tt.wantOK {
+				if err == nil {
+					t.Errorf("identity was linked to %s", userID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("identity was not linked: %v", err)
+			}
+			if tt.wantUser != "" && userID != tt.wantUser {
+				t.Errorf("identity linked to %s, want %s", userID, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestSSOLoginAudit(t *testing.T) {
+	m := setupSSO(t)
+	dbtest.User(t, "u-plain", "plain", "plain@test.local", true)
+	dbtest.User(t, "u-second-factor", "secondfactor", "second@test.local", true)
+	dbtest.Exec(t, "INSERT INTO two_factor (user_id, secret, enabled, created_at) VALUES ('u-second-factor', 'secret', 1, CURRENT_TIMESTAMP)")
+
+	tests := []struct {
+		name        string
+		email       string
+		user        string
+		wantSession bool
+		// wantAction is the only event the sign-in may leave.
+		wantAction string
+	}{
+		{"without two-factor", "plain@test.local", "u-plain", true, "sso_login"},
+		{"with two-factor", "second@test.local", "u-second-factor", false, "sso_login_pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := startSSO(t)
+			code, state := m.authorize(t, flow.authURL, "audit-"+tt.user, tt.email, nil)
+			location, ok := callback(state, code, flow.cookie)
+			if ok != tt.wantSession {
+				t.Fatalf("signed in = %v, want %v (redirected to %s)", ok, tt.wantSession, location)
+			}
+			if !tt.wantSession && !strings.Contains(location, "challenge=") {
+				t.Errorf("redirected to %s without a challenge", location)
+			}
+
+			var actions []string
+			rows, err := db.DB.Query("SELECT action FROM audit_log WHERE actor_id = ? AND action LIKE 'sso_%'", tt.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var action string
+				rows.Scan(&action)
+				actions = append(actions, action)
+			}
+			if len(actions) != 1 || actions[0] != tt.wantAction {
+				t.Errorf("audit actions = %v, want [%s]", actions, tt.wantAction)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+// accountThrottleKey keys failures by user id when the account exists, and by
+// the identifier itself otherwise so unknown names are throttled too.
+func accountThrottleKey(identifier string) (string, string) {
+	if userID, err := session.GetUserIDFromUsername(identifier); err == nil {
+		return "account:" + userID, userID
+	}
+	return "account:" + strings.ToLower(strings.TrimSpace(identifier)), ""
+}
+
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + session.ClientIP(r)
+}
+
+// loginRetryAfter returns how long the caller must wait before trying again,
+// or zero when none of the keys is locked.
+func loginRetryAfter(keys ...string) time.Duration {
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		var lockedUntil sql.NullTime
+		err := db.DB.QueryRow("SELECT locked_until FROM login_throttle WHERE throttle_key = ?", key).Scan(&lockedUntil)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				logger.LogError("Error checking login throttle", err)
+			}
+			continue
+		}
+		if lockedUntil.Valid && lockedUntil.Time.After(now) {
+			if d := lockedUntil.Time.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// recordLoginFailure counts a failed attempt against key and returns the
+// lockout it triggered, if any. Reaching limit locks the key for the
+// configured base lockout, and every further failure doubles it up to the
+// maximum; the count resets after the failure window without failures.
+func recordLoginFailure(key string, limit int) time.Duration {
+	now := time.Now()
+	var failures int
+	var lastFailure time.Time
+	var lockedUntil sql.NullTime
+	err := db.DB.QueryRow("SELECT failures, last_failure, locked_until FROM login_throttle WHERE throttle_key = ?", key).Scan(&failures, &lastFailure, &lockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogError("Error reading login throttle", err)
+		return 0
+	}
+
+	quietSince := lastFailure
+	if lockedUntil.Valid && lockedUntil.Time.After(quietSince) {
+		quietSince = lockedUntil.Time
+	}
+	if now.Sub(quietSince) > config.Current.LoginFailureWindow {
+		failures = 0
+	}
+	failures++
+
+	var lock time.Duration
+	var until interface{}
+	if failures >= limit {
+		lock = config.Current.LoginLockoutMax
+		if exp := failures - limit; exp < 32 {
+			if d := config.Current.LoginLockoutBase << uint(exp); d > 0 && d < config.Current.LoginLockoutMax {
+				lock = d
+			}
+		}
+		until = now.Add(lock)
+	}
+
+	_, err = db.DB.Exec(`INSERT INTO login_throttle (throttle_key, failures, last_failure, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(throttle_key) DO UPDATE SET failures = excluded.failures, last_failure = excluded.last_failure, locked_until = excluded.locked_until`,
+		key, failures, now, until)
+	if err != nil {
+		logger.LogError("Error updating login throttle", err)
+	}
+	return lock
+}
+
+// loginFailed records a failed password or second-factor attempt against
+// the account and the caller's IP, logging any lockout it triggers, and
+// returns the longest lockout.
+func loginFailed(r *http.Request, accountKey string, accountID string, meta audit.Meta) time.Duration {
+	accountLock := recordLoginFailure(accountKey, config.Current.LoginMaxFailures)
+	ipLock := recordLoginFailure(ipThrottleKey(r), config.Current.LoginIPMaxFailures)
+	if accountLock > 0 {
+		audit.Log(r, "", "login_lockout", "user", accountID, withLock(meta, accountLock))
+	}
+	if ipLock > 0 {
+		audit.Log(r, "", "login_lockout", "ip", session.ClientIP(r), withLock(meta, ipLock))
+	}
+	return max(accountLock, ipLock)
+}
+
+func withLock(meta audit.Meta, lock time.Duration) audit.Meta {
+	m := audit.Meta{"locked_for": lock.String()}
+	for k, v := range meta {
+		m[k] = v
+	}
+	return m
+}
+
+func clearLoginFailures(key string) {
+	if _, err := db.DB.Exec("DELETE FROM login_throttle WHERE throttle_key = ?", key); err != nil {
+		logger.LogError("Error clearing login throttle", err)
+	}
+}
+
+func sendLockedOut(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	Senddata(w, 4, fmt.Sprintf("Too many failed login attempts, try again in %s", wait.Round(time.Second)), map[string]int{
+		"retry_after": seconds,
+	})
+}
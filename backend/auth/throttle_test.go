@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+// throttleLimits sets small limits for the duration of a test.
+func throttleLimits(t *testing.T, failures int, base time.Duration, max time.Duration) {
+	t.Helper()
+	previous := config.Current
+	cfg := *previous
+	cfg.LoginMaxFailures, cfg.LoginIPMaxFailures, cfg.LoginLockoutBase, cfg.LoginLockoutMax = failures, 100, base, max
+	config.Current = &cfg
+	t.Cleanup(func() { config.Current = previous })
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	dbtest.Open(t)
+	throttleLimits(t, 3, time.Minute, 4*time.Minute)
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := recordLoginFailure("account:test", config.Current.LoginMaxFailures); got != tt.want {
+			t.Errorf("attempt %d: lockout = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+	if wait := loginRetryAfter("account:other", "account:test"); wait <= 3*time.Minute || wait > 4*time.Minute {
+		t.Errorf("loginRetryAfter = %v, want about 4m", wait)
+	}
+
+	// A lock that ran out long enough ago starts the count again.
+	if _, err := db.DB.Exec("UPDATE login_throttle SET last_failure = ?, locked_until = ? WHERE throttle_key = 'account:test'",
+		time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := recordLoginFailure("account:test", config.Current.LoginMaxFailures); got != 0 {
+		t.Errorf("after the failure window: lockout = %v, want none", got)
+	}
+
+	clearLoginFailures("account:test")
+	if wait := loginRetryAfter("account:test"); wait != 0 {
+		t.Errorf("after clearing: loginRetryAfter = %v, want 0", wait)
+	}
+}
+
+func TestTwoFactorFailuresLockTheAccount(t *testing.T) {
+	dbtest.Open(t)
+	throttleLimits(t, 3, time.Minute, time.Hour)
+	userID := dbtest.User(t, "u-2fa-lock", "locked", "locked@test.local", true)
+	if _, err := db.DB.Exec("UPDATE users SET password = ? WHERE id = ?", Hashpwd("secret12"), userID); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := generateTOTPSecret()
+	if _, err := db.DB.Exec("INSERT INTO two_factor (user_id, secret, enabled, last_used_step, created_at) VALUES (?, ?, 1, 0, ?)",
+		userID, secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return w
+	}
+	guess := func(code string) int {
+		challenge, err := startLoginChallenge(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post(TwoFactorLogin, `{"challenge":"`+challenge+`","code":"`+code+`"}`).Code
+	}
+
+	// Each wrong code counts, and a correct password in between does not
+	// reset the count.
+	tests := []struct {
+		name string
+		step func() int
+		want int
+	}{
+		{"first wrong code", func() int { return guess("000000") }, http.StatusUnauthorized},
+		{"second wrong code", func() int { return guess("000000") }, http.StatusUnauthorized},
+		{"password login", func() int { return post(Login, `{"username":"locked","password":"secret12"}`).Code }, http.StatusOK},
+		{"third wrong code", func() int { return guess("000000") }, http.StatusTooManyRequests},
+		{"password while locked", func() int { return post(Login, `{"username":"locked","password":"secret12"}`).Code }, http.StatusTooManyRequests},
+		{"right code while locked", func() int {
+			key, _ := totpEncoding.DecodeString(secret)
+			return guess(totpCode(key, time.Now().Unix()/totpPeriod))
+		}, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		if got := tt.step(); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	now := time.Now().Unix() / totpPeriod
+	code := func(offset int64) string { return totpCode(key, now+offset) }
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(0), 0, now, true},
+		{"previous step within skew", code(-1), 0, now - 1, true},
+		{"next step within skew", code(1), 0, now + 1, true},
+		{"two steps behind", code(-2), 0, 0, false},
+		{"two steps ahead", code(2), 0, 0, false},
+		{"spaces are ignored", code(0)[:3] + " " + code(0)[3:], 0, now, true},
+		{"wrong length", code(0) + "1", 0, 0, false},
+		{"replay of the last used step", code(0), now, 0, false},
+		{"older step after a newer one was used", code(-1), now, 0, false},
+		{"newer step after an older one was used", code(1), now, now + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := verifyTOTP(secret, tt.code, tt.lastStep)
+			// A step boundary between computing the codes and checking them
+			// shifts the window the expectations were computed for.
+			if ok != tt.wantOK && time.Now().Unix()/totpPeriod != now {
+				t.Skip("crossed a step boundary")
+			}
+			if ok != tt.wantOK || (ok && step != tt.wantStep) {
+				t.Errorf("verifyTOTP = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCheckTOTPRefusesReplay(t *testing.T) {
+	dbtest.Open(t)
+	userID := dbtest.User(t, "u-totp", "totp", "totp@test.local", true)
+	secret, _ := generateTOTPSecret()
+	if _, err := db.DB.Exec("INSERT INTO two_factor (user_id, secret, enabled, last_used_step, created_at) VALUES (?, ?, 1, 0, ?)",
+		userID, secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	code := totpCode(key, time.Now().Unix()/totpPeriod)
+
+	if !checkTOTP(userID, code, true) {
+		t.Fatal("first use of a valid code was refused")
+	}
+	if checkTOTP(userID, code, true) {
+		t.Error("the same code was accepted twice")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	dbtest.Open(t)
+	userID := dbtest.User(t, "u-recovery", "recovery", "recovery@test.local", true)
+	codes, err := replaceRecoveryCodes(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	// Codes hashed with their dashes, as they were before normalization.
+	legacy := "abcd-ef01-2345"
+	if _, err := db.DB.Exec("INSERT INTO recovery_codes (id, user_id, code_hash) VALUES ('rc-legacy', ?, ?)", userID, HashToken(legacy)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"as issued", codes[0], true},
+		{"used twice", codes[0], false},
+		{"without dashes", strings.ReplaceAll(codes[1], "-", ""), true},
+		{"with spaces instead of dashes", strings.ReplaceAll(codes[2], "-", " "), true},
+		{"upper case with surrounding space", "  " + strings.ToUpper(codes[3]) + "\t", true},
+		{"legacy code without dashes", "abcdef012345", true},
+		{"unknown code", "0000-0000-0000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := useRecoveryCode(userID, tt.code); got != tt.want {
+				t.Errorf("useRecoveryCode(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
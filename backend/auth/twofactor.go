@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	recoveryCodeCount   = 10
+	loginChallengeTTL   = 5 * time.Minute
+	loginChallengeTries = 5
+)
+
+func TwoFactorEnabled(userID string) bool {
+	var enabled bool
+	err := db.DB.QueryRow("SELECT enabled FROM two_factor WHERE user_id = ?", userID).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogError("Error checking two-factor status", err)
+	}
+	return enabled
+}
+
+// checkTOTP verifies a code against the user's stored secret and, when it
+// matches, remembers the step so the same code cannot be used twice.
+func checkTOTP(userID string, code string, requireEnabled bool) bool {
+	var secret string
+	var enabled bool
+	var lastStep int64
+	err := db.DB.QueryRow("SELECT secret, enabled, last_used_step FROM two_factor WHERE user_id = ?", userID).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error loading two-factor secret", err)
+		}
+		return false
+	}
+	if requireEnabled && !enabled {
+		return false
+	}
+
+	step, ok := verifyTOTP(secret, code, lastStep)
+	if !ok {
+		return false
+	}
+	res, err := db.DB.Exec("UPDATE two_factor SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+	if err != nil {
+		logger.LogError("Error recording two-factor step", err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+func useRecoveryCode(userID string, code string) bool {
+	code = normalizeRecoveryCode(code)
+	// Codes issued before normalization were hashed in their dashed form.
+	legacy := code
+	if len(code) == 12 {
+		legacy = code[0:4] + "-" + code[4:8] + "-" + code[8:12]
+	}
+	res, err := db.DB.Exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash IN (?, ?) AND used_at IS NULL",
+		time.Now(), userID, HashToken(code), HashToken(legacy))
+	if err != nil {
+		logger.LogError("Error using recovery code", err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+func replaceRecoveryCodes(userID string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		id, _ := uuid.NewV7()
+		if _, err := tx.Exec("INSERT INTO recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)", id, userID, HashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, tx.Commit()
+}
+
+// startLoginChallenge records that the password step succeeded and returns
+// the token the client must send back together with a code.
+func startLoginChallenge(userID string) (string, error) {
+	token, tokenHash, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	id, _ := uuid.NewV7()
+	db.DB.Exec("DELETE FROM login_challenges WHERE user_id = ? OR expires_at <= ?", userID, time.Now())
+	_, err = db.DB.Exec("INSERT INTO login_challenges (id, user_id, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		id, userID, tokenHash, time.Now().Add(loginChallengeTTL))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+	username, _ := session.GetUsernameFromUserID(userID)
+
+	if TwoFactorEnabled(userID) {
+		Senddata(w, 1, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		logger.LogError("Error generating two-factor secret", err)
+		Senddata(w, 3, "Unknown Internal Error, Try again", nil)
+		return
+	}
+	_, err = db.DB.Exec(`INSERT INTO two_factor (user_id, secret, enabled, last_used_step, created_at) VALUES (?, ?, 0, 0, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_used_step = 0, created_at = excluded.created_at`,
+		userID, secret, time.Now())
+	if err != nil {
+		logger.LogError("Error storing two-factor secret", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	Senddata(w, 0, "Scan the code with your authenticator app, then confirm with a code", map[string]string{
+		"secret": secret,
+		"uri":    totpURI(username, secret),
+	})
+}
+
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		Senddata(w, 1, "Code is required", nil)
+		return
+	}
+	if TwoFactorEnabled(userID) {
+		Senddata(w, 1, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !checkTOTP(userID, request.Code, false) {
+		Senddata(w, 2, "Invalid code", nil)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(userID)
+	if err != nil {
+		logger.LogError("Error creating recovery codes", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if _, err := db.DB.Exec("UPDATE two_factor SET enabled = 1 WHERE user_id = ?", userID); err != nil {
+		logger.LogError("Error enabling two-factor", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	log.Println("[EnableTwoFactor] Enabled for user:", userID)
+	audit.Log(r, userID, "two_factor_enabled", "user", userID, nil)
+	Senddata(w, 0, "Two-factor authentication enabled. Store these recovery codes somewhere safe", map[string][]string{
+		"recovery_codes": codes,
+	})
+}
+
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	var request struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Password == "" || request.Code == "" {
+		Senddata(w, 1, "Password and code are required", nil)
+		return
+	}
+	if !TwoFactorEnabled(userID) {
+		Senddata(w, 1, "Two-factor authentication is not enabled", nil)
+		return
+	}
+
+	var pass string
+	if err := db.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&pass); err != nil {
+		logger.LogError("Error fetching password", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if !Validate(pass, request.Password) {
+		Senddata(w, 2, "Invalid password", "Error Password")
+		return
+	}
+	if !checkTOTP(userID, request.Code, true) {
+		Senddata(w, 2, "Invalid code", nil)
+		return
+	}
+
+	db.DB.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	db.DB.Exec("DELETE FROM login_challenges WHERE user_id = ?", userID)
+	if _, err := db.DB.Exec("DELETE FROM two_factor WHERE user_id = ?", userID); err != nil {
+		logger.LogError("Error disabling two-factor", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	log.Println("[DisableTwoFactor] Disabled for user:", userID)
+	audit.Log(r, userID, "two_factor_disabled", "user", userID, nil)
+	Senddata(w, 0, "Two-factor authentication disabled", nil)
+}
+
+// TwoFactorLogin is the second login step. It exchanges the challenge from
+// Login plus a current code or an unused recovery code for the session cookie.
+func TwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Challenge == "" || (request.Code == "" && request.RecoveryCode == "") {
+		Senddata(w, 1, "Challenge and code are required", nil)
+		return
+	}
+
+	var challengeID, userID string
+	var attempts int
+	err := db.DB.QueryRow("SELECT id, user_id, attempts FROM login_challenges WHERE token_hash = ? AND expires_at > ?",
+		HashToken(request.Challenge), time.Now()).Scan(&challengeID, &userID, &attempts)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error loading login challenge", err)
+		}
+		Senddata(w, 2, "Login expired, please sign in again", nil)
+		return
+	}
+	accountKey := "account:" + userID
+	if wait := loginRetryAfter(accountKey, ipThrottleKey(r)); wait > 0 {
+		sendLockedOut(w, wait)
+		return
+	}
+	if attempts >= loginChallengeTries {
+		db.DB.Exec("DELETE FROM login_challenges WHERE id = ?", challengeID)
+		Senddata(w, 2, "Too many attempts, please sign in again", nil)
+		return
+	}
+
+	var valid bool
+	if request.Code != "" {
+		valid = checkTOTP(userID, request.Code, true)
+	} else {
+		valid = useRecoveryCode(userID, request.RecoveryCode)
+	}
+	if !valid {
+		db.DB.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?", challengeID)
+		if lock := loginFailed(r, accountKey, userID, audit.Meta{"method": "two_factor"}); lock > 0 {
+			sendLockedOut(w, lock)
+			return
+		}
+		audit.Log(r, "", "login_failed", "user", userID, audit.Meta{"method": "two_factor"})
+		Senddata(w, 2, "Invalid code", nil)
+		return
+	}
+
+	db.DB.Exec("DELETE FROM login_challenges WHERE id = ?", challengeID)
+	clearLoginFailures(accountKey)
+	if s, suspended := session.UserSuspension(userID); suspended {
+		Senddata(w, 2, suspensionMessage(s), s)
+		return
+	}
+	session.Setsession(w, r, userID)
+	audit.Log(r, userID, "login", "user", userID, audit.Meta{"method": "two_factor"})
+	username, _ := session.GetUsernameFromUserID(userID)
+	log.Println("[TwoFactorLogin] Login successful for user:", username)
+
+	response := map[string]interface{}{
+		"xyz":     username,
+		"message": "Login Success",
+		"status":  0,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
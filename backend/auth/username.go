@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"social-net/audit"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// reservedUsernames cannot be registered because they clash with routes or
+// could be mistaken for staff accounts.
+var reservedUsernames = map[string]bool{
+	"about": true, "account": true, "admin": true, "administrator": true, "api": true,
+	"auth": true, "events": true, "groups": true, "help": true, "login": true,
+	"logout": true, "me": true, "messages": true, "moderator": true, "notifications": true,
+	"null": true, "posts": true, "privacy": true, "profile": true, "register": true,
+	"root": true, "search": true, "security": true, "settings": true, "staff": true,
+	"static": true, "support": true, "system": true, "terms": true, "undefined": true,
+	"uploads": true, "www": true, "ws": true,
+}
+
+var (
+	errUsernameFormat   = errors.New("Username must be 3 to 30 characters: lowercase letters, digits or underscores")
+	errUsernameReserved = errors.New("This username is reserved")
+	errUsernameTaken    = errors.New("This username is already taken")
+)
+
+func NormalizeUsername(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func ValidateUsername(name string) error {
+	if !usernamePattern.MatchString(name) {
+		return errUsernameFormat
+	}
+	if reservedUsernames[name] {
+		return errUsernameReserved
+	}
+	return nil
+}
+
+// usernameAvailable reports whether userID (empty for a new account) may take
+// name. Names still redirecting after a rename stay with their previous
+// owner, who may take them back.
+func usernameAvailable(name string, userID string) (bool, error) {
+	var owner string
+	err := db.DB.QueryRow("SELECT id FROM users WHERE username = ?", name).Scan(&owner)
+	if err == nil {
+		return owner == userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+	err = db.DB.QueryRow("SELECT user_id FROM username_history WHERE old_username = ? AND expires_at > ?", name, time.Now()).Scan(&owner)
+	if err == nil {
+		return owner == userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkUsername validates name and makes sure userID can take it.
+func checkUsername(name string, userID string) error {
+	if err := ValidateUsername(name); err != nil {
+		return err
+	}
+	ok, err := usernameAvailable(name, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errUsernameTaken
+	}
+	return nil
+}
+
+func isUsernameError(err error) bool {
+	return err == errUsernameFormat || err == errUsernameReserved || err == errUsernameTaken
+}
+
+// CheckUsername answers whether ?username= can be registered.
+func CheckUsername(w http.ResponseWriter, r *http.Request) {
+	name := NormalizeUsername(r.URL.Query().Get("username"))
+	response := map[string]interface{}{"username": name, "available": true}
+	if err := checkUsername(name, ""); err != nil {
+		if !isUsernameError(err) {
+			logger.LogError("Error checking username", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response["available"] = false
+		response["reason"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// renameUser moves the account to newName. Tables that store the username
+// instead of the id are updated too, and the old name keeps redirecting for
+// the configured username_redirect_ttl.
+func renameUser(userID string, oldName string, newName string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE users SET username = ? WHERE id = ?", []interface{}{newName, userID}},
+		{"UPDATE posts SET author = ? WHERE user_id = ?", []interface{}{newName, userID}},
+		{"UPDATE comments SET author = ? WHERE author = ?", []interface{}{newName, oldName}},
+		{"UPDATE group_comments SET author = ? WHERE author = ?", []interface{}{newName, oldName}},
+		{"DELETE FROM username_history WHERE old_username = ? OR expires_at <= ?", []interface{}{newName, now}},
+		{"INSERT OR REPLACE INTO username_history (old_username, user_id, renamed_at, expires_at) VALUES (?, ?, ?, ?)",
+			[]interface{}{oldName, userID, now, now.Add(config.Current.UsernameRedirectTTL)}},
+	} {
+		if _, err := tx.Exec(c.query, c.args...); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	session.UsernameChanged(oldName, newName)
+	return nil
+}
+
+// ChangeUsername renames the caller, at most once per configured cooldown.
+func ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		Senddata(w, 1, "Username is required", nil)
+		return
+	}
+	newName := NormalizeUsername(request.Username)
+
+	oldName, ok := session.GetUsernameFromUserID(userID)
+	if !ok {
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if newName == oldName {
+		Senddata(w, 1, "That is already your username", nil)
+		return
+	}
+	if err := checkUsername(newName, userID); err != nil {
+		if !isUsernameError(err) {
+			logger.LogError("Error checking username", err)
+			Senddata(w, 3, "Database error", nil)
+			return
+		}
+		Senddata(w, 1, err.Error(), nil)
+		return
+	}
+
+	var lastRename time.Time
+	err := db.DB.QueryRow("SELECT renamed_at FROM username_history WHERE user_id = ? ORDER BY renamed_at DESC LIMIT 1", userID).Scan(&lastRename)
+	if err == nil && time.Since(lastRename) < config.Current.UsernameChangeCooldown {
+		Senddata(w, 1, "You can change your username again after "+lastRename.Add(config.Current.UsernameChangeCooldown).Format("2006-01-02 15:04"), nil)
+		return
+	}
+
+	if err := renameUser(userID, oldName, newName); err != nil {
+		logger.LogError("Error renaming user", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	audit.Log(r, userID, "username_changed", "user", userID, audit.Meta{"from": oldName, "to": newName})
+	log.Println("[ChangeUsername] Renamed", oldName, "to", newName)
+	Senddata(w, 0, "Username changed", map[string]string{"username": newName, "previous": oldName})
+}
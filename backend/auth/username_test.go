@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"testing"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestRenameUser(t *testing.T) {
+	dbtest.Open(t)
+	renamed := dbtest.User(t, "u-renamed", "before", "before@test.local", true)
+	other := dbtest.User(t, "u-other", "other", "other@test.local", true)
+	dbtest.Exec(t,
+		`INSERT INTO posts (id, user_id, author, title, content, creation_date, status) VALUES
+			('p-renamed', 'u-renamed', 'before', 'Hi', 'Hi', CURRENT_TIMESTAMP, 'public'),
+			('p-other', 'u-other', 'other', 'Hi', 'Hi', CURRENT_TIMESTAMP, 'public')`,
+		`INSERT INTO comments (id, post_id, author, content, creation_date) VALUES
+			('c-renamed', 'p-other', 'before', 'Hi', CURRENT_TIMESTAMP),
+			('c-other', 'p-renamed', 'other', 'Hi', CURRENT_TIMESTAMP)`,
+		"INSERT INTO groups (id, creator_id, title, description) VALUES ('g-rename', 'u-other', 'Group', '')",
+		"INSERT INTO group_posts (id, group_id, user_id, title, content, creation_date) VALUES ('gp-rename', 'g-rename', 'u-other', 'Hi', '', CURRENT_TIMESTAMP)",
+		`INSERT INTO group_comments (id, group_post_id, author, content, creation_date) VALUES
+			('gc-renamed', 'gp-rename', 'before', 'Hi', CURRENT_TIMESTAMP),
+			('gc-other', 'gp-rename', 'other', 'Hi', CURRENT_TIMESTAMP)`,
+	)
+
+	if err := renameUser(renamed, "before", "after"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"account", "SELECT 1 FROM users WHERE id = 'u-renamed' AND username = 'after'", true},
+		{"post author", "SELECT 1 FROM posts WHERE id = 'p-renamed' AND author = 'after'", true},
+		{"comment author", "SELECT 1 FROM comments WHERE id = 'c-renamed' AND author = 'after'", true},
+		{"group comment author", "SELECT 1 FROM group_comments WHERE id = 'gc-renamed' AND author = 'after'", true},
+		{"rows still under the old name", `SELECT 1 FROM posts WHERE author = 'before'
+			UNION ALL SELECT 1 FROM comments WHERE author = 'before'
+			UNION ALL SELECT 1 FROM group_comments WHERE author = 'before'`, false},
+		{"rows of another user", `SELECT 1 FROM posts WHERE id = 'p-other' AND author = 'other'
+			AND EXISTS (SELECT 1 FROM comments WHERE id = 'c-other' AND author = 'other')
+			AND EXISTS (SELECT 1 FROM group_comments WHERE id = 'gc-other' AND author = 'other')`, true},
+		{"redirect", "SELECT 1 FROM username_history WHERE old_username = 'before' AND user_id = 'u-renamed' AND expires_at > CURRENT_TIMESTAMP", true},
+	}
+	for _, tt := range tests {
+		if got := dbtest.Exists(t, tt.query); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	names := []struct {
+		name     string
+		wantUser string
+		wantName string
+	}{
+		{"after", renamed, "after"},
+		{"before", renamed, "after"},
+		{"other", other, "other"},
+	}
+	for _, tt := range names {
+		if userID, err := session.ResolveUsername(tt.name); err != nil || userID != tt.wantUser {
+			t.Errorf("ResolveUsername(%q) = %q, %v, want %q", tt.name, userID, err, tt.wantUser)
+		}
+		if got := session.CurrentUsername(tt.name); got != tt.wantName {
+			t.Errorf("CurrentUsername(%q) = %q, want %q", tt.name, got, tt.wantName)
+		}
+	}
+
+	// The old name stays reserved for its owner while it redirects.
+	if err := checkUsername("before", other); err != errUsernameTaken {
+		t.Errorf("another user taking the old name: err = %v, want %v", err, errUsernameTaken)
+	}
+	if err := checkUsername("before", renamed); err != nil {
+		t.Errorf("owner taking the old name back: err = %v", err)
+	}
+	if err := renameUser(renamed, "after", "before"); err != nil {
+		t.Fatal(err)
+	}
+	if dbtest.Exists(t, "SELECT 1 FROM username_history WHERE old_username = 'before'") {
+		t.Error("the name taken back still redirects")
+	}
+}
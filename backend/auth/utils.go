@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"golang.org/x/crypto/bcrypt"
@@ -20,6 +24,31 @@ func Validate(pswd string, pass string) bool {
 	return err == nil
 }
 
+func ValidatePassword(pswd string) error {
+	if len(pswd) < 6 {
+		return errors.New("password must be at least 6 characters long")
+	}
+	if len(pswd) > 72 {
+		return errors.New("password must not exceed 72 characters")
+	}
+	return nil
+}
+
+// GenerateToken returns a random hex token and the hash to store for it.
+func GenerateToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func Senddata(w http.ResponseWriter, errCode int, mess string, data any) {
 	response := struct {
 		Error   int    `json:"error"`
@@ -44,6 +73,8 @@ func httpStatus(errCode int) int {
 		return http.StatusBadRequest
 	case 2:
 		return http.StatusUnauthorized
+	case 4:
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/mailer"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	verifyTokenTTL = 24 * time.Hour
+	verifyPath     = "/verify-email?token="
+)
+
+// SendVerificationEmail replaces any pending verification for the user with
+// a fresh token and mails it to the given address.
+func SendVerificationEmail(userID string, email string) error {
+	token, tokenHash, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+	verificationID, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if _, err := db.DB.Exec("DELETE FROM email_verifications WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+	_, err = db.DB.Exec("INSERT INTO email_verifications (id, user_id, email, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		verificationID, userID, email, tokenHash, now.Add(verifyTokenTTL), now)
+	if err != nil {
+		return err
+	}
+
+	body := "Welcome! Please confirm your email address by opening the link below:\n" +
+		config.Current.FrontendURL + verifyPath + token + "\n\n" +
+		"The link expires in 24 hours."
+	return mailer.Default.Send(email, "Confirm your email address", body)
+}
+
+func IsVerified(userID string) bool {
+	var verifiedAt sql.NullTime
+	err := db.DB.QueryRow("SELECT verified_at FROM users WHERE id = ?", userID).Scan(&verifiedAt)
+	if err != nil {
+		logger.LogError("Error checking email verification", err)
+		return false
+	}
+	return verifiedAt.Valid
+}
+
+// RequireVerified answers 403 and returns false when the user has not
+// confirmed their email yet.
+func RequireVerified(w http.ResponseWriter, userID string) bool {
+	if IsVerified(userID) {
+		return true
+	}
+	http.Error(w, "Please verify your email address first", http.StatusForbidden)
+	return false
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var request struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		token = request.Token
+	}
+	if token == "" {
+		Senddata(w, 1, "Token is required", nil)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.LogError("Error starting verification transaction", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	defer tx.Rollback()
+
+	var verificationID, userID, email string
+	var expiresAt time.Time
+	err = tx.QueryRow("SELECT id, user_id, email, expires_at FROM email_verifications WHERE token_hash = ? AND used_at IS NULL",
+		HashToken(token)).Scan(&verificationID, &userID, &email, &expiresAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error looking up verification token", err)
+		}
+		Senddata(w, 2, "Invalid verification link", nil)
+		return
+	}
+	if expiresAt.Before(time.Now()) {
+		Senddata(w, 2, "Verification link has expired, request a new one", "expired")
+		return
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE email_verifications SET used_at = ? WHERE id = ?", now, verificationID); err != nil {
+		logger.LogError("Error consuming verification token", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	res, err := tx.Exec("UPDATE users SET verified_at = ? WHERE id = ? AND email = ?", now, userID, email)
+	if err != nil {
+		logger.LogError("Error marking email verified", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		Senddata(w, 2, "This link is for an address no longer on the account", nil)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.LogError("Error committing verification", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+
+	Senddata(w, 0, "Email verified", nil)
+}
+
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+
+	if IsVerified(userID) {
+		Senddata(w, 1, "Email is already verified", nil)
+		return
+	}
+
+	var email string
+	err := db.DB.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email)
+	if err != nil {
+		logger.LogError("Error fetching user email", err)
+		Senddata(w, 3, "Database error", nil)
+		return
+	}
+	var lastSent time.Time
+	err = db.DB.QueryRow("SELECT created_at FROM email_verifications WHERE user_id = ? ORDER BY created_at DESC LIMIT 1", userID).Scan(&lastSent)
+	if err == nil && time.Since(lastSent) < time.Minute {
+		Senddata(w, 1, "Please wait a minute before requesting another email", nil)
+		return
+	}
+
+	if err := SendVerificationEmail(userID, email); err != nil {
+		logger.LogError("Error sending verification email", err)
+		Senddata(w, 3, "Failed to send verification email", nil)
+		return
+	}
+	Senddata(w, 0, "Verification email sent", nil)
+}
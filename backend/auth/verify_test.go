@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+func TestRequireVerified(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.User(t, "u-verified", "verified", "verified@test.local", true)
+	dbtest.User(t, "u-unverified", "unverified", "unverified@test.local", false)
+
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"u-verified", true},
+		{"u-unverified", false},
+		{"u-missing", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		if got := RequireVerified(w, tt.user); got != tt.want {
+			t.Errorf("%s: RequireVerified = %v, want %v", tt.user, got, tt.want)
+		}
+		if !tt.want && w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", tt.user, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	dbtest.Open(t)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		email   string
+		expires time.Time
+		used    bool
+		// sent is the token in the link, the stored one unless set.
+		sent         string
+		wantStatus   int
+		wantVerified bool
+	}{
+		{"valid link", "", now.Add(time.Hour), false, "", http.StatusOK, true},
+		{"expired link", "", now.Add(-time.Minute), false, "", http.StatusUnauthorized, false},
+		{"used link", "", now.Add(time.Hour), true, "", http.StatusUnauthorized, false},
+		{"unknown link", "", now.Add(time.Hour), false, "not-a-token", http.StatusUnauthorized, false},
+		{"address changed since", "old@test.local", now.Add(time.Hour), false, "", http.StatusUnauthorized, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix := string(rune('a' + i))
+			userID := dbtest.User(t, "u-verify-"+suffix, "verify"+suffix, "verify"+suffix+"@test.local", false)
+			email := tt.email
+			if email == "" {
+				email = "verify" + suffix + "@test.local"
+			}
+			token, tokenHash, err := GenerateToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var usedAt interface{}
+			if tt.used {
+				usedAt = now.Add(-time.Minute)
+			}
+			if _, err := db.DB.Exec("INSERT INTO email_verifications (id, user_id, email, token_hash, expires_at, used_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				"ev-"+suffix, userID, email, tokenHash, tt.expires, usedAt, now); err != nil {
+				t.Fatal(err)
+			}
+			if tt.sent != "" {
+				token = tt.sent
+			}
+
+			w := httptest.NewRecorder()
+			VerifyEmail(w, httptest.NewRequest(http.MethodGet, "/api/auth/verify?token="+token, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := IsVerified(userID); got != tt.wantVerified {
+				t.Errorf("verified = %v, want %v", got, tt.wantVerified)
+			}
+			if !tt.wantVerified {
+				return
+			}
+
+			// The link only works once.
+			w = httptest.NewRecorder()
+			VerifyEmail(w, httptest.NewRequest(http.MethodGet, "/api/auth/verify?token="+token, nil))
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("second use: status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package bookmarks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/groups"
+	logger "social-net/log"
+	"social-net/posts"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+// Bookmark is a saved post or group post. Items the user can no longer see
+// stay stored but are left out of listings until they are visible again.
+type Bookmark struct {
+	ID         string    `json:"id"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	GroupID    string    `json:"group_id,omitempty"`
+	Collection string    `json:"collection"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Author     string    `json:"author"`
+	Image      string    `json:"image"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Collection struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// visible is the condition on the bookmarks row aliased b selecting the
+// items userID can still see, the SQL form of posts.CheckUserPostPermission
+// and group membership.
+func visible(userID string) (string, []interface{}) {
+	postVisible, args := posts.VisibleTo(userID)
+	memberOf, groupArgs := groups.MemberGroups(userID)
+	return `((b.target_type = 'post' AND b.target_id IN (SELECT p.id FROM posts p WHERE ` + postVisible + `))
+		OR (b.target_type = 'group_post' AND b.target_id IN (SELECT id FROM group_posts WHERE group_id IN (` + memberOf + `))))`,
+		append(args, groupArgs...)
+}
+
+// canSee reports whether userID may see, and so bookmark, the target.
+func canSee(userID string, targetType string, targetID string) bool {
+	switch targetType {
+	case "post":
+		return posts.CheckUserPostPermission(userID, targetID)
+	case "group_post":
+		memberOf, args := groups.MemberGroups(userID)
+		var ok bool
+		err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM group_posts WHERE id = ? AND group_id IN ("+memberOf+"))",
+			append([]interface{}{targetID}, args...)...).Scan(&ok)
+		return err == nil && ok
+	}
+	return false
+}
+
+func setHeaders(w http.ResponseWriter, r *http.Request, methods string) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", methods+", OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+}
+
+// collectionID returns the id of the caller's collection called name,
+// creating it if needed, or nil for no collection.
+func collectionID(userID string, name string) (interface{}, error) {
+	if name == "" {
+		return nil, nil
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.DB.Exec("INSERT OR IGNORE INTO bookmark_collections (id, user_id, name, created_at) VALUES (?, ?, ?, ?)",
+		id.String(), userID, name, time.Now()); err != nil {
+		return nil, err
+	}
+	var existing string
+	err = db.DB.QueryRow("SELECT id FROM bookmark_collections WHERE user_id = ? AND name = ?", userID, name).Scan(&existing)
+	return existing, err
+}
+
+// checkCollectionName trims a collection name and returns the error message
+// for an invalid one, or "".
+func checkCollectionName(name *string) string {
+	*name = strings.TrimSpace(*name)
+	if len(*name) > 50 {
+		return "Collection name must not exceed 50 characters"
+	}
+	return ""
+}
+
+// AddBookmark saves {target_type, target_id} for the caller, in the
+// collection named {collection} if given. Saving an item again moves it to
+// that collection.
+func AddBookmark(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		TargetType string `json:"target_type"`
+		TargetID   string `json:"target_id"`
+		Collection string `json:"collection"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.TargetID == "" {
+		http.Error(w, "target_type and target_id are required", http.StatusBadRequest)
+		return
+	}
+	if request.TargetType != "post" && request.TargetType != "group_post" {
+		http.Error(w, "Unknown target type", http.StatusBadRequest)
+		return
+	}
+	if msg := checkCollectionName(&request.Collection); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+	if !canSee(userID, request.TargetType, request.TargetID) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	collection, err := collectionID(userID, request.Collection)
+	if err != nil {
+		logger.LogError("Error saving bookmark collection", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		http.Error(w, "Failed to generate bookmark ID", http.StatusInternalServerError)
+		return
+	}
+	_, err = db.DB.Exec(`INSERT INTO bookmarks (id, user_id, target_type, target_id, collection_id, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, target_type, target_id) DO UPDATE SET collection_id = excluded.collection_id`,
+		id.String(), userID, request.TargetType, request.TargetID, collection, time.Now())
+	if err != nil {
+		logger.LogError("Error saving bookmark", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bookmark saved"})
+}
+
+// RemoveBookmark deletes the caller's bookmark of {target_type, target_id}.
+func RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		TargetType string `json:"target_type"`
+		TargetID   string `json:"target_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.TargetID == "" {
+		http.Error(w, "target_type and target_id are required", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.DB.Exec("DELETE FROM bookmarks WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		session.CurrentUserID(r), request.TargetType, request.TargetID)
+	if err != nil {
+		logger.LogError("Error removing bookmark", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Bookmark not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bookmark removed"})
+}
+
+// ListBookmarks pages through the caller's visible bookmarks, newest first.
+// ?collection= keeps one collection by name, or the uncollected items when
+// set to "-"; ?limit= sets the page size and ?cursor= continues after the
+// next_cursor of the previous page.
+func ListBookmarks(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "GET")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	userID := session.CurrentUserID(r)
+	cond, args := visible(userID)
+	where := " WHERE b.user_id = ? AND " + cond
+	args = append([]interface{}{userID}, args...)
+	switch name := q.Get("collection"); name {
+	case "":
+	case "-":
+		where += " AND b.collection_id IS NULL"
+	default:
+		where += " AND c.name = ?"
+		args = append(args, name)
+	}
+	// Bookmark ids are UUIDv7, so they sort by creation time.
+	if cursor := q.Get("cursor"); cursor != "" {
+		where += " AND b.id < ?"
+		args = append(args, cursor)
+	}
+
+	rows, err := db.DB.Query(`SELECT b.id, b.target_type, b.target_id, COALESCE(gp.group_id, ''), COALESCE(c.name, ''),
+		COALESCE(p.title, gp.title, ''), COALESCE(p.content, gp.content, ''), COALESCE(p.author, u.username, ''),
+		COALESCE(p.image, gp.image, ''), b.created_at
+		FROM bookmarks b
+		LEFT JOIN bookmark_collections c ON c.id = b.collection_id
+		LEFT JOIN posts p ON b.target_type = 'post' AND p.id = b.target_id
+		LEFT JOIN group_posts gp ON b.target_type = 'group_post' AND gp.id = b.target_id
+		LEFT JOIN users u ON u.id = gp.user_id`+where+`
+		ORDER BY b.id DESC LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		logger.LogError("Error listing bookmarks", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.TargetType, &b.TargetID, &b.GroupID, &b.Collection,
+			&b.Title, &b.Content, &b.Author, &b.Image, &b.CreatedAt); err != nil {
+			logger.LogError("Error scanning bookmark", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if b.Image != "" {
+			b.Image = config.Current.UploadURL(b.Image)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+
+	nextCursor := ""
+	if len(bookmarks) > limit {
+		bookmarks = bookmarks[:limit]
+		nextCursor = bookmarks[limit-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bookmarks":   bookmarks,
+		"next_cursor": nextCursor,
+	})
+}
+
+// Collections lists the caller's collections with the number of visible
+// items in each on GET, and creates one from {name} on POST.
+func Collections(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "GET, POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	userID := session.CurrentUserID(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		cond, args := visible(userID)
+		rows, err := db.DB.Query(`SELECT c.id, c.name, c.created_at,
+			(SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = c.id AND `+cond+`)
+			FROM bookmark_collections c WHERE c.user_id = ? ORDER BY c.name`, append(args, userID)...)
+		if err != nil {
+			logger.LogError("Error listing bookmark collections", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		collections := []Collection{}
+		for rows.Next() {
+			var c Collection
+			if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt, &c.Count); err != nil {
+				logger.LogError("Error scanning bookmark collection", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			collections = append(collections, c)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(collections)
+
+	case http.MethodPost:
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if msg := checkCollectionName(&request.Name); msg != "" || request.Name == "" {
+			if msg == "" {
+				msg = "name is required"
+			}
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		id, err := collectionID(userID, request.Name)
+		if err != nil {
+			logger.LogError("Error creating bookmark collection", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "name": request.Name})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DeleteCollection removes the caller's collection {id}. Its bookmarks are
+// kept, outside any collection.
+func DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w, r, "POST")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ID == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+	err := deleteCollection(userID, request.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		logger.LogError("Error deleting bookmark collection", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Collection deleted"})
+}
+
+func deleteCollection(userID string, id string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM bookmark_collections WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("UPDATE bookmarks SET collection_id = NULL WHERE collection_id = ? AND user_id = ?", id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,100 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestBookmarksOfHiddenPosts(t *testing.T) {
+	dbtest.Open(t)
+	reader := dbtest.User(t, "u-reader", "reader", "reader@test.local", true)
+	dbtest.User(t, "u-author", "author", "author@test.local", true)
+	dbtest.Exec(t,
+		"INSERT INTO Followers (id, follower_id, followed_id, status) VALUES ('f-reader', 'u-reader', 'u-author', 'accepted')",
+		`INSERT INTO posts (id, user_id, author, title, content, creation_date, status) VALUES
+			('p-public', 'u-author', 'author', 'Public', 'Public', CURRENT_TIMESTAMP, 'public'),
+			('p-private', 'u-author', 'author', 'Followers', 'Followers', CURRENT_TIMESTAMP, 'private'),
+			('p-semi', 'u-author', 'author', 'Chosen', 'Chosen', CURRENT_TIMESTAMP, 'semi-private'),
+			('p-hidden', 'u-author', 'author', 'Not for the reader', 'Not for the reader', CURRENT_TIMESTAMP, 'semi-private')`,
+		"INSERT INTO postsPrivacy (id, post_id, user_id) VALUES ('pp-reader', 'p-semi', 'u-reader')",
+		"INSERT INTO groups (id, creator_id, title, description) VALUES ('g-test', 'u-author', 'Club', '')",
+		"INSERT INTO group_members (group_id, user_id, status, is_admin) VALUES ('g-test', 'u-author', 'accepted', 1), ('g-test', 'u-reader', 'accepted', 0)",
+		"INSERT INTO group_posts (id, group_id, user_id, title, content, creation_date) VALUES ('gp-club', 'g-test', 'u-author', 'Club news', '', CURRENT_TIMESTAMP)",
+	)
+
+	saves := []struct {
+		targetType string
+		targetID   string
+		want       int
+	}{
+		{"post", "p-public", http.StatusOK},
+		{"post", "p-private", http.StatusOK},
+		{"post", "p-semi", http.StatusOK},
+		{"group_post", "gp-club", http.StatusOK},
+		{"post", "p-hidden", http.StatusNotFound},
+	}
+	for _, s := range saves {
+		w := httptest.NewRecorder()
+		body := `{"target_type": "` + s.targetType + `", "target_id": "` + s.targetID + `", "collection": "Saved"}`
+		session.RequireAuth(AddBookmark)(w, dbtest.SignedIn(t, http.MethodPost, "/api/bookmarks", strings.NewReader(body), reader))
+		if w.Code != s.want {
+			t.Errorf("saving %s: status = %d, want %d: %s", s.targetID, w.Code, s.want, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change string
+		want   string
+	}{
+		{"everything visible", "", "gp-club,p-private,p-public,p-semi"},
+		{"unfollowed the author", "DELETE FROM Followers WHERE id = 'f-reader'", "gp-club,p-public,p-semi"},
+		{"removed from the audience", "DELETE FROM postsPrivacy WHERE id = 'pp-reader'", "gp-club,p-public"},
+		{"left the group", "DELETE FROM group_members WHERE group_id = 'g-test' AND user_id = 'u-reader'", "p-public"},
+		{"followed again", "INSERT INTO Followers (id, follower_id, followed_id, status) VALUES ('f-again', 'u-reader', 'u-author', 'accepted')", "p-private,p-public"},
+	}
+	for _, tt := range tests {
+		if tt.change != "" {
+			dbtest.Exec(t, tt.change)
+		}
+
+		w := httptest.NewRecorder()
+		session.RequireAuth(ListBookmarks)(w, dbtest.SignedIn(t, http.MethodGet, "/api/bookmarks", nil, reader))
+		var page struct {
+			Bookmarks []Bookmark `json:"bookmarks"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatalf("%s: status %d: %v", tt.name, w.Code, err)
+		}
+		var ids []string
+		for _, b := range page.Bookmarks {
+			ids = append(ids, b.TargetID)
+		}
+		sort.Strings(ids)
+		if got := strings.Join(ids, ","); got != tt.want {
+			t.Errorf("%s: bookmarks = %q, want %q", tt.name, got, tt.want)
+		}
+
+		w = httptest.NewRecorder()
+		session.RequireAuth(Collections)(w, dbtest.SignedIn(t, http.MethodGet, "/api/bookmarks/collections", nil, reader))
+		var collections []Collection
+		if err := json.NewDecoder(w.Body).Decode(&collections); err != nil || len(collections) != 1 {
+			t.Fatalf("%s: collections = %+v, %v", tt.name, collections, err)
+		}
+		if collections[0].Count != len(ids) {
+			t.Errorf("%s: collection counts %d items, want %d", tt.name, collections[0].Count, len(ids))
+		}
+	}
+
+	// Hidden bookmarks are kept for when the post is visible again.
+	if !dbtest.Exists(t, "SELECT 1 FROM bookmarks WHERE user_id = 'u-reader' AND target_id IN ('p-semi', 'gp-club') GROUP BY user_id HAVING COUNT(*) = 2") {
+		t.Error("hidden bookmarks were deleted")
+	}
+}
@@ -10,34 +10,40 @@ import (
 	"path/filepath"
 	"time"
 
+	"social-net/auth"
+	"social-net/config"
 	"social-net/db"
 	"social-net/posts"
+	"social-net/reactions"
 	"social-net/session"
+	"social-net/tags"
 
 	"github.com/gofrs/uuid"
 )
 
 type Comments struct {
+	ID            string `json:"id"`
 	PostId        string
-	Comment       string    `json:"comment"`
-	Author        string    `json:"author"`
-	Avatar        string    `json:"avatar"`
-	Image         string    `json:"image"`
-	Creation_date time.Time `json:"creation_date"`
+	Comment       string            `json:"comment"`
+	Author        string            `json:"author"`
+	Avatar        string            `json:"avatar"`
+	Image         string            `json:"image"`
+	Creation_date time.Time         `json:"creation_date"`
+	Reactions     reactions.Summary `json:"reactions"`
 }
 
 func AddComments(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 	if r.Method == "POST" {
 
-		err := r.ParseMultipartForm(10 << 20)
+		err := r.ParseMultipartForm(config.Current.MaxRequestSize)
 		if err != nil {
 			http.Error(w, "Failed to parse form", http.StatusBadRequest)
 			fmt.Println("Failed to parse form:", err)
@@ -62,24 +68,16 @@ func AddComments(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		token, err1 := r.Cookie("token")
-		if err1 != nil {
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-			return
-		}
-		tokenn := token.Value
-		userid, ok := session.GetUserIDFromToken(tokenn)
-		if !ok || userid == "" {
-			fmt.Println("Unauthorized: Invalid token:", err)
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-			return
-		}
+		userid := session.CurrentUserID(r)
 		username, _ := session.GetUsernameFromUserID(userid)
 
-		if userid == "" || username == "" || tokenn == "" {
+		if username == "" {
 			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
 			return
 		}
+		if !auth.RequireVerified(w, userid) {
+			return
+		}
 
 		allowed := posts.CheckUserPostPermission(userid, postId)
 		if !allowed {
@@ -103,7 +101,7 @@ func AddComments(w http.ResponseWriter, r *http.Request) {
 		if err == nil && file != nil {
 			defer file.Close()
 
-			if handler.Size > 2*1024*1024 {
+			if handler.Size > config.Current.MaxImageSize {
 				http.Error(w, "image file too large", http.StatusBadRequest)
 				return
 			}
@@ -129,7 +127,7 @@ func AddComments(w http.ResponseWriter, r *http.Request) {
 			ext := filepath.Ext(handler.Filename)
 			safeFilename := fmt.Sprintf("%s_%d%s", username, time.Now().Unix(), ext)
 
-			path := "./uploads"
+			path := config.Current.UploadsDir
 			_, err := os.Stat(path)
 			if os.IsNotExist(err) {
 				os.MkdirAll(path, os.ModePerm)
@@ -159,6 +157,7 @@ func AddComments(w http.ResponseWriter, r *http.Request) {
 			fmt.Println("Failed to insert comment:", err)
 			return
 		}
+		tags.Index("comment", commentID.String(), userid, comment.Comment)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -180,26 +179,15 @@ func CheckPostExists(postid string) bool {
 }
 
 func Getcomments(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	token, _err := r.Cookie("token")
-	if _err != nil {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-
-		return
-	}
-	tokenn := token.Value
-	userid, ok := session.GetUserIDFromToken(tokenn)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userid := session.CurrentUserID(r)
 	qu := r.URL.Query()
 	postid := qu.Get("post_id")
 	fmt.Println("postid", postid)
@@ -218,7 +206,7 @@ func Getcomments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := db.DB.Query(`
-	SELECT c.post_id, c.content, c.author, u.avatar, c.image, c.creation_date
+	SELECT c.id, c.post_id, c.content, c.author, u.avatar, c.image, c.creation_date
 	FROM comments c
 	LEFT JOIN users u ON c.author = u.username
 	WHERE c.post_id = ?
@@ -233,7 +221,7 @@ func Getcomments(w http.ResponseWriter, r *http.Request) {
 	var comments []Comments
 	for rows.Next() {
 		var comment Comments
-		err := rows.Scan(&comment.PostId, &comment.Comment, &comment.Author, &comment.Avatar, &comment.Image, &comment.Creation_date)
+		err := rows.Scan(&comment.ID, &comment.PostId, &comment.Comment, &comment.Author, &comment.Avatar, &comment.Image, &comment.Creation_date)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			fmt.Println("Failed to scan comment:", err)
@@ -241,5 +229,14 @@ func Getcomments(w http.ResponseWriter, r *http.Request) {
 		}
 		comments = append(comments, comment)
 	}
+
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	summaries := reactions.LoadOrEmpty("comment", ids, userid)
+	for i := range comments {
+		comments[i].Reactions = summaries.For(comments[i].ID)
+	}
 	json.NewEncoder(w).Encode(comments)
 }
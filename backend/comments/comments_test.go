@@ -0,0 +1,35 @@
+package comments
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestCommentingRequiresVerifiedEmail(t *testing.T) {
+	dbtest.Open(t)
+	verified := dbtest.User(t, "u-verified", "verified", "verified@test.local", true)
+	unverified := dbtest.User(t, "u-unverified", "unverified", "unverified@test.local", false)
+	dbtest.Exec(t, "INSERT INTO posts (id, user_id, author, title, content, creation_date, status) VALUES ('p-open', 'u-verified', 'verified', 'Hi', 'Hi', CURRENT_TIMESTAMP, 'public')")
+
+	tests := []struct {
+		user string
+		want int
+	}{
+		{unverified, http.StatusForbidden},
+		{verified, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		session.RequireAuth(AddComments)(w, dbtest.SignedInForm(t, "/api/comments", map[string]string{"post_id": "p-open", "comment": "By " + tt.user}, tt.user))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.user, w.Code, tt.want, w.Body)
+		}
+		if got := dbtest.Exists(t, "SELECT 1 FROM comments WHERE content = 'By "+tt.user+"'"); got != (tt.want == http.StatusOK) {
+			t.Errorf("%s: stored = %v", tt.user, got)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package comments
+
+import (
+	"database/sql"
+
+	"social-net/db"
+	"social-net/utils"
+)
+
+// RemoveComment deletes a comment with its reactions, hashtags and
+// mentions, then its image. It returns sql.ErrNoRows for an unknown comment.
+func RemoveComment(commentID string) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE id = ?)", commentID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	files, err := utils.UploadNames("SELECT image FROM comments WHERE id = ?", commentID)
+	if err != nil {
+		return err
+	}
+	err = utils.ExecAll(append(utils.TargetCleanup("comment", "?"),
+		"DELETE FROM comments WHERE id = ?",
+	), commentID)
+	if err != nil {
+		return err
+	}
+	utils.RemoveUploads(files)
+	return nil
+}
@@ -0,0 +1,45 @@
+package comments
+
+import (
+	"database/sql"
+	"testing"
+
+	"social-net/db/dbtest"
+)
+
+func TestRemoveComment(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.User(t, "u-owner", "owner", "owner@test.local", true)
+	dbtest.Exec(t,
+		"INSERT INTO posts (id, user_id, author, title, content, creation_date, status) VALUES ('p-commented', 'u-owner', 'owner', 'Post', '', CURRENT_TIMESTAMP, 'public')",
+		"INSERT INTO comments (id, post_id, author, content, creation_date) VALUES ('c-removed', 'p-commented', 'owner', 'Hi #tag', CURRENT_TIMESTAMP), ('c-kept', 'p-commented', 'owner', 'Hi', CURRENT_TIMESTAMP)",
+		"INSERT INTO reactions (id, target_type, target_id, user_id, reaction, created_at) VALUES ('r-removed', 'comment', 'c-removed', 'u-owner', 'like', CURRENT_TIMESTAMP), ('r-kept', 'comment', 'c-kept', 'u-owner', 'like', CURRENT_TIMESTAMP)",
+		"INSERT INTO hashtags (target_type, target_id, tag, created_at) VALUES ('comment', 'c-removed', 'tag', CURRENT_TIMESTAMP)",
+		"INSERT INTO bookmarks (id, user_id, target_type, target_id, created_at) VALUES ('b-removed', 'u-owner', 'comment', 'c-removed', CURRENT_TIMESTAMP)",
+	)
+
+	if err := RemoveComment("c-removed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveComment("c-removed"); err != sql.ErrNoRows {
+		t.Errorf("removing again: err = %v, want sql.ErrNoRows", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"comment", "SELECT 1 FROM comments WHERE id = 'c-removed'", false},
+		{"its reactions", "SELECT 1 FROM reactions WHERE id = 'r-removed'", false},
+		{"its hashtags", "SELECT 1 FROM hashtags WHERE target_id = 'c-removed'", false},
+		{"its bookmarks", "SELECT 1 FROM bookmarks WHERE id = 'b-removed'", false},
+		{"other comment", "SELECT 1 FROM comments WHERE id = 'c-kept'", true},
+		{"reactions on the other comment", "SELECT 1 FROM reactions WHERE id = 'r-kept'", true},
+	}
+	for _, tt := range tests {
+		if got := dbtest.Exists(t, tt.query); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package comments
+
+import (
+	"social-net/db"
+	"social-net/posts"
+	"social-net/reactions"
+	"social-net/session"
+)
+
+// Comments store their author's username; reactions need the id.
+func init() {
+	reactions.RegisterTarget("comment", reactions.Target{
+		Noun: "comment",
+		Author: func(id string) (string, error) {
+			var author string
+			if err := db.DB.QueryRow("SELECT author FROM comments WHERE id = ?", id).Scan(&author); err != nil {
+				return "", err
+			}
+			return session.GetUserIDFromUsername(author)
+		},
+		CanSee: func(userID string, id string) bool {
+			var postID string
+			if err := db.DB.QueryRow("SELECT post_id FROM comments WHERE id = ?", id).Scan(&postID); err != nil {
+				return false
+			}
+			return posts.CheckUserPostPermission(userID, postID)
+		},
+	})
+}
@@ -0,0 +1,14 @@
+package comments
+
+import (
+	"social-net/posts"
+	"social-net/search"
+)
+
+// Comments are visible with the post they belong to.
+func init() {
+	search.RegisterType("comment", func(userID string) (string, []interface{}) {
+		visible, args := posts.VisibleTo(userID)
+		return "d.parent_id IN (SELECT p.id FROM posts p WHERE " + visible + ")", args
+	})
+}
@@ -0,0 +1,25 @@
+package comments
+
+import (
+	"social-net/db"
+	"social-net/posts"
+	"social-net/tags"
+)
+
+func init() {
+	tags.RegisterTarget("comment", tags.Target{
+		Noun: "comment",
+		CanSee: func(userID string, id string) bool {
+			var postID string
+			if err := db.DB.QueryRow("SELECT post_id FROM comments WHERE id = ?", id).Scan(&postID); err != nil {
+				return false
+			}
+			return posts.CheckUserPostPermission(userID, postID)
+		},
+		Preview: func(id string) (tags.Preview, error) {
+			var p tags.Preview
+			err := db.DB.QueryRow("SELECT post_id, content FROM comments WHERE id = ?", id).Scan(&p.ParentID, &p.Text)
+			return p, err
+		},
+	})
+}
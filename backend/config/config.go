@@ -0,0 +1,457 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the deployment settings of the backend. Values come from, in
+// increasing priority: the defaults below, a JSON file, environment
+// variables and command line flags.
+type Config struct {
+	Port          int
+	DBPath        string
+	MigrationsDir string
+	UploadsDir    string
+	// UploadsURL is the public prefix of uploaded files, with a trailing slash.
+	UploadsURL  string
+	ExportsDir  string
+	FrontendURL string
+	CORSOrigins []string
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header is believed.
+	TrustedProxies []string
+	trustedNets    []*net.IPNet
+
+	SessionIdleTimeout     time.Duration
+	SessionAbsoluteTimeout time.Duration
+	SessionRotateAfter     time.Duration
+	// SessionRotationGrace is how long a replaced session token keeps working.
+	SessionRotationGrace time.Duration
+	SessionSweepInterval time.Duration
+	CookieSecure         bool
+
+	MaxRequestSize int64
+	MaxImageSize   int64
+
+	// Login throttling: after LoginMaxFailures failures for an account (or
+	// LoginIPMaxFailures for an IP) it is locked for LoginLockoutBase, doubled
+	// on every further failure up to LoginLockoutMax. Counters reset after
+	// LoginFailureWindow without failures.
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginLockoutBase   time.Duration
+	LoginLockoutMax    time.Duration
+	LoginFailureWindow time.Duration
+
+	AccountDeletionGrace         time.Duration
+	AccountDeletionSweepInterval time.Duration
+	UsernameChangeCooldown       time.Duration
+	UsernameRedirectTTL          time.Duration
+	ExportTTL                    time.Duration
+	ExportSweepInterval          time.Duration
+
+	// Mail goes out through SMTP when SMTPHost is set and is only logged
+	// otherwise.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// AdminUsers are promoted to admin at startup, by username or email.
+	AdminUsers []string
+	// OIDCConfig is the JSON file listing the OpenID Connect providers.
+	OIDCConfig string
+}
+
+func Default() *Config {
+	return &Config{
+		Port:                   8080,
+		DBPath:                 "./db/db.db",
+		MigrationsDir:          "db/migrations/sqlite3",
+		UploadsDir:             "./uploads",
+		UploadsURL:             "http://localhost:8080/uploads/",
+		ExportsDir:             "./exports",
+		FrontendURL:            "http://localhost:8081",
+		CORSOrigins:            []string{"http://localhost:8081"},
+		SessionIdleTimeout:     2 * time.Hour,
+		SessionAbsoluteTimeout: 7 * 24 * time.Hour,
+		SessionRotateAfter:     15 * time.Minute,
+		SessionRotationGrace:   time.Minute,
+		SessionSweepInterval:   10 * time.Minute,
+		MaxRequestSize:         10 << 20,
+		MaxImageSize:           2 << 20,
+
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginLockoutBase:   time.Minute,
+		LoginLockoutMax:    time.Hour,
+		LoginFailureWindow: 15 * time.Minute,
+
+		AccountDeletionGrace:         7 * 24 * time.Hour,
+		AccountDeletionSweepInterval: time.Hour,
+		UsernameChangeCooldown:       7 * 24 * time.Hour,
+		UsernameRedirectTTL:          30 * 24 * time.Hour,
+		ExportTTL:                    7 * 24 * time.Hour,
+		ExportSweepInterval:          time.Hour,
+
+		SMTPPort: 25,
+		SMTPFrom: "no-reply@social-network.local",
+
+		OIDCConfig: "oidc.json",
+	}
+}
+
+// Current is the configuration in use. It holds the defaults until main
+// calls Load.
+var Current = Default()
+
+// option ties a setting to its file key, environment variable and flag. The
+// flag name is the file key with dashes.
+type option struct {
+	key   string
+	env   string
+	usage string
+}
+
+var options = []option{
+	{"port", "PORT", "HTTP port to listen on"},
+	{"db_path", "DB_PATH", "SQLite database file"},
+	{"migrations_dir", "MIGRATIONS_DIR", "directory of the SQL migrations"},
+	{"uploads_dir", "UPLOADS_DIR", "directory where uploaded files are stored"},
+	{"uploads_url", "UPLOADS_URL", "public URL prefix of uploaded files"},
+	{"exports_dir", "EXPORTS_DIR", "directory where data exports are built"},
+	{"frontend_url", "FRONTEND_URL", "base URL of the frontend, used in links and redirects"},
+	{"cors_origins", "CORS_ORIGINS", "comma separated origins allowed to call the API"},
+	{"trusted_proxies", "TRUSTED_PROXIES", "comma separated proxy addresses or CIDR ranges allowed to set X-Forwarded-For"},
+	{"session_idle_timeout", "SESSION_IDLE_TIMEOUT", "session lifetime without activity"},
+	{"session_absolute_timeout", "SESSION_ABSOLUTE_TIMEOUT", "maximum session lifetime"},
+	{"session_rotate_after", "SESSION_ROTATE_AFTER", "age after which session tokens are rotated"},
+	{"session_rotation_grace", "SESSION_ROTATION_GRACE", "how long a replaced session token keeps working"},
+	{"session_sweep_interval", "SESSION_SWEEP_INTERVAL", "how often expired sessions are removed"},
+	{"cookie_secure", "COOKIE_SECURE", "mark cookies Secure, for HTTPS deployments"},
+	{"max_request_size", "MAX_REQUEST_SIZE", "maximum size in bytes of multipart requests"},
+	{"max_image_size", "MAX_IMAGE_SIZE", "maximum size in bytes of an uploaded image"},
+	{"login_max_failures", "LOGIN_MAX_FAILURES", "failed logins before an account is locked"},
+	{"login_ip_max_failures", "LOGIN_IP_MAX_FAILURES", "failed logins before an IP is locked"},
+	{"login_lockout_base", "LOGIN_LOCKOUT_BASE", "first lockout after too many failed logins"},
+	{"login_lockout_max", "LOGIN_LOCKOUT_MAX", "longest lockout after failed logins"},
+	{"login_failure_window", "LOGIN_FAILURE_WINDOW", "quiet time after which failed logins are forgotten"},
+	{"account_deletion_grace", "ACCOUNT_DELETION_GRACE", "time before a deleted account is removed for good"},
+	{"account_deletion_sweep_interval", "ACCOUNT_DELETION_SWEEP_INTERVAL", "how often deleted accounts are removed"},
+	{"username_change_cooldown", "USERNAME_CHANGE_COOLDOWN", "minimum time between two username changes"},
+	{"username_redirect_ttl", "USERNAME_REDIRECT_TTL", "how long an old username points at its account"},
+	{"export_ttl", "EXPORT_TTL", "how long data export archives are kept"},
+	{"export_sweep_interval", "EXPORT_SWEEP_INTERVAL", "how often expired data exports are removed"},
+	{"smtp_host", "SMTP_HOST", "SMTP server for outgoing mail; mail is only logged when empty"},
+	{"smtp_port", "SMTP_PORT", "SMTP server port"},
+	{"smtp_username", "SMTP_USERNAME", "SMTP login"},
+	{"smtp_password", "SMTP_PASSWORD", "SMTP password"},
+	{"smtp_from", "SMTP_FROM", "sender address of outgoing mail"},
+	{"admin_users", "ADMIN_USERS", "comma separated usernames or emails promoted to admin at startup"},
+	{"oidc_config", "OIDC_CONFIG", "JSON file listing the OpenID Connect providers"},
+}
+
+// listValue is a flag.Value for comma separated lists.
+type listValue struct{ list *[]string }
+
+func (v listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v listValue) Set(s string) error {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v.list = list
+	return nil
+}
+
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("social-net", flag.ContinueOnError)
+	usage := map[string]string{}
+	for _, o := range options {
+		usage[o.key] = o.usage + " ($" + o.env + ")"
+	}
+	name := func(key string) string { return strings.ReplaceAll(key, "_", "-") }
+
+	fs.IntVar(&c.Port, name("port"), c.Port, usage["port"])
+	fs.StringVar(&c.DBPath, name("db_path"), c.DBPath, usage["db_path"])
+	fs.StringVar(&c.MigrationsDir, name("migrations_dir"), c.MigrationsDir, usage["migrations_dir"])
+	fs.StringVar(&c.UploadsDir, name("uploads_dir"), c.UploadsDir, usage["uploads_dir"])
+	fs.StringVar(&c.UploadsURL, name("uploads_url"), c.UploadsURL, usage["uploads_url"])
+	fs.StringVar(&c.ExportsDir, name("exports_dir"), c.ExportsDir, usage["exports_dir"])
+	fs.StringVar(&c.FrontendURL, name("frontend_url"), c.FrontendURL, usage["frontend_url"])
+	fs.Var(listValue{&c.CORSOrigins}, name("cors_origins"), usage["cors_origins"])
+	fs.Var(listValue{&c.TrustedProxies}, name("trusted_proxies"), usage["trusted_proxies"])
+	fs.DurationVar(&c.SessionIdleTimeout, name("session_idle_timeout"), c.SessionIdleTimeout, usage["session_idle_timeout"])
+	fs.DurationVar(&c.SessionAbsoluteTimeout, name("session_absolute_timeout"), c.SessionAbsoluteTimeout, usage["session_absolute_timeout"])
+	fs.DurationVar(&c.SessionRotateAfter, name("session_rotate_after"), c.SessionRotateAfter, usage["session_rotate_after"])
+	fs.DurationVar(&c.SessionRotationGrace, name("session_rotation_grace"), c.SessionRotationGrace, usage["session_rotation_grace"])
+	fs.DurationVar(&c.SessionSweepInterval, name("session_sweep_interval"), c.SessionSweepInterval, usage["session_sweep_interval"])
+	fs.BoolVar(&c.CookieSecure, name("cookie_secure"), c.CookieSecure, usage["cookie_secure"])
+	fs.Int64Var(&c.MaxRequestSize, name("max_request_size"), c.MaxRequestSize, usage["max_request_size"])
+	fs.Int64Var(&c.MaxImageSize, name("max_image_size"), c.MaxImageSize, usage["max_image_size"])
+	fs.IntVar(&c.LoginMaxFailures, name("login_max_failures"), c.LoginMaxFailures, usage["login_max_failures"])
+	fs.IntVar(&c.LoginIPMaxFailures, name("login_ip_max_failures"), c.LoginIPMaxFailures, usage["login_ip_max_failures"])
+	fs.DurationVar(&c.LoginLockoutBase, name("login_lockout_base"), c.LoginLockoutBase, usage["login_lockout_base"])
+	fs.DurationVar(&c.LoginLockoutMax, name("login_lockout_max"), c.LoginLockoutMax, usage["login_lockout_max"])
+	fs.DurationVar(&c.LoginFailureWindow, name("login_failure_window"), c.LoginFailureWindow, usage["login_failure_window"])
+	fs.DurationVar(&c.AccountDeletionGrace, name("account_deletion_grace"), c.AccountDeletionGrace, usage["account_deletion_grace"])
+	fs.DurationVar(&c.AccountDeletionSweepInterval, name("account_deletion_sweep_interval"), c.AccountDeletionSweepInterval, usage["account_deletion_sweep_interval"])
+	fs.DurationVar(&c.UsernameChangeCooldown, name("username_change_cooldown"), c.UsernameChangeCooldown, usage["username_change_cooldown"])
+	fs.DurationVar(&c.UsernameRedirectTTL, name("username_redirect_ttl"), c.UsernameRedirectTTL, usage["username_redirect_ttl"])
+	fs.DurationVar(&c.ExportTTL, name("export_ttl"), c.ExportTTL, usage["export_ttl"])
+	fs.DurationVar(&c.ExportSweepInterval, name("export_sweep_interval"), c.ExportSweepInterval, usage["export_sweep_interval"])
+	fs.StringVar(&c.SMTPHost, name("smtp_host"), c.SMTPHost, usage["smtp_host"])
+	fs.IntVar(&c.SMTPPort, name("smtp_port"), c.SMTPPort, usage["smtp_port"])
+	fs.StringVar(&c.SMTPUsername, name("smtp_username"), c.SMTPUsername, usage["smtp_username"])
+	fs.StringVar(&c.SMTPPassword, name("smtp_password"), c.SMTPPassword, usage["smtp_password"])
+	fs.StringVar(&c.SMTPFrom, name("smtp_from"), c.SMTPFrom, usage["smtp_from"])
+	fs.Var(listValue{&c.AdminUsers}, name("admin_users"), usage["admin_users"])
+	fs.StringVar(&c.OIDCConfig, name("oidc_config"), c.OIDCConfig, usage["oidc_config"])
+	return fs
+}
+
+// Load builds the configuration from args (usually os.Args[1:]), the
+// environment and the JSON file named by -config or $CONFIG_FILE, validates
+// it and makes it Current.
+func Load(args []string) (*Config, error) {
+	c := Default()
+	fs := c.flagSet()
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "JSON configuration file ($CONFIG_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	set := func(key string, value string, source string) error {
+		name := strings.ReplaceAll(key, "_", "-")
+		if explicit[name] {
+			return nil
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid %s: %v", source, key, err)
+		}
+		return nil
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range options {
+			if value, ok := values[o.key]; ok {
+				if err := set(o.key, value, *configFile); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, o := range options {
+		if value, ok := os.LookupEnv(o.env); ok && value != "" {
+			if err := set(o.key, value, "$"+o.env); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	Current = c
+	return c, nil
+}
+
+// readFile flattens the JSON file into the string form flags accept:
+// durations as "15m", lists as arrays or comma separated strings.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, o := range options {
+		known[o.key] = true
+	}
+	values := map[string]string{}
+	for key, v := range raw {
+		if !known[key] {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		switch v := v.(type) {
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("%s: invalid value for %q", path, key)
+		}
+	}
+	return values, nil
+}
+
+func validURL(name string, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http(s) URL, got %q", name, value)
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		check(fmt.Errorf("port must be between 1 and 65535, got %d", c.Port))
+	}
+	for name, dir := range map[string]string{"db_path": c.DBPath, "migrations_dir": c.MigrationsDir, "uploads_dir": c.UploadsDir, "exports_dir": c.ExportsDir} {
+		if strings.TrimSpace(dir) == "" {
+			check(fmt.Errorf("%s must not be empty", name))
+		}
+	}
+	check(validURL("uploads_url", c.UploadsURL))
+	if !strings.HasSuffix(c.UploadsURL, "/") {
+		c.UploadsURL += "/"
+	}
+	check(validURL("frontend_url", c.FrontendURL))
+	c.FrontendURL = strings.TrimSuffix(c.FrontendURL, "/")
+	if len(c.CORSOrigins) == 0 {
+		check(errors.New("cors_origins must list at least one origin"))
+	}
+	for _, origin := range c.CORSOrigins {
+		check(validURL("cors_origins", origin))
+	}
+	c.trustedNets = nil
+	for _, proxy := range c.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			check(fmt.Errorf("trusted_proxies must hold IP addresses or CIDR ranges, got %q", proxy))
+			continue
+		}
+		c.trustedNets = append(c.trustedNets, ipNet)
+	}
+	if c.SessionIdleTimeout <= 0 || c.SessionAbsoluteTimeout <= 0 || c.SessionRotateAfter <= 0 || c.SessionRotationGrace <= 0 {
+		check(errors.New("session timeouts must be positive"))
+	}
+	if c.SessionIdleTimeout > c.SessionAbsoluteTimeout {
+		check(errors.New("session_idle_timeout must not exceed session_absolute_timeout"))
+	}
+	if c.MaxRequestSize <= 0 || c.MaxImageSize <= 0 {
+		check(errors.New("upload limits must be positive"))
+	}
+	if c.MaxImageSize > c.MaxRequestSize {
+		check(errors.New("max_image_size must not exceed max_request_size"))
+	}
+	if c.LoginMaxFailures < 1 || c.LoginIPMaxFailures < 1 {
+		check(errors.New("login failure limits must be at least 1"))
+	}
+	if c.LoginLockoutBase <= 0 || c.LoginFailureWindow <= 0 {
+		check(errors.New("login_lockout_base and login_failure_window must be positive"))
+	}
+	if c.LoginLockoutMax < c.LoginLockoutBase {
+		check(errors.New("login_lockout_max must not be shorter than login_lockout_base"))
+	}
+	for name, d := range map[string]time.Duration{
+		"session_sweep_interval":          c.SessionSweepInterval,
+		"account_deletion_grace":          c.AccountDeletionGrace,
+		"account_deletion_sweep_interval": c.AccountDeletionSweepInterval,
+		"username_change_cooldown":        c.UsernameChangeCooldown,
+		"username_redirect_ttl":           c.UsernameRedirectTTL,
+		"export_ttl":                      c.ExportTTL,
+		"export_sweep_interval":           c.ExportSweepInterval,
+	} {
+		if d <= 0 {
+			check(fmt.Errorf("%s must be positive", name))
+		}
+	}
+	if c.SMTPHost != "" {
+		if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+			check(fmt.Errorf("smtp_port must be between 1 and 65535, got %d", c.SMTPPort))
+		}
+		if !strings.Contains(c.SMTPFrom, "@") || strings.ContainsAny(c.SMTPFrom, "\r\n") {
+			check(fmt.Errorf("smtp_from must be an email address, got %q", c.SMTPFrom))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// UploadURL is the public URL of an uploaded file.
+func (c *Config) UploadURL(name string) string {
+	return c.UploadsURL + name
+}
+
+// TrustedProxy reports whether ip is one of the configured reverse proxies.
+func (c *Config) TrustedProxy(ip net.IP) bool {
+	for _, ipNet := range c.trustedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginAllowed reports whether a browser origin may call the API.
+func OriginAllowed(origin string) bool {
+	for _, o := range Current.CORSOrigins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowOrigin is the Access-Control-Allow-Origin value for r: its origin
+// when allowed, the first configured one otherwise.
+func AllowOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && OriginAllowed(origin) {
+		return origin
+	}
+	return Current.CORSOrigins[0]
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPriority(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{
+		"port": 9000,
+		"login_max_failures": 7,
+		"login_lockout_max": "2h",
+		"smtp_host": "smtp.test.local",
+		"admin_users": ["root", "ops@test.local"]
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("LOGIN_MAX_FAILURES", "9")
+	t.Setenv("SMTP_PORT", "2525")
+	previous := Current
+	t.Cleanup(func() { Current = previous })
+
+	c, err := Load([]string{"-login-max-failures", "11", "-export-ttl", "48h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"file overrides default", c.Port, 9000},
+		{"flag overrides environment and file", c.LoginMaxFailures, 11},
+		{"file duration", c.LoginLockoutMax, 2 * time.Hour},
+		{"environment overrides default", c.SMTPPort, 2525},
+		{"file string", c.SMTPHost, "smtp.test.local"},
+		{"file list", strings.Join(c.AdminUsers, ","), "root,ops@test.local"},
+		{"flag duration", c.ExportTTL, 48 * time.Hour},
+		{"default kept", c.UsernameChangeCooldown, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if Current != c {
+		t.Error("Load did not make the configuration current")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(c *Config)
+		wantErr string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"bad port", func(c *Config) { c.Port = 0 }, "port must be between"},
+		{"no failures allowed", func(c *Config) { c.LoginMaxFailures = 0 }, "login failure limits"},
+		{"max lockout below base", func(c *Config) { c.LoginLockoutMax = time.Second }, "login_lockout_max"},
+		{"zero export ttl", func(c *Config) { c.ExportTTL = 0 }, "export_ttl must be positive"},
+		{"smtp port out of range", func(c *Config) { c.SMTPHost, c.SMTPPort = "smtp.test.local", 70000 }, "smtp_port"},
+		{"smtp sender without address", func(c *Config) { c.SMTPHost, c.SMTPFrom = "smtp.test.local", "nobody" }, "smtp_from"},
+		{"smtp port ignored without host", func(c *Config) { c.SMTPPort = 0 }, ""},
+		{"bad trusted proxy", func(c *Config) { c.TrustedProxies = []string{"proxy.local"} }, "trusted_proxies"},
+		{"trusted proxy range", func(c *Config) { c.TrustedProxies = []string{"10.0.0.0/8", "::1"} }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.edit(c)
+			err := c.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package dbtest gives tests a migrated database of their own.
+package dbtest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+)
+
+// Open points db.DB at a fresh database in a temporary directory with every
+// migration applied, and closes it when the test ends.
+func Open(t testing.TB) {
+	t.Helper()
+	_, file, _, _ := runtime.Caller(0)
+	config.Current.DBPath = filepath.Join(t.TempDir(), "db.db")
+	config.Current.MigrationsDir = filepath.Join(filepath.Dir(file), "..", "migrations", "sqlite3")
+
+	db.Initdb()
+	if db.DB == nil {
+		t.Fatal("database did not open")
+	}
+	files, _ := filepath.Glob(filepath.Join(config.Current.MigrationsDir, "*.sql"))
+	var applied int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM gorp_migrations").Scan(&applied); err != nil || applied != len(files) {
+		t.Fatalf("applied %d of %d migrations: %v", applied, len(files), err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+}
+
+// User inserts a user and returns its id.
+func User(t testing.TB, id string, username string, email string, verified bool) string {
+	t.Helper()
+	var verifiedAt interface{}
+	if verified {
+		verifiedAt = "2024-01-01 00:00:00"
+	}
+	_, err := db.DB.Exec(`INSERT INTO users (id, username, email, password, first_name, last_name, date_of_birth, bio, privacy, avatar, nickname, verified_at)
+		VALUES (?, ?, ?, '', 'Test', 'User', '2000-01-01', '', 'public', '', '', ?)`, id, username, email, verifiedAt)
+	if err != nil {
+		t.Fatalf("inserting user %s: %v", username, err)
+	}
+	return id
+}
+
+// SignedIn returns a request carrying the cookie of a new session of userID.
+func SignedIn(t testing.TB, method string, target string, body io.Reader, userID string) *http.Request {
+	t.Helper()
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	now := time.Now()
+	_, err := db.DB.Exec(`INSERT INTO sessions (session_id, user_id, token, expires_at, created_at, last_used_at, rotated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, "s-"+token, userID, token, now.Add(time.Hour), now, now, now)
+	if err != nil {
+		t.Fatalf("starting a session for %s: %v", userID, err)
+	}
+	r := httptest.NewRequest(method, target, body)
+	r.AddCookie(&http.Cookie{Name: "token", Value: token})
+	return r
+}
+
+// SignedInForm is SignedIn for a POST of fields as a multipart form.
+func SignedInForm(t testing.TB, target string, fields map[string]string, userID string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+	r := SignedIn(t, http.MethodPost, target, &body, userID)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+// Exec runs each statement in turn and stops the test at the first error.
+func Exec(t testing.TB, queries ...string) {
+	t.Helper()
+	for _, query := range queries {
+		if _, err := db.DB.Exec(query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+}
+
+// Exists reports whether query selects any row.
+func Exists(t testing.TB, query string) bool {
+	t.Helper()
+	var found bool
+	if err := db.DB.QueryRow("SELECT EXISTS(" + query + ")").Scan(&found); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return found
+}
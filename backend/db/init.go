@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 
+	"social-net/config"
+
 	_ "github.com/mattn/go-sqlite3"
 	migrate "github.com/rubenv/sql-migrate"
 )
@@ -13,7 +15,7 @@ var DB *sql.DB
 
 func Initdb() {
 	var err error
-	DB, err = sql.Open("sqlite3", "./db/db.db")
+	DB, err = sql.Open("sqlite3", config.Current.DBPath)
 	if err != nil {
 		fmt.Println("Failed to open database:", err)
 		return
@@ -25,7 +27,7 @@ func Initdb() {
 	}
 
 	migrations := &migrate.FileMigrationSource{
-		Dir: "db/migrations/sqlite3",
+		Dir: config.Current.MigrationsDir,
 	}
 
 	n, err := migrate.Exec(DB, "sqlite3", migrations, migrate.Up)
@@ -0,0 +1,25 @@
+-- +migrate Up
+ALTER TABLE sessions ADD COLUMN device TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE sessions ADD COLUMN created_at DATETIME;
+
+ALTER TABLE sessions ADD COLUMN last_used_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_sessions_user_id;
+
+ALTER TABLE sessions DROP COLUMN last_used_at;
+
+ALTER TABLE sessions DROP COLUMN created_at;
+
+ALTER TABLE sessions DROP COLUMN ip;
+
+ALTER TABLE sessions DROP COLUMN user_agent;
+
+ALTER TABLE sessions DROP COLUMN device;
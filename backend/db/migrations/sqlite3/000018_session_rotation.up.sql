@@ -0,0 +1,17 @@
+-- +migrate Up
+ALTER TABLE sessions ADD COLUMN rotated_at DATETIME;
+
+ALTER TABLE sessions ADD COLUMN previous_token TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token ON sessions (previous_token);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_sessions_previous_token;
+
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+
+ALTER TABLE sessions DROP COLUMN previous_token;
+
+ALTER TABLE sessions DROP COLUMN rotated_at;
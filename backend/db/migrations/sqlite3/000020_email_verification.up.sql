@@ -0,0 +1,28 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN verified_at DATETIME;
+
+-- Accounts created before verification existed are treated as verified.
+UPDATE users SET verified_at = CURRENT_TIMESTAMP WHERE verified_at IS NULL;
+
+CREATE TABLE
+    IF NOT EXISTS email_verifications (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        email TEXT NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        expires_at DATETIME NOT NULL,
+        used_at DATETIME,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
+
+-- +migrate Down
+PRAGMA foreign_keys = OFF;
+
+DROP TABLE IF EXISTS email_verifications;
+
+ALTER TABLE users DROP COLUMN verified_at;
+
+PRAGMA foreign_keys = ON;
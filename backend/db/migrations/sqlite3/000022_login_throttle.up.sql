@@ -0,0 +1,28 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS login_throttle (
+        throttle_key TEXT PRIMARY KEY NOT NULL,
+        failures INTEGER NOT NULL DEFAULT 0,
+        last_failure DATETIME NOT NULL,
+        locked_until DATETIME
+    );
+
+CREATE TABLE
+    IF NOT EXISTS security_events (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        event TEXT NOT NULL,
+        ip TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        details TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_id ON security_events (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_created_at ON security_events (created_at);
+
+-- +migrate Down
+DROP TABLE IF EXISTS security_events;
+
+DROP TABLE IF EXISTS login_throttle;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN delete_after DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_users_delete_after ON users (delete_after);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_users_delete_after;
+
+ALTER TABLE users DROP COLUMN delete_after;
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS data_exports (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        error TEXT NOT NULL DEFAULT '',
+        size INTEGER NOT NULL DEFAULT 0,
+        created_at DATETIME NOT NULL,
+        completed_at DATETIME,
+        expires_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports (user_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS data_exports;
@@ -0,0 +1,20 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS personal_access_tokens (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        token_prefix TEXT NOT NULL,
+        scopes TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        last_used_at DATETIME,
+        expires_at DATETIME,
+        revoked_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS personal_access_tokens;
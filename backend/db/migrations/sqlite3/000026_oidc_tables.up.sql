@@ -0,0 +1,30 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS user_identities (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        provider TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        email TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL,
+        last_login_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+        UNIQUE (provider, subject)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE
+    IF NOT EXISTS oidc_states (
+        state_hash TEXT PRIMARY KEY NOT NULL,
+        provider TEXT NOT NULL,
+        code_verifier TEXT NOT NULL,
+        nonce TEXT NOT NULL,
+        redirect_to TEXT NOT NULL DEFAULT '',
+        expires_at DATETIME NOT NULL
+    );
+
+-- +migrate Down
+DROP TABLE IF EXISTS oidc_states;
+
+DROP TABLE IF EXISTS user_identities;
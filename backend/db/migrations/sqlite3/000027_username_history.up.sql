@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS username_history (
+        old_username TEXT PRIMARY KEY NOT NULL,
+        user_id TEXT NOT NULL,
+        renamed_at DATETIME NOT NULL,
+        expires_at DATETIME NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_username_history_user_id ON username_history (user_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS username_history;
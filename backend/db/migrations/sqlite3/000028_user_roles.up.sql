@@ -0,0 +1,21 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+
+ALTER TABLE users ADD COLUMN suspended_at DATETIME;
+
+ALTER TABLE users ADD COLUMN suspended_until DATETIME;
+
+ALTER TABLE users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_users_role;
+
+ALTER TABLE users DROP COLUMN suspension_reason;
+
+ALTER TABLE users DROP COLUMN suspended_until;
+
+ALTER TABLE users DROP COLUMN suspended_at;
+
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,62 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS audit_log (
+        id TEXT PRIMARY KEY,
+        actor_id TEXT,
+        action TEXT NOT NULL,
+        target_type TEXT NOT NULL DEFAULT '',
+        target_id TEXT NOT NULL DEFAULT '',
+        ip TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        metadata TEXT NOT NULL DEFAULT '{}',
+        created_at DATETIME NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log (actor_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target_type, target_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+
+INSERT INTO audit_log (id, actor_id, action, target_type, target_id, ip, user_agent, metadata, created_at)
+SELECT id, user_id, event, CASE WHEN user_id IS NULL THEN '' ELSE 'user' END, COALESCE(user_id, ''),
+    ip, user_agent, json_object('details', details), created_at
+FROM security_events;
+
+DROP TABLE IF EXISTS security_events;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+-- +migrate StatementEnd
+
+-- +migrate Down
+CREATE TABLE
+    IF NOT EXISTS security_events (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        event TEXT NOT NULL,
+        ip TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        details TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_id ON security_events (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_created_at ON security_events (created_at);
+
+INSERT INTO security_events (id, user_id, event, ip, user_agent, details, created_at)
+SELECT id, actor_id, action, ip, user_agent, COALESCE(json_extract(metadata, '$.details'), ''), created_at
+FROM audit_log;
+
+DROP TABLE IF EXISTS audit_log;
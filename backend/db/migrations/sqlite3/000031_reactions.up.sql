@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS reactions (
+        id TEXT PRIMARY KEY,
+        target_type TEXT NOT NULL,
+        target_id TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        reaction TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+        UNIQUE (target_type, target_id, user_id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_reactions_user_id ON reactions (user_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS reactions;
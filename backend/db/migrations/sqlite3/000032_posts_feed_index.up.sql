@@ -0,0 +1,5 @@
+-- +migrate Up
+CREATE INDEX IF NOT EXISTS idx_posts_creation_date_id ON posts (creation_date, id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_posts_creation_date_id;
@@ -0,0 +1,30 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS hashtags (
+        target_type TEXT NOT NULL,
+        target_id TEXT NOT NULL,
+        tag TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (target_type, target_id, tag)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_hashtags_tag ON hashtags (tag, target_type, created_at);
+
+CREATE TABLE
+    IF NOT EXISTS mentions (
+        target_type TEXT NOT NULL,
+        target_id TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        author_id TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (target_type, target_id, user_id),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+        FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id, created_at);
+
+-- +migrate Down
+DROP TABLE IF EXISTS mentions;
+
+DROP TABLE IF EXISTS hashtags;
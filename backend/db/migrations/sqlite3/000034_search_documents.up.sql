@@ -0,0 +1,170 @@
+-- +migrate Up
+-- One row per searchable item, kept in sync with its table by the triggers
+-- below. The FTS5 index over it is created at startup by the search package,
+-- since not every build of the driver includes FTS5.
+CREATE TABLE
+    IF NOT EXISTS search_documents (
+        id INTEGER PRIMARY KEY,
+        doc_type TEXT NOT NULL,
+        doc_id TEXT NOT NULL,
+        parent_id TEXT NOT NULL DEFAULT '',
+        title TEXT NOT NULL DEFAULT '',
+        body TEXT NOT NULL DEFAULT '',
+        created_at DATETIME,
+        UNIQUE (doc_type, doc_id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_search_documents_parent_id ON search_documents (doc_type, parent_id);
+
+INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+SELECT 'post', id, '', title, content, creation_date
+FROM posts;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_posts_ai AFTER INSERT ON posts
+BEGIN
+    INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+    VALUES ('post', new.id, '', new.title, new.content, new.creation_date);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_posts_au AFTER UPDATE OF title, content ON posts
+BEGIN
+    UPDATE search_documents SET title = new.title, body = new.content
+    WHERE doc_type = 'post' AND doc_id = new.id;
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_posts_ad AFTER DELETE ON posts
+BEGIN
+    DELETE FROM search_documents WHERE doc_type = 'post' AND doc_id = old.id;
+END;
+-- +migrate StatementEnd
+
+INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+SELECT 'comment', id, post_id, '', content, creation_date
+FROM comments;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_comments_ai AFTER INSERT ON comments
+BEGIN
+    INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+    VALUES ('comment', new.id, new.post_id, '', new.content, new.creation_date);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_comments_au AFTER UPDATE OF content ON comments
+BEGIN
+    UPDATE search_documents SET title = '', body = new.content
+    WHERE doc_type = 'comment' AND doc_id = new.id;
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_comments_ad AFTER DELETE ON comments
+BEGIN
+    DELETE FROM search_documents WHERE doc_type = 'comment' AND doc_id = old.id;
+END;
+-- +migrate StatementEnd
+
+INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+SELECT 'group_post', id, group_id, title, content, creation_date
+FROM group_posts;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_group_posts_ai AFTER INSERT ON group_posts
+BEGIN
+    INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+    VALUES ('group_post', new.id, new.group_id, new.title, new.content, new.creation_date);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_group_posts_au AFTER UPDATE OF title, content ON group_posts
+BEGIN
+    UPDATE search_documents SET title = new.title, body = new.content
+    WHERE doc_type = 'group_post' AND doc_id = new.id;
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_group_posts_ad AFTER DELETE ON group_posts
+BEGIN
+    DELETE FROM search_documents WHERE doc_type = 'group_post' AND doc_id = old.id;
+END;
+-- +migrate StatementEnd
+
+INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+SELECT 'group', id, '', title, COALESCE(description, ''), NULL
+FROM groups;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_groups_ai AFTER INSERT ON groups
+BEGIN
+    INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+    VALUES ('group', new.id, '', new.title, COALESCE(new.description, ''), NULL);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_groups_au AFTER UPDATE OF title, description ON groups
+BEGIN
+    UPDATE search_documents SET title = new.title, body = COALESCE(new.description, '')
+    WHERE doc_type = 'group' AND doc_id = new.id;
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_groups_ad AFTER DELETE ON groups
+BEGIN
+    DELETE FROM search_documents WHERE doc_type = 'group' AND doc_id = old.id;
+END;
+-- +migrate StatementEnd
+
+INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+SELECT 'event', id, group_id, title, description || ' ' || COALESCE(location, ''), creation_date
+FROM events;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_events_ai AFTER INSERT ON events
+BEGIN
+    INSERT INTO search_documents (doc_type, doc_id, parent_id, title, body, created_at)
+    VALUES ('event', new.id, new.group_id, new.title, new.description || ' ' || COALESCE(new.location, ''), new.creation_date);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_events_au AFTER UPDATE OF title, description, location ON events
+BEGIN
+    UPDATE search_documents SET title = new.title, body = new.description || ' ' || COALESCE(new.location, '')
+    WHERE doc_type = 'event' AND doc_id = new.id;
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS search_events_ad AFTER DELETE ON events
+BEGIN
+    DELETE FROM search_documents WHERE doc_type = 'event' AND doc_id = old.id;
+END;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS search_posts_ai;
+DROP TRIGGER IF EXISTS search_posts_au;
+DROP TRIGGER IF EXISTS search_posts_ad;
+DROP TRIGGER IF EXISTS search_comments_ai;
+DROP TRIGGER IF EXISTS search_comments_au;
+DROP TRIGGER IF EXISTS search_comments_ad;
+DROP TRIGGER IF EXISTS search_group_posts_ai;
+DROP TRIGGER IF EXISTS search_group_posts_au;
+DROP TRIGGER IF EXISTS search_group_posts_ad;
+DROP TRIGGER IF EXISTS search_groups_ai;
+DROP TRIGGER IF EXISTS search_groups_au;
+DROP TRIGGER IF EXISTS search_groups_ad;
+DROP TRIGGER IF EXISTS search_events_ai;
+DROP TRIGGER IF EXISTS search_events_au;
+DROP TRIGGER IF EXISTS search_events_ad;
+DROP TABLE IF EXISTS search_documents;
@@ -0,0 +1,32 @@
+-- +migrate Up
+CREATE TABLE
+    IF NOT EXISTS bookmark_collections (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        UNIQUE (user_id, name),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    IF NOT EXISTS bookmarks (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        target_type TEXT NOT NULL,
+        target_id TEXT NOT NULL,
+        collection_id TEXT,
+        created_at DATETIME NOT NULL,
+        UNIQUE (user_id, target_type, target_id),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+        FOREIGN KEY (collection_id) REFERENCES bookmark_collections (id) ON DELETE SET NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user_id ON bookmarks (user_id, collection_id, id);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_target ON bookmarks (target_type, target_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS bookmarks;
+
+DROP TABLE IF EXISTS bookmark_collections;
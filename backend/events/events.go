@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"social-net/config"
 	"social-net/db"
 	"social-net/notification"
 	"social-net/session"
@@ -78,10 +79,10 @@ func sanitizeInput(input string) string {
 }
 
 func CreateEvent(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -93,18 +94,7 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-
-	token := cookie.Value
-	userID, ok := session.GetUserIDFromToken(token)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	var event Event
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
@@ -152,7 +142,7 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var count int
-	err = db.DB.QueryRow("SELECT COUNT(*) FROM group_members WHERE user_id = $1 AND group_id = $2", userID, groupID).Scan(&count)
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM group_members WHERE user_id = $1 AND group_id = $2", userID, groupID).Scan(&count)
 	if err != nil {
 		log.Println("Error checking group membership:", err)
 		http.Error(w, "Error checking group membership", http.StatusInternalServerError)
@@ -236,10 +226,10 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 }
 
 func JoinEvent(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -265,16 +255,7 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: missing token", http.StatusUnauthorized)
-		return
-	}
-	userID, ok := session.GetUserIDFromToken(cookie.Value)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -378,10 +359,10 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetEvents(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
@@ -399,18 +380,7 @@ func GetEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		log.Println("Error getting token cookie:", err)
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-	token := cookie.Value
-	userID, ok := session.GetUserIDFromToken(token)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	query := `
 	SELECT 
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"database/sql"
+
+	"social-net/db"
+	"social-net/utils"
+)
+
+// RemoveEvent deletes an event and the responses to it. It returns
+// sql.ErrNoRows for an unknown event.
+func RemoveEvent(eventID string) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM events WHERE id = ?)", eventID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return utils.ExecAll([]string{
+		"DELETE FROM event_responses WHERE event_id = ?",
+		"DELETE FROM notifications WHERE related_entity_id = ?",
+		"DELETE FROM events WHERE id = ?",
+	}, eventID)
+}
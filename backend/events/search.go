@@ -0,0 +1,14 @@
+package events
+
+import (
+	"social-net/groups"
+	"social-net/search"
+)
+
+// Events are visible to the members of their group.
+func init() {
+	search.RegisterType("event", func(userID string) (string, []interface{}) {
+		memberOf, args := groups.MemberGroups(userID)
+		return "d.parent_id IN (" + memberOf + ")", args
+	})
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/profile"
+)
+
+// section is one JSON file of the archive and the query that fills it.
+type section struct {
+	name  string
+	query string
+}
+
+// sections lists everything exported besides the profile. Each query takes
+// the user id once per "?"; sectionArgs repeats it as needed.
+var sections = []section{
+	{"posts.json", `SELECT p.id, p.title, p.content, p.image, p.status, p.creation_date,
+		(SELECT GROUP_CONCAT(u.username) FROM postsPrivacy pp JOIN users u ON u.id = pp.user_id WHERE pp.post_id = p.id) AS visible_to
+		FROM posts p WHERE p.user_id = ? ORDER BY p.creation_date`},
+	{"comments.json", `SELECT c.id, c.post_id, c.content, c.image, c.creation_date
+		FROM comments c WHERE c.author = (SELECT username FROM users WHERE id = ?) ORDER BY c.creation_date`},
+	{"group_posts.json", `SELECT gp.id, gp.group_id, g.title AS group_title, gp.title, gp.content, gp.image, gp.creation_date
+		FROM group_posts gp LEFT JOIN groups g ON g.id = gp.group_id WHERE gp.user_id = ? ORDER BY gp.creation_date`},
+	{"group_comments.json", `SELECT gc.id, gc.group_post_id, gc.content, gc.image, gc.creation_date
+		FROM group_comments gc WHERE gc.author = (SELECT username FROM users WHERE id = ?) ORDER BY gc.creation_date`},
+	{"messages.json", `SELECT m.id, s.username AS sender, r.username AS receiver, m.content, m.creation_date
+		FROM messages m LEFT JOIN users s ON s.id = m.sender_id LEFT JOIN users r ON r.id = m.receiver_id
+		WHERE m.sender_id = ? OR m.receiver_id = ? ORDER BY m.creation_date`},
+	{"group_messages.json", `SELECT gm.id, gm.group_id, g.title AS group_title, gm.content, gm.created_at
+		FROM group_messages gm LEFT JOIN groups g ON g.id = gm.group_id WHERE gm.sender_id = ? ORDER BY gm.created_at`},
+	{"groups.json", `SELECT g.id, g.title, g.description, gm.status, gm.is_admin, g.creator_id = gm.user_id AS is_owner
+		FROM group_members gm JOIN groups g ON g.id = gm.group_id WHERE gm.user_id = ?`},
+	{"events_created.json", `SELECT e.id, e.group_id, e.title, e.description, e.event_datetime, e.location, e.creation_date
+		FROM events e WHERE e.creator_id = ? ORDER BY e.creation_date`},
+	{"event_responses.json", `SELECT er.event_id, e.title AS event_title, e.event_datetime, er.option, er.response_date
+		FROM event_responses er LEFT JOIN events e ON e.id = er.event_id WHERE er.user_id = ? ORDER BY er.response_date`},
+	{"followers.json", `SELECT u.username, f.status FROM Followers f JOIN users u ON u.id = f.follower_id WHERE f.followed_id = ?`},
+	{"following.json", `SELECT u.username, f.status FROM Followers f JOIN users u ON u.id = f.followed_id WHERE f.follower_id = ?`},
+	{"notifications.json", `SELECT n.id, u.username AS sender, n.type, n.content, n.is_read, n.created_at, n.related_entity_id, n.related_entity_type
+		FROM notifications n LEFT JOIN users u ON u.id = n.sender_id WHERE n.user_id = ? ORDER BY n.created_at`},
+}
+
+// mediaQuery lists every uploaded file that belongs to the user.
+const mediaQuery = `
+	SELECT avatar FROM users WHERE id = ?1
+	UNION SELECT image FROM posts WHERE user_id = ?1
+	UNION SELECT image FROM comments WHERE author = (SELECT username FROM users WHERE id = ?1)
+	UNION SELECT image FROM group_posts WHERE user_id = ?1
+	UNION SELECT image FROM group_comments WHERE author = (SELECT username FROM users WHERE id = ?1)`
+
+func sectionArgs(query string, userID string) []interface{} {
+	var args []interface{}
+	for _, c := range query {
+		if c == '?' {
+			args = append(args, userID)
+		}
+	}
+	return args
+}
+
+// queryRecords returns every row of the query as a column name to value map.
+func queryRecords(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			record[column] = values[i]
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func create(zw *zip.Writer, name string) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := create(zw, name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func addFile(zw *zip.Writer, name string, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := create(zw, name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// buildArchive writes the user's data to path as a ZIP and returns its size.
+func buildArchive(userID string, path string) (int64, error) {
+	tmp := path + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+
+	zw := zip.NewWriter(out)
+	err = writeSections(zw, userID)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func writeSections(zw *zip.Writer, userID string) error {
+	userInfo, err := profile.LoadUserInfo(userID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "profile.json", userInfo); err != nil {
+		return err
+	}
+
+	for _, s := range sections {
+		records, err := queryRecords(s.query, sectionArgs(s.query, userID)...)
+		if err != nil {
+			return err
+		}
+		if err := writeJSON(zw, s.name, records); err != nil {
+			return err
+		}
+	}
+
+	media, err := queryRecords(mediaQuery, userID)
+	if err != nil {
+		return err
+	}
+	for _, m := range media {
+		for _, v := range m {
+			name, _ := v.(string)
+			if name == "" {
+				continue
+			}
+			name = filepath.Base(name)
+			err := addFile(zw, "media/"+name, filepath.Join(config.Current.UploadsDir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+type Export struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Size        int64      `json:"size"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func archivePath(exportID string) string {
+	return filepath.Join(config.Current.ExportsDir, exportID+".zip")
+}
+
+// getExport loads an export owned by userID; an empty id means the latest.
+func getExport(userID string, exportID string) (Export, error) {
+	var e Export
+	var completedAt, expiresAt sql.NullTime
+	query := "SELECT id, status, error, size, created_at, completed_at, expires_at FROM data_exports WHERE user_id = ? AND id = ?"
+	args := []interface{}{userID, exportID}
+	if exportID == "" {
+		query = "SELECT id, status, error, size, created_at, completed_at, expires_at FROM data_exports WHERE user_id = ? ORDER BY created_at DESC LIMIT 1"
+		args = args[:1]
+	}
+	err := db.DB.QueryRow(query, args...).Scan(&e.ID, &e.Status, &e.Error, &e.Size, &e.CreatedAt, &completedAt, &expiresAt)
+	if err != nil {
+		return e, err
+	}
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	if e.Status == "ready" {
+		e.DownloadURL = "/api/export/download?id=" + e.ID
+	}
+	return e, nil
+}
+
+func writeExport(w http.ResponseWriter, status int, e Export) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// RequestExport starts building an archive of the caller's data. If one is
+// already being built, that export is returned instead of starting another.
+func RequestExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := session.CurrentUserID(r)
+
+	if e, err := getExport(userID, ""); err == nil && (e.Status == "pending" || e.Status == "running") {
+		writeExport(w, http.StatusAccepted, e)
+		return
+	}
+
+	exportID, err := uuid.NewV7()
+	if err != nil {
+		http.Error(w, "Failed to generate export ID", http.StatusInternalServerError)
+		return
+	}
+	_, err = db.DB.Exec("INSERT INTO data_exports (id, user_id, status, created_at) VALUES (?, ?, 'pending', ?)", exportID.String(), userID, time.Now())
+	if err != nil {
+		logger.LogError("Error creating data export", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	go run(userID, exportID.String())
+
+	e, err := getExport(userID, exportID.String())
+	if err != nil {
+		logger.LogError("Error loading data export", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeExport(w, http.StatusAccepted, e)
+}
+
+// run builds the archive into the configured exports directory. It is kept
+// for the configured export TTL, after which the sweeper removes it.
+func run(userID string, exportID string) {
+	if _, err := db.DB.Exec("UPDATE data_exports SET status = 'running' WHERE id = ?", exportID); err != nil {
+		logger.LogError("Error updating data export", err)
+	}
+
+	var size int64
+	err := os.MkdirAll(config.Current.ExportsDir, 0o755)
+	if err == nil {
+		size, err = buildArchive(userID, archivePath(exportID))
+	}
+	now := time.Now()
+	if err != nil {
+		logger.LogError("Error building data export", err)
+		_, err = db.DB.Exec("UPDATE data_exports SET status = 'failed', error = ?, completed_at = ? WHERE id = ?", "Failed to build export", now, exportID)
+	} else {
+		_, err = db.DB.Exec("UPDATE data_exports SET status = 'ready', size = ?, completed_at = ?, expires_at = ? WHERE id = ?", size, now, now.Add(config.Current.ExportTTL), exportID)
+	}
+	if err != nil {
+		logger.LogError("Error updating data export", err)
+	}
+}
+
+// ExportStatus reports an export by ?id=, or the caller's latest one.
+func ExportStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := session.CurrentUserID(r)
+
+	e, err := getExport(userID, r.URL.Query().Get("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Export not found", http.StatusNotFound)
+			return
+		}
+		logger.LogError("Error loading data export", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeExport(w, http.StatusOK, e)
+}
+
+func DownloadExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := session.CurrentUserID(r)
+
+	exportID := r.URL.Query().Get("id")
+	e, err := getExport(userID, exportID)
+	if err != nil || exportID == "" {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	if e.Status != "ready" {
+		http.Error(w, "Export is not ready yet", http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(archivePath(e.ID))
+	if err != nil {
+		logger.LogError("Error opening data export", err)
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export-`+e.CreatedAt.Format("2006-01-02")+`.zip"`)
+	http.ServeContent(w, r, "", e.CreatedAt, f)
+}
+
+// RemoveUserExports deletes every archive of the user, rows and files.
+func RemoveUserExports(userID string) error {
+	rows, err := db.DB.Query("SELECT id FROM data_exports WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		os.Remove(archivePath(id))
+	}
+	_, err = db.DB.Exec("DELETE FROM data_exports WHERE user_id = ?", userID)
+	return err
+}
+
+// PurgeExpired removes archives past their expiry and returns how many.
+func PurgeExpired() (int, error) {
+	rows, err := db.DB.Query("SELECT id FROM data_exports WHERE expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := os.Remove(archivePath(id)); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to remove export:", err)
+		}
+		if _, err := db.DB.Exec("DELETE FROM data_exports WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// StartSweeper removes expired archives now and then every interval. Exports
+// left pending by a restart are marked failed so they can be requested again.
+func StartSweeper(interval time.Duration) {
+	if _, err := db.DB.Exec("UPDATE data_exports SET status = 'failed', error = 'Interrupted' WHERE status IN ('pending', 'running')"); err != nil {
+		logger.LogError("Error resetting data exports", err)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := PurgeExpired()
+			if err != nil {
+				logger.LogError("Error purging data exports", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired export(s)", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+// useExportDirs points the uploads and exports directories at temporary ones.
+func useExportDirs(t *testing.T) {
+	previous := config.Current
+	cfg := *previous
+	cfg.UploadsDir = t.TempDir()
+	cfg.ExportsDir = t.TempDir()
+	config.Current = &cfg
+	t.Cleanup(func() { config.Current = previous })
+}
+
+func TestExportArchive(t *testing.T) {
+	dbtest.Open(t)
+	useExportDirs(t)
+	me := dbtest.User(t, "u-me", "me", "me@test.local", true)
+	other := dbtest.User(t, "u-other", "other", "other@test.local", true)
+	dbtest.User(t, "u-third", "third", "third@test.local", true)
+	dbtest.Exec(t,
+		`INSERT INTO posts (id, user_id, author, title, content, creation_date, status, image) VALUES
+			('p-mine', 'u-me', 'me', 'Mine', 'Mine', CURRENT_TIMESTAMP, 'semi-private', 'my-photo.png'),
+			('p-others-private', 'u-other', 'other', 'Secret', 'Secret', CURRENT_TIMESTAMP, 'private', 'their-photo.png')`,
+		"INSERT INTO postsPrivacy (id, post_id, user_id) VALUES ('pp-mine', 'p-mine', 'u-other'), ('pp-others', 'p-others-private', 'u-third')",
+		`INSERT INTO comments (id, post_id, author, content, creation_date) VALUES
+			('c-mine', 'p-others-private', 'me', 'Nice', CURRENT_TIMESTAMP),
+			('c-others', 'p-mine', 'other', 'Thanks', CURRENT_TIMESTAMP)`,
+		`INSERT INTO messages (id, sender_id, receiver_id, content, creation_date) VALUES
+			('m-sent', 'u-me', 'u-other', 'Hi', CURRENT_TIMESTAMP),
+			('m-received', 'u-other', 'u-me', 'Hello', CURRENT_TIMESTAMP),
+			('m-between-others', 'u-other', 'u-third', 'About me', CURRENT_TIMESTAMP)`,
+		"INSERT INTO groups (id, creator_id, title, description) VALUES ('g-export', 'u-other', 'Club', '')",
+		"INSERT INTO group_members (group_id, user_id, status, is_admin) VALUES ('g-export', 'u-me', 'accepted', 0), ('g-export', 'u-other', 'accepted', 1)",
+		"INSERT INTO group_messages (id, group_id, sender_id, content) VALUES ('gm-mine', 'g-export', 'u-me', 'Hi'), ('gm-others', 'g-export', 'u-other', 'Hi')",
+		`INSERT INTO notifications (id, user_id, sender_id, type, content) VALUES
+			('n-mine', 'u-me', 'u-other', 'follow', ''),
+			('n-others', 'u-other', 'u-me', 'follow', '')`,
+	)
+	for _, name := range []string{"my-photo.png", "their-photo.png"} {
+		if err := os.WriteFile(filepath.Join(config.Current.UploadsDir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	session.RequireAuth(RequestExport)(w, dbtest.SignedIn(t, http.MethodPost, "/api/export", nil, me))
+	var e Export
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil || w.Code != http.StatusAccepted {
+		t.Fatalf("request: status %d: %v", w.Code, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Status != "ready" {
+		if e.Status == "failed" || time.Now().After(deadline) {
+			t.Fatalf("export is %s: %s", e.Status, e.Error)
+		}
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		if e, err = getExport(me, e.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	session.RequireAuth(DownloadExport)(w, dbtest.SignedIn(t, http.MethodGet, "/api/export/download?id="+e.ID, nil, other))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("download by another user: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w = httptest.NewRecorder()
+	session.RequireAuth(DownloadExport)(w, dbtest.SignedIn(t, http.MethodGet, "/api/export/download?id="+e.ID, nil, me))
+	if w.Code != http.StatusOK {
+		t.Fatalf("download: status = %d: %s", w.Code, w.Body)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		text string
+		want bool
+	}{
+		{"profile", "profile.json", "me@test.local", true},
+		{"own post", "posts.json", "p-mine", true},
+		{"audience of the own post", "posts.json", `"visible_to": "other"`, true},
+		{"private post of another user", "posts.json", "p-others-private", false},
+		{"own comment", "comments.json", "c-mine", true},
+		{"comment of another user", "comments.json", "c-others", false},
+		{"sent message", "messages.json", "m-sent", true},
+		{"received message", "messages.json", "m-received", true},
+		{"message between other users", "messages.json", "m-between-others", false},
+		{"own group message", "group_messages.json", "gm-mine", true},
+		{"group message of another member", "group_messages.json", "gm-others", false},
+		{"group membership", "groups.json", "g-export", true},
+		{"own notification", "notifications.json", "n-mine", true},
+		{"notification of another user", "notifications.json", "n-others", false},
+		{"own image", "media/my-photo.png", "my-photo.png", true},
+	}
+	for _, tt := range tests {
+		content, ok := files[tt.file]
+		if !ok {
+			t.Errorf("%s: %s is missing from the archive", tt.name, tt.file)
+			continue
+		}
+		if got := strings.Contains(content, tt.text); got != tt.want {
+			t.Errorf("%s: %s contains %q = %v, want %v", tt.name, tt.file, tt.text, got, tt.want)
+		}
+	}
+	if _, ok := files["media/their-photo.png"]; ok {
+		t.Error("the image of another user's post was exported")
+	}
+}
+
+func TestExportSweeper(t *testing.T) {
+	dbtest.Open(t)
+	useExportDirs(t)
+	dbtest.User(t, "u-me", "me", "me@test.local", true)
+	now := time.Now()
+	for _, e := range []struct {
+		id      string
+		status  string
+		expires interface{}
+	}{
+		{"x-expired", "ready", now.Add(-time.Minute)},
+		{"x-ready", "ready", now.Add(time.Hour)},
+		{"x-pending", "pending", nil},
+		{"x-running", "running", nil},
+	} {
+		if _, err := db.DB.Exec("INSERT INTO data_exports (id, user_id, status, created_at, expires_at) VALUES (?, 'u-me', ?, ?, ?)",
+			e.id, e.status, now.Add(-2*time.Hour), e.expires); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(archivePath(e.id), []byte("zip"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The sweeper purges once right away, then waits for the interval.
+	StartSweeper(time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for dbtest.Exists(t, "SELECT 1 FROM data_exports WHERE id = 'x-expired'") {
+		if time.Now().After(deadline) {
+			t.Fatal("the sweeper did not remove the expired export")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		id         string
+		wantStatus string
+		wantFile   bool
+	}{
+		{"x-expired", "", false},
+		{"x-ready", "ready", true},
+		{"x-pending", "failed", true},
+		{"x-running", "failed", true},
+	}
+	for _, tt := range tests {
+		var status string
+		db.DB.QueryRow("SELECT status FROM data_exports WHERE id = ?", tt.id).Scan(&status)
+		if status != tt.wantStatus {
+			t.Errorf("%s: status = %q, want %q", tt.id, status, tt.wantStatus)
+		}
+		if _, err := os.Stat(archivePath(tt.id)); (err == nil) != tt.wantFile {
+			t.Errorf("%s: archive exists = %v, want %v", tt.id, err == nil, tt.wantFile)
+		}
+	}
+}
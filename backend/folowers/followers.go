@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 
+	"social-net/audit"
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
 	"social-net/notification"
@@ -15,27 +17,17 @@ import (
 )
 
 func SendJSON(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		logger.LogError("Failed to get token", err)
-		return
-	}
-	userID, ok := session.GetUserIDFromToken(token.Value)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	action := r.URL.Query().Get("action")
 	username := r.URL.Query().Get("profileUser")
@@ -225,6 +217,7 @@ func SendJSON(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Error rejecting invitation", http.StatusInternalServerError)
 			return
 		}
+		audit.Log(r, userID, "follow_request_rejected", "user", followedID, nil)
 		w.WriteHeader(http.StatusOK)
 
 	default:
@@ -6,29 +6,35 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
+	"social-net/auth"
+	"social-net/config"
 	"social-net/db"
+	"social-net/reactions"
 	"social-net/session"
+	"social-net/tags"
 
 	"github.com/gofrs/uuid"
 )
 
 type GroupComment struct {
-	ID           string    `json:"id"`
-	GroupPostID  string    `json:"group_post_id"`
-	Author       string    `json:"author"`
-	Content      string    `json:"content"`
-	Avatar       string    `json:"avatar"`
-	Image        string    `json:"image"`
-	CreationDate time.Time `json:"creation_date"`
+	ID           string            `json:"id"`
+	GroupPostID  string            `json:"group_post_id"`
+	Author       string            `json:"author"`
+	Content      string            `json:"content"`
+	Avatar       string            `json:"avatar"`
+	Image        string            `json:"image"`
+	CreationDate time.Time         `json:"creation_date"`
+	Reactions    reactions.Summary `json:"reactions"`
 }
 
 func AddGroupComment(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -38,7 +44,7 @@ func AddGroupComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := r.ParseMultipartForm(10 << 20)
+	err := r.ParseMultipartForm(config.Current.MaxRequestSize)
 	if err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		fmt.Println("Failed to parse form:", err)
@@ -63,14 +69,8 @@ func AddGroupComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
-	userid, ok := session.GetUserIDFromToken(token.Value)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
+	userid := session.CurrentUserID(r)
+	if !auth.RequireVerified(w, userid) {
 		return
 	}
 	username, _ := session.GetUsernameFromUserID(userid)
@@ -85,7 +85,7 @@ func AddGroupComment(w http.ResponseWriter, r *http.Request) {
 	if err == nil && handler != nil {
 		defer file.Close()
 		imageFilename = fmt.Sprintf("%s_%s", commentID.String(), handler.Filename)
-		dst, err := os.Create("./uploads/" + imageFilename)
+		dst, err := os.Create(filepath.Join(config.Current.UploadsDir, imageFilename))
 		if err != nil {
 			http.Error(w, "Failed to save image", http.StatusInternalServerError)
 			return
@@ -106,29 +106,20 @@ func AddGroupComment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to insert comment", http.StatusInternalServerError)
 		return
 	}
+	tags.Index("group_comment", commentID.String(), userid, commentText)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Group comment created successfully"})
 }
 
 func GetGroupComments(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
-	_, ok := session.GetUserIDFromToken(token.Value)
-	if !ok {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
 	groupPostID := r.URL.Query().Get("group_post_id")
 	if groupPostID == "" {
 		http.Error(w, "Missing group_post_id parameter", http.StatusBadRequest)
@@ -156,6 +147,15 @@ func GetGroupComments(w http.ResponseWriter, r *http.Request) {
 		}
 		comments = append(comments, c)
 	}
+
+	ids := make([]string, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	summaries := reactions.LoadOrEmpty("group_comment", ids, session.CurrentUserID(r))
+	for i := range comments {
+		comments[i].Reactions = summaries.For(comments[i].ID)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
 }
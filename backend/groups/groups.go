@@ -12,11 +12,15 @@ import (
 	"strings"
 	"time"
 
+	"social-net/audit"
+	"social-net/auth"
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
 	"social-net/notification"
-
+	"social-net/reactions"
 	"social-net/session"
+	"social-net/tags"
 
 	"github.com/gofrs/uuid"
 )
@@ -36,22 +40,23 @@ type GroupMember struct {
 }
 
 type GroupPost struct {
-	ID           string    `json:"id"`
-	Title        string    `json:"title"`
-	GroupID      string    `json:"group_id"`
-	UserID       string    `json:"user_id"`
-	Author       string    `json:"author"`
-	Content      string    `json:"content"`
-	Image        string    `json:"image"`
-	CreationDate time.Time `json:"creation_date"`
-	Avatar       string    `json:"avatar"`
+	ID           string            `json:"id"`
+	Title        string            `json:"title"`
+	GroupID      string            `json:"group_id"`
+	UserID       string            `json:"user_id"`
+	Author       string            `json:"author"`
+	Content      string            `json:"content"`
+	Image        string            `json:"image"`
+	CreationDate time.Time         `json:"creation_date"`
+	Avatar       string            `json:"avatar"`
+	Reactions    reactions.Summary `json:"reactions"`
 }
 
 func CreateGroup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -87,13 +92,7 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 		INSERT INTO groups (id,creator_id, title, description)
 		VALUES ($1, $2, $3,$4)
 	`
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userid, ok := session.GetUserIDFromToken(tok)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userid := session.CurrentUserID(r)
 	groupID, err := uuid.NewV7()
 	if err != nil {
 		fmt.Println("Failed to generate group ID", err)
@@ -122,10 +121,10 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetGroup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -165,10 +164,10 @@ func GetGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func AddMemberToGroup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -186,13 +185,7 @@ func AddMemberToGroup(w http.ResponseWriter, r *http.Request) {
 		Status  string `json:"status"`
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userid, ok := session.GetUserIDFromToken(tok)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userid := session.CurrentUserID(r)
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		logger.LogError("Invalid request", err)
@@ -281,10 +274,10 @@ func AddMemberToGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func AcceptGroupMember(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -315,6 +308,7 @@ func AcceptGroupMember(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to accept group member", http.StatusInternalServerError)
 		return
 	}
+	audit.Log(r, session.CurrentUserID(r), "group_member_accepted", "group", request.GroupID, audit.Meta{"user_id": request.UserID})
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Member accepted successfully"))
@@ -368,10 +362,10 @@ func GetAcceptedMembers(db *sql.DB, groupID int) ([]int, error) {
 }
 
 func RemoveMemberFromGroup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -394,13 +388,7 @@ func RemoveMemberFromGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userid, ok := session.GetUserIDFromToken(tok)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userid := session.CurrentUserID(r)
 
 	var isOwner bool
 	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = $1 AND creator_id = $2)", request.GroupID, userid).Scan(&isOwner)
@@ -434,6 +422,11 @@ func RemoveMemberFromGroup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Member not found in group or is Owner", http.StatusNotFound)
 		return
 	}
+	action := "group_member_removed"
+	if request.UserID == userid {
+		action = "group_left"
+	}
+	audit.Log(r, userid, action, "group", request.GroupID, audit.Meta{"user_id": request.UserID})
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Member removed successfully"))
@@ -460,10 +453,10 @@ func GetGroupMembers(db *sql.DB, groupID int) ([]int, error) {
 }
 
 func GetGroups(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -475,17 +468,7 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-	tok := token.Value
-	currentUserID, ok := session.GetUserIDFromToken(tok)
-	if !ok || currentUserID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	currentUserID := session.CurrentUserID(r)
 
 	query := `
 		SELECT 
@@ -531,18 +514,12 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 }
 
 func MyGroups(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userid, ok := session.GetUserIDFromToken(tok)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userid := session.CurrentUserID(r)
 
 	query := `
 		SELECT g.id, g.creator_id, g.title, g.description, 
@@ -581,13 +558,7 @@ func MyGroups(w http.ResponseWriter, r *http.Request) {
 }
 
 func ShowRequests(w http.ResponseWriter, r *http.Request) {
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userid, ok := session.GetUserIDFromToken(tok)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userid := session.CurrentUserID(r)
 
 	query := "SELECT id, creator_id, title, description FROM groups WHERE creator_id = $1"
 	rows, err := db.DB.Query(query, userid)
@@ -615,18 +586,12 @@ func ShowRequests(w http.ResponseWriter, r *http.Request) {
 func GetPendingInvitations(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("=== GetPendingInvitations called ===")
 
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	if userID == "" {
 		fmt.Println("Error: Unauthorized - Invalid user ID")
@@ -690,23 +655,17 @@ func GetPendingInvitations(w http.ResponseWriter, r *http.Request) {
 }
 
 func HandleInvitation(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	var request struct {
 		GroupID string `json:"group_id"`
@@ -760,10 +719,10 @@ func HandleInvitation(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetGroupInvitations(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	groupID := r.URL.Query().Get("group_id")
 	if groupID == "" {
@@ -808,10 +767,10 @@ func GetGroupInvitations(w http.ResponseWriter, r *http.Request) {
 }
 
 func HandleGroupInvitation(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	var request struct {
 		GroupID string `json:"group_id"`
@@ -853,6 +812,7 @@ func HandleGroupInvitation(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No pending invitation found", http.StatusNotFound)
 		return
 	}
+	audit.Log(r, session.CurrentUserID(r), "group_request_"+status, "group", request.GroupID, audit.Meta{"user_id": request.UserID})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -861,23 +821,17 @@ func HandleGroupInvitation(w http.ResponseWriter, r *http.Request) {
 }
 
 func IsGroupMember(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	groupID := r.URL.Query().Get("group_id")
 	if groupID == "" {
@@ -915,10 +869,10 @@ func IsGroupMember(w http.ResponseWriter, r *http.Request) {
 }
 
 func CheckGroupMembershipStatus(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -926,13 +880,7 @@ func CheckGroupMembershipStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	groupID := r.URL.Query().Get("group_id")
-	token, _ := r.Cookie("token")
-	tokenValue := token.Value
-	userID, ok := session.GetUserIDFromToken(tokenValue)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	if groupID == "" || userID == "" {
 		http.Error(w, "Missing group_id or user_id", http.StatusBadRequest)
@@ -965,10 +913,10 @@ func CheckGroupMembershipStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func AddGroupPost(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -987,11 +935,8 @@ func AddGroupPost(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println("Group ID:", groupID)
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
+	userID := session.CurrentUserID(r)
+	if !auth.RequireVerified(w, userID) {
 		return
 	}
 
@@ -1046,6 +991,7 @@ func AddGroupPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to insert post into database", http.StatusInternalServerError)
 		return
 	}
+	tags.Index("group_post", post_id.String(), userID, post.Title+"\n"+post.Content)
 
 	w.WriteHeader(http.StatusCreated)
 }
@@ -1079,7 +1025,7 @@ func saveBase64Image(base64Data, postID string) (string, error) {
 		return "", fmt.Errorf("failed to decode base64 image: %v", err)
 	}
 
-	uploadsDir := "./uploads"
+	uploadsDir := config.Current.UploadsDir
 	if err := os.MkdirAll(uploadsDir, 0o755); err != nil {
 		return "", fmt.Errorf("failed to create uploads directory: %v", err)
 	}
@@ -1102,10 +1048,10 @@ func saveBase64Image(base64Data, postID string) (string, error) {
 }
 
 func GetGroupPosts(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
@@ -1160,10 +1106,19 @@ func GetGroupPosts(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if imageFilename.Valid && imageFilename.String != "" {
-			post.Image = fmt.Sprintf("http://localhost:8080/uploads/%s", imageFilename.String)
+			post.Image = config.Current.UploadURL(imageFilename.String)
 		}
 		posts = append(posts, post)
 	}
+
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	summaries := reactions.LoadOrEmpty("group_post", ids, session.CurrentUserID(r))
+	for i := range posts {
+		posts[i].Reactions = summaries.For(posts[i].ID)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(posts); err != nil {
 		log.Println("[GetGroupPosts] JSON encode error:", err)
@@ -1172,23 +1127,17 @@ func GetGroupPosts(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetUserPendingInvitations(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	query := `
 		SELECT g.id, g.title, g.description, u.username, gm.status
@@ -1230,10 +1179,10 @@ func GetUserPendingInvitations(w http.ResponseWriter, r *http.Request) {
 }
 
 func RequestToJoinGroup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -1255,13 +1204,7 @@ func RequestToJoinGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	if request.GroupID == "" {
 		http.Error(w, "Group ID is required", http.StatusBadRequest)
@@ -1342,10 +1285,10 @@ func RequestToJoinGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetGroupMemberStatuses(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -1387,10 +1330,10 @@ func GetGroupMemberStatuses(w http.ResponseWriter, r *http.Request) {
 }
 
 func CancelGroupRequest(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -1412,13 +1355,7 @@ func CancelGroupRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	result, err := db.DB.Exec("DELETE FROM group_members WHERE group_id = $1 AND user_id = $2 AND status = 'pending'", request.GroupID, userID)
 	if err != nil {
@@ -0,0 +1,54 @@
+package groups
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestGroupPostingRequiresVerifiedEmail(t *testing.T) {
+	dbtest.Open(t)
+	verified := dbtest.User(t, "u-verified", "verified", "verified@test.local", true)
+	unverified := dbtest.User(t, "u-unverified", "unverified", "unverified@test.local", false)
+	dbtest.Exec(t,
+		"INSERT INTO groups (id, creator_id, title, description) VALUES ('g-test', 'u-verified', 'Test', '')",
+		"INSERT INTO group_members (group_id, user_id, status, is_admin) VALUES ('g-test', 'u-verified', 'accepted', 1), ('g-test', 'u-unverified', 'accepted', 0)",
+		"INSERT INTO group_posts (id, group_id, user_id, title, content, creation_date) VALUES ('gp-open', 'g-test', 'u-verified', 'Hi', '', CURRENT_TIMESTAMP)",
+	)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		request func(userID string) *http.Request
+		// written finds what the request stores, with ? for the user.
+		written string
+		want    int
+	}{
+		{"group post", AddGroupPost, func(userID string) *http.Request {
+			return dbtest.SignedIn(t, http.MethodPost, "/api/groups/posts?group_id=g-test", strings.NewReader(`{"title": "Fresh", "content": "Fresh"}`), userID)
+		}, "SELECT 1 FROM group_posts WHERE user_id = ? AND title = 'Fresh'", http.StatusCreated},
+		{"group comment", AddGroupComment, func(userID string) *http.Request {
+			return dbtest.SignedInForm(t, "/api/groups/comments", map[string]string{"group_post_id": "gp-open", "content": "By " + userID}, userID)
+		}, "SELECT 1 FROM group_comments WHERE content = 'By ' || ?", http.StatusOK},
+	}
+	for _, tt := range tests {
+		for _, user := range []struct {
+			id   string
+			want int
+		}{{unverified, http.StatusForbidden}, {verified, tt.want}} {
+			w := httptest.NewRecorder()
+			session.RequireAuth(tt.handler)(w, tt.request(user.id))
+			if w.Code != user.want {
+				t.Errorf("%s by %s: status = %d, want %d: %s", tt.name, user.id, w.Code, user.want, w.Body)
+			}
+			query := strings.Replace(tt.written, "?", "'"+user.id+"'", 1)
+			if got := dbtest.Exists(t, query); got != (user.id == verified) {
+				t.Errorf("%s by %s: stored = %v", tt.name, user.id, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package groups
+
+import (
+	"social-net/db"
+	"social-net/reactions"
+	"social-net/session"
+)
+
+// canSeeGroup reports whether userID is the creator or an accepted member of
+// the group.
+func canSeeGroup(userID string, groupID string) bool {
+	var ok bool
+	err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM groups WHERE id = ?1 AND creator_id = ?2)
+		OR EXISTS(SELECT 1 FROM group_members WHERE group_id = ?1 AND user_id = ?2 AND status = 'accepted')`, groupID, userID).Scan(&ok)
+	return err == nil && ok
+}
+
+func init() {
+	reactions.RegisterTarget("group_post", reactions.Target{
+		Noun: "group post",
+		Author: func(id string) (string, error) {
+			var userID string
+			err := db.DB.QueryRow("SELECT user_id FROM group_posts WHERE id = ?", id).Scan(&userID)
+			return userID, err
+		},
+		CanSee: func(userID string, id string) bool {
+			var groupID string
+			if err := db.DB.QueryRow("SELECT group_id FROM group_posts WHERE id = ?", id).Scan(&groupID); err != nil {
+				return false
+			}
+			return canSeeGroup(userID, groupID)
+		},
+	})
+	// Group comments store their author's username; reactions need the id.
+	reactions.RegisterTarget("group_comment", reactions.Target{
+		Noun: "comment",
+		Author: func(id string) (string, error) {
+			var author string
+			if err := db.DB.QueryRow("SELECT author FROM group_comments WHERE id = ?", id).Scan(&author); err != nil {
+				return "", err
+			}
+			return session.GetUserIDFromUsername(author)
+		},
+		CanSee: func(userID string, id string) bool {
+			var groupID string
+			err := db.DB.QueryRow("SELECT p.group_id FROM group_comments c JOIN group_posts p ON p.id = c.group_post_id WHERE c.id = ?", id).Scan(&groupID)
+			return err == nil && canSeeGroup(userID, groupID)
+		},
+	})
+}
@@ -0,0 +1,97 @@
+package groups
+
+import (
+	"database/sql"
+
+	"social-net/db"
+	"social-net/utils"
+)
+
+// RemoveGroup deletes a group with everything posted in it: posts, comments,
+// events and their responses, chat messages, memberships and the images.
+// It returns sql.ErrNoRows for an unknown group.
+func RemoveGroup(groupID string) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = ?)", groupID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	files, err := utils.UploadNames(`SELECT image FROM group_posts WHERE group_id = ?1
+		UNION ALL SELECT image FROM group_comments WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)`, groupID)
+	if err != nil {
+		return err
+	}
+	queries := append(utils.TargetCleanup("group_comment", "SELECT c.id FROM group_comments c JOIN group_posts p ON p.id = c.group_post_id WHERE p.group_id = ?"),
+		utils.TargetCleanup("group_post", "SELECT id FROM group_posts WHERE group_id = ?")...)
+	err = utils.ExecAll(append(queries,
+		"DELETE FROM group_comments WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?)",
+		"DELETE FROM group_posts WHERE group_id = ?",
+		"DELETE FROM event_responses WHERE event_id IN (SELECT id FROM events WHERE group_id = ?)",
+		"DELETE FROM events WHERE group_id = ?",
+		"DELETE FROM group_messages WHERE group_id = ?",
+		"DELETE FROM group_members WHERE group_id = ?",
+		"DELETE FROM notifications WHERE related_entity_id = ?",
+		"DELETE FROM groups WHERE id = ?",
+	), groupID)
+	if err != nil {
+		return err
+	}
+	utils.RemoveUploads(files)
+	return nil
+}
+
+// RemoveGroupPost deletes a group post, its comments, what references them,
+// its notifications and their images.
+func RemoveGroupPost(postID string) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM group_posts WHERE id = ?)", postID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	files, err := utils.UploadNames("SELECT image FROM group_posts WHERE id = ?1 UNION ALL SELECT image FROM group_comments WHERE group_post_id = ?1", postID)
+	if err != nil {
+		return err
+	}
+	queries := append(utils.TargetCleanup("group_comment", "SELECT id FROM group_comments WHERE group_post_id = ?"), utils.TargetCleanup("group_post", "?")...)
+	err = utils.ExecAll(append(queries,
+		"DELETE FROM group_comments WHERE group_post_id = ?",
+		"DELETE FROM notifications WHERE related_entity_id = ?",
+		"DELETE FROM group_posts WHERE id = ?",
+	), postID)
+	if err != nil {
+		return err
+	}
+	utils.RemoveUploads(files)
+	return nil
+}
+
+// RemoveGroupComment deletes a comment on a group post with its reactions,
+// hashtags and mentions, then its image.
+func RemoveGroupComment(commentID string) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM group_comments WHERE id = ?)", commentID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	files, err := utils.UploadNames("SELECT image FROM group_comments WHERE id = ?", commentID)
+	if err != nil {
+		return err
+	}
+	err = utils.ExecAll(append(utils.TargetCleanup("group_comment", "?"),
+		"DELETE FROM group_comments WHERE id = ?",
+	), commentID)
+	if err != nil {
+		return err
+	}
+	utils.RemoveUploads(files)
+	return nil
+}
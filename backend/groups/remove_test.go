@@ -0,0 +1,57 @@
+package groups
+
+import (
+	"database/sql"
+	"testing"
+
+	"social-net/db/dbtest"
+)
+
+func TestRemoveGroupContent(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.User(t, "u-owner", "owner", "owner@test.local", true)
+	dbtest.Exec(t,
+		"INSERT INTO groups (id, creator_id, title, description) VALUES ('g-test', 'u-owner', 'Group', '')",
+		"INSERT INTO group_posts (id, group_id, user_id, title, content, creation_date) VALUES ('gp-removed', 'g-test', 'u-owner', 'Post', '', CURRENT_TIMESTAMP), ('gp-kept', 'g-test', 'u-owner', 'Post', '', CURRENT_TIMESTAMP)",
+		"INSERT INTO group_comments (id, group_post_id, author, content, creation_date) VALUES ('gc-on-removed', 'gp-removed', 'owner', 'Hi', CURRENT_TIMESTAMP), ('gc-removed', 'gp-kept', 'owner', 'Hi', CURRENT_TIMESTAMP)",
+		`INSERT INTO reactions (id, target_type, target_id, user_id, reaction, created_at) VALUES
+			('r-removed-post', 'group_post', 'gp-removed', 'u-owner', 'like', CURRENT_TIMESTAMP),
+			('r-on-removed', 'group_comment', 'gc-on-removed', 'u-owner', 'like', CURRENT_TIMESTAMP),
+			('r-removed-comment', 'group_comment', 'gc-removed', 'u-owner', 'like', CURRENT_TIMESTAMP)`,
+		"INSERT INTO mentions (target_type, target_id, user_id, author_id, created_at) VALUES ('group_comment', 'gc-removed', 'u-owner', 'u-owner', CURRENT_TIMESTAMP)",
+		"INSERT INTO notifications (id, user_id, sender_id, type, content, related_entity_id) VALUES ('n-removed-post', 'u-owner', 'u-owner', 'group_post', '', 'gp-removed')",
+	)
+
+	if err := RemoveGroupPost("gp-removed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveGroupComment("gc-removed"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"removed post", "SELECT 1 FROM group_posts WHERE id = 'gp-removed'", false},
+		{"its comments", "SELECT 1 FROM group_comments WHERE id = 'gc-on-removed'", false},
+		{"reactions on the post and its comments", "SELECT 1 FROM reactions WHERE id IN ('r-removed-post', 'r-on-removed')", false},
+		{"its notifications", "SELECT 1 FROM notifications WHERE id = 'n-removed-post'", false},
+		{"removed comment", "SELECT 1 FROM group_comments WHERE id = 'gc-removed'", false},
+		{"reactions on the comment", "SELECT 1 FROM reactions WHERE id = 'r-removed-comment'", false},
+		{"mentions in the comment", "SELECT 1 FROM mentions WHERE target_id = 'gc-removed'", false},
+		{"other post", "SELECT 1 FROM group_posts WHERE id = 'gp-kept'", true},
+	}
+	for _, tt := range tests {
+		if got := dbtest.Exists(t, tt.query); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, remove := range []func(string) error{RemoveGroupPost, RemoveGroupComment, RemoveGroup} {
+		if err := remove("missing"); err != sql.ErrNoRows {
+			t.Errorf("removing an unknown row: err = %v, want sql.ErrNoRows", err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package groups
+
+import "social-net/search"
+
+// Groups are listed to everyone; what is posted in them only to members.
+func init() {
+	search.RegisterType("group", func(userID string) (string, []interface{}) {
+		return "1 = 1", nil
+	})
+	search.RegisterType("group_post", func(userID string) (string, []interface{}) {
+		groups, args := MemberGroups(userID)
+		return "d.parent_id IN (" + groups + ")", args
+	})
+}
+
+// MemberGroups is canSeeGroup as a subquery selecting the ids of the groups
+// userID created or was accepted into.
+func MemberGroups(userID string) (string, []interface{}) {
+	return "SELECT id FROM groups WHERE creator_id = ? UNION SELECT group_id FROM group_members WHERE user_id = ? AND status = 'accepted'",
+		[]interface{}{userID, userID}
+}
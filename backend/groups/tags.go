@@ -0,0 +1,37 @@
+package groups
+
+import (
+	"social-net/db"
+	"social-net/tags"
+)
+
+func init() {
+	tags.RegisterTarget("group_post", tags.Target{
+		Noun: "group post",
+		CanSee: func(userID string, id string) bool {
+			var groupID string
+			if err := db.DB.QueryRow("SELECT group_id FROM group_posts WHERE id = ?", id).Scan(&groupID); err != nil {
+				return false
+			}
+			return canSeeGroup(userID, groupID)
+		},
+		Preview: func(id string) (tags.Preview, error) {
+			var p tags.Preview
+			err := db.DB.QueryRow("SELECT group_id, content FROM group_posts WHERE id = ?", id).Scan(&p.ParentID, &p.Text)
+			return p, err
+		},
+	})
+	tags.RegisterTarget("group_comment", tags.Target{
+		Noun: "comment",
+		CanSee: func(userID string, id string) bool {
+			var groupID string
+			err := db.DB.QueryRow("SELECT p.group_id FROM group_comments c JOIN group_posts p ON p.id = c.group_post_id WHERE c.id = ?", id).Scan(&groupID)
+			return err == nil && canSeeGroup(userID, groupID)
+		},
+		Preview: func(id string) (tags.Preview, error) {
+			var p tags.Preview
+			err := db.DB.QueryRow("SELECT group_post_id, content FROM group_comments WHERE id = ?", id).Scan(&p.ParentID, &p.Text)
+			return p, err
+		},
+	})
+}
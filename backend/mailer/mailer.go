@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"social-net/config"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// Default is used by the handlers that send mail. It only logs messages
+// until main replaces it with FromConfig.
+var Default Mailer = LogMailer{}
+
+// FromConfig talks SMTP when an SMTP host is configured and only logs the
+// message otherwise, which is enough for local development.
+func FromConfig(c *config.Config) Mailer {
+	if c.SMTPHost == "" {
+		return LogMailer{}
+	}
+	return &SMTPMailer{
+		Host:     c.SMTPHost,
+		Port:     strconv.Itoa(c.SMTPPort),
+		Username: c.SMTPUsername,
+		Password: c.SMTPPassword,
+		From:     c.SMTPFrom,
+	}
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+		"\r\n" + body + "\r\n"
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := smtp.SendMail(addr, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", to, err)
+	}
+	return nil
+}
+
+type LogMailer struct{}
+
+func (LogMailer) Send(to string, subject string, body string) error {
+	log.Printf("[mailer] To: %s | Subject: %s\n%s", to, subject, body)
+	return nil
+}
@@ -3,89 +3,152 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
+	"social-net/admin"
+	"social-net/audit"
 	"social-net/auth"
+	"social-net/bookmarks"
 	"social-net/comments"
+	"social-net/config"
 	"social-net/db"
 	"social-net/events"
+	"social-net/export"
 	"social-net/folowers"
 	"social-net/groups"
+	"social-net/mailer"
 	"social-net/messages"
 	"social-net/notification"
 	"social-net/posts"
 	"social-net/profile"
+	"social-net/reactions"
+	"social-net/search"
 	"social-net/session"
+	"social-net/tags"
 	"social-net/utils"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
-	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
+	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(cfg.UploadsDir))))
 
+	mailer.Default = mailer.FromConfig(cfg)
+	auth.LoadOIDCProviders()
 	db.Initdb()
+	search.Init()
+	admin.PromoteConfigured()
+	session.StartSweeper(cfg.SessionSweepInterval)
+	auth.StartDeletionSweeper(cfg.AccountDeletionSweepInterval)
+	export.StartSweeper(cfg.ExportSweepInterval)
 
+	// Handlers behind session.RequireAuth read the caller with
+	// session.CurrentUser; the others are public.
 	http.HandleFunc("/api/auth/", auth.Auth)
 	http.HandleFunc("/middle", session.Middleware)
-	http.HandleFunc("/api/info", auth.Getinfo)
-
-	http.HandleFunc("/api/userinfo", profile.GetUserInfo)
-	http.HandleFunc("/api/updateprivacy", profile.UpdatePrivacy)
-	http.HandleFunc("/api/setprivacy", profile.UpdatePrivacy)
-	http.HandleFunc("/api/ownposts", profile.GetOwnPosts)
-	http.HandleFunc("/api/isfollowing", profile.IsFollowing)
-	http.HandleFunc("/api/followers", folowers.SendJSON)
-	http.HandleFunc("/api/getfollowingfolowers", profile.GetFollowersAndFollowing)
-	http.HandleFunc("/api/postsprivacy", profile.GetFollowersAndFollowingPosts)
-	http.HandleFunc("/api/checkmyprivacy", profile.CheckMyPrivacy)
-	http.HandleFunc("/api/getinvitationsfollow", profile.GetInvitationsFollow)
-	http.HandleFunc("/api/accepteinvi", profile.AcceptInvitation)
-
-	http.HandleFunc("/api/posts", posts.Post)
-	http.HandleFunc("/api/getposts", posts.Getposts)
-	http.HandleFunc("/api/getcomments", comments.Getcomments)
-	http.HandleFunc("/api/addcomments", comments.AddComments)
-
-	http.HandleFunc("/api/getmessages", messages.GetMessages)
-	http.HandleFunc("/api/messages", messages.GetMessages)
-	http.HandleFunc("/ws", messages.Handleconnections)
-	http.HandleFunc("/api/openchat", messages.OpenChat)
-
-	http.HandleFunc("/api/creategroups", groups.CreateGroup)
-	http.HandleFunc("/api/getgroups", groups.GetGroups)
-	http.HandleFunc("/api/addmembertogroup", groups.AddMemberToGroup)
-	http.HandleFunc("/api/requesttojoingroup", groups.RequestToJoinGroup)
-	http.HandleFunc("/api/removememberfromgroup", groups.RemoveMemberFromGroup)
-	http.HandleFunc("/api/acceptgroupmember", groups.AcceptGroupMember)
-	http.HandleFunc("/api/cancelgrouprequest", groups.CancelGroupRequest)
-	http.HandleFunc("/api/mygroups", groups.MyGroups)
-	http.HandleFunc("/api/pendinginvitations", groups.GetPendingInvitations)
-	http.HandleFunc("/api/handleinvitation", groups.HandleInvitation)
-	http.HandleFunc("/api/GetInvitations", groups.GetPendingInvitations)
-	http.HandleFunc("/api/ismember", groups.IsGroupMember)
-	http.HandleFunc("/api/checkmem", groups.CheckGroupMembershipStatus)
-	http.HandleFunc("/api/acceptgroupinvite", groups.HandleInvitation)
-	http.HandleFunc("/api/declinegroupinvite", groups.HandleInvitation)
-	http.HandleFunc("/api/groupcomments/add", groups.AddGroupComment)
-	http.HandleFunc("/api/groupcomments", groups.GetGroupComments)
-	http.HandleFunc("/api/user/pendinginvites", groups.GetUserPendingInvitations)
-	http.HandleFunc("/api/groupmembers/status", groups.GetGroupMemberStatuses)
-
-	http.HandleFunc("/api/groupposts", groups.GetGroupPosts)
-	http.HandleFunc("/api/groupposts/add", groups.AddGroupPost)
-
-	http.HandleFunc("/api/postsprv", posts.PostPrivacy)
-	http.HandleFunc("/api/events", events.GetEvents)
-	http.HandleFunc("/api/events/add", events.CreateEvent)
-	http.HandleFunc("/api/notifications", notification.GetNotifications)
-	http.HandleFunc("/api/markasread", notification.MarkNotificationAsRead)
-	http.HandleFunc("/api/events/join", events.JoinEvent)
-
-	http.HandleFunc("/ws/group/", messages.HandleGroupWebSocket)
-	http.HandleFunc("/ws/notifications", notification.HandleNotificationWebSocket)
-
-	http.HandleFunc("/api/allusers", utils.Users)
+	http.HandleFunc("/api/csrf", session.CSRFToken)
+	http.HandleFunc("/api/info", session.RequireAuth(auth.Getinfo))
+	http.HandleFunc("/api/sessions", session.RequireAuth(session.ListSessions))
+	http.HandleFunc("/api/sessions/revoke", session.RequireAuth(session.RevokeSession))
+	http.HandleFunc("/api/audit", session.RequireAuth(audit.MyEvents))
+	http.HandleFunc("/api/tokens", session.RequireAuth(session.AccessTokens))
+	http.HandleFunc("/api/tokens/revoke", session.RequireAuth(session.RevokeAccessTokenHandler))
+	http.HandleFunc("/api/account/profile", session.RequireAuth(auth.UpdateProfile))
+	http.HandleFunc("/api/account/password", session.RequireAuth(auth.ChangePassword))
+	http.HandleFunc("/api/account/email", session.RequireAuth(auth.ChangeEmail))
+	http.HandleFunc("/api/account/username", session.RequireAuth(auth.ChangeUsername))
+	http.HandleFunc("/api/account/delete", session.RequireAuth(auth.DeleteAccount))
+	http.HandleFunc("/api/account/delete/cancel", session.RequireAuth(auth.CancelAccountDeletion))
+	http.HandleFunc("/api/export", session.RequireAuth(export.RequestExport))
+	http.HandleFunc("/api/export/status", session.RequireAuth(export.ExportStatus))
+	http.HandleFunc("/api/export/download", session.RequireAuth(export.DownloadExport))
+
+	http.HandleFunc("/api/admin/users", session.RequireAuth(admin.ListUsers))
+	http.HandleFunc("/api/admin/users/suspend", session.RequireAuth(admin.SuspendUser))
+	http.HandleFunc("/api/admin/users/ban", session.RequireAuth(admin.BanUser))
+	http.HandleFunc("/api/admin/users/unban", session.RequireAuth(admin.UnbanUser))
+	http.HandleFunc("/api/admin/users/role", session.RequireAuth(admin.SetRole))
+	http.HandleFunc("/api/admin/content/delete", session.RequireAuth(admin.DeleteContent))
+	http.HandleFunc("/api/admin/stats", session.RequireAuth(admin.Stats))
+	http.HandleFunc("/api/admin/audit", session.RequireAuth(admin.AuditLog))
+
+	http.HandleFunc("/api/userinfo", session.RequireAuth(profile.GetUserInfo))
+	http.HandleFunc("/api/updateprivacy", session.RequireAuth(profile.UpdatePrivacy))
+	http.HandleFunc("/api/setprivacy", session.RequireAuth(profile.UpdatePrivacy))
+	http.HandleFunc("/api/ownposts", session.RequireAuth(profile.GetOwnPosts))
+	http.HandleFunc("/api/isfollowing", session.RequireAuth(profile.IsFollowing))
+	http.HandleFunc("/api/followers", session.RequireAuth(folowers.SendJSON))
+	http.HandleFunc("/api/getfollowingfolowers", session.RequireAuth(profile.GetFollowersAndFollowing))
+	http.HandleFunc("/api/postsprivacy", session.RequireAuth(profile.GetFollowersAndFollowingPosts))
+	http.HandleFunc("/api/checkmyprivacy", session.RequireAuth(profile.CheckMyPrivacy))
+	http.HandleFunc("/api/getinvitationsfollow", session.RequireAuth(profile.GetInvitationsFollow))
+	http.HandleFunc("/api/accepteinvi", session.RequireAuth(profile.AcceptInvitation))
+
+	http.HandleFunc("/api/posts", session.RequireAuth(posts.Post))
+	http.HandleFunc("/api/getposts", session.RequireAuth(posts.Getposts))
+	http.HandleFunc("/api/posts/edit", session.RequireAuth(posts.EditPost))
+	http.HandleFunc("/api/posts/delete", session.RequireAuth(posts.DeletePost))
+	http.HandleFunc("/api/posts/revisions", session.RequireAuth(posts.PostRevisions))
+	http.HandleFunc("/api/posts/repost", session.RequireAuth(posts.Repost))
+	http.HandleFunc("/api/getcomments", session.RequireAuth(comments.Getcomments))
+	http.HandleFunc("/api/addcomments", session.RequireAuth(comments.AddComments))
+	http.HandleFunc("/api/reactions", session.RequireAuth(reactions.React))
+	http.HandleFunc("/api/hashtags", session.RequireAuth(posts.PostsByHashtag))
+	http.HandleFunc("/api/mentions", session.RequireAuth(tags.MyMentions))
+	http.HandleFunc("/api/search", session.RequireAuth(search.Search))
+	http.HandleFunc("/api/bookmarks", session.RequireAuth(bookmarks.ListBookmarks))
+	http.HandleFunc("/api/bookmarks/add", session.RequireAuth(bookmarks.AddBookmark))
+	http.HandleFunc("/api/bookmarks/remove", session.RequireAuth(bookmarks.RemoveBookmark))
+	http.HandleFunc("/api/bookmarks/collections", session.RequireAuth(bookmarks.Collections))
+	http.HandleFunc("/api/bookmarks/collections/delete", session.RequireAuth(bookmarks.DeleteCollection))
+
+	http.HandleFunc("/api/getmessages", session.RequireAuth(messages.GetMessages))
+	http.HandleFunc("/api/messages", session.RequireAuth(messages.GetMessages))
+	http.HandleFunc("/ws", session.RequireAuth(messages.Handleconnections))
+	http.HandleFunc("/api/openchat", session.RequireAuth(messages.OpenChat))
+
+	http.HandleFunc("/api/creategroups", session.RequireAuth(groups.CreateGroup))
+	http.HandleFunc("/api/getgroups", session.RequireAuth(groups.GetGroups))
+	http.HandleFunc("/api/addmembertogroup", session.RequireAuth(groups.AddMemberToGroup))
+	http.HandleFunc("/api/requesttojoingroup", session.RequireAuth(groups.RequestToJoinGroup))
+	http.HandleFunc("/api/removememberfromgroup", session.RequireAuth(groups.RemoveMemberFromGroup))
+	http.HandleFunc("/api/acceptgroupmember", session.RequireAuth(groups.AcceptGroupMember))
+	http.HandleFunc("/api/cancelgrouprequest", session.RequireAuth(groups.CancelGroupRequest))
+	http.HandleFunc("/api/mygroups", session.RequireAuth(groups.MyGroups))
+	http.HandleFunc("/api/pendinginvitations", session.RequireAuth(groups.GetPendingInvitations))
+	http.HandleFunc("/api/handleinvitation", session.RequireAuth(groups.HandleInvitation))
+	http.HandleFunc("/api/GetInvitations", session.RequireAuth(groups.GetPendingInvitations))
+	http.HandleFunc("/api/ismember", session.RequireAuth(groups.IsGroupMember))
+	http.HandleFunc("/api/checkmem", session.RequireAuth(groups.CheckGroupMembershipStatus))
+	http.HandleFunc("/api/acceptgroupinvite", session.RequireAuth(groups.HandleInvitation))
+	http.HandleFunc("/api/declinegroupinvite", session.RequireAuth(groups.HandleInvitation))
+	http.HandleFunc("/api/groupcomments/add", session.RequireAuth(groups.AddGroupComment))
+	http.HandleFunc("/api/groupcomments", session.RequireAuth(groups.GetGroupComments))
+	http.HandleFunc("/api/user/pendinginvites", session.RequireAuth(groups.GetUserPendingInvitations))
+	http.HandleFunc("/api/groupmembers/status", session.RequireAuth(groups.GetGroupMemberStatuses))
+
+	http.HandleFunc("/api/groupposts", session.RequireAuth(groups.GetGroupPosts))
+	http.HandleFunc("/api/groupposts/add", session.RequireAuth(groups.AddGroupPost))
+
+	http.HandleFunc("/api/postsprv", session.RequireAuth(posts.PostPrivacy))
+	http.HandleFunc("/api/events", session.RequireAuth(events.GetEvents))
+	http.HandleFunc("/api/events/add", session.RequireAuth(events.CreateEvent))
+	http.HandleFunc("/api/notifications", session.RequireAuth(notification.GetNotifications))
+	http.HandleFunc("/api/markasread", session.RequireAuth(notification.MarkNotificationAsRead))
+	http.HandleFunc("/api/events/join", session.RequireAuth(events.JoinEvent))
+
+	http.HandleFunc("/ws/group/", session.RequireAuth(messages.HandleGroupWebSocket))
+	http.HandleFunc("/ws/notifications", session.RequireAuth(notification.HandleNotificationWebSocket))
+
+	http.HandleFunc("/api/allusers", session.RequireAuth(utils.Users))
+	http.HandleFunc("/api/users/search", session.RequireAuth(utils.SearchUsers))
 	http.HandleFunc("/api/getavatar", auth.GetAvatar)
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Println("Listening on", cfg.Addr())
+	log.Fatal(http.ListenAndServe(cfg.Addr(), session.CSRFProtect(http.DefaultServeMux)))
 }
@@ -9,6 +9,8 @@ import (
 	"sync"
 	"time"
 
+	"social-net/auth"
+	"social-net/config"
 	"social-net/db"
 	"social-net/notification"
 	"social-net/session"
@@ -22,7 +24,7 @@ var (
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		CheckOrigin: func(r *http.Request) bool {
-			return r.Header.Get("Origin") == "http://localhost:8081"
+			return config.OriginAllowed(r.Header.Get("Origin"))
 		},
 	}
 
@@ -30,6 +32,23 @@ var (
 	groupMutex       = &sync.Mutex{}
 )
 
+// A suspended user is dropped from every group chat they have open.
+func init() {
+	session.OnUserSuspended(func(userID string, username string) {
+		var conns []*websocket.Conn
+		groupMutex.Lock()
+		for _, members := range groupConnections {
+			if conn, ok := members[userID]; ok {
+				conns = append(conns, conn)
+			}
+		}
+		groupMutex.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+}
+
 type GroupMessage struct {
 	ID        string    `json:"id"`
 	GroupID   string    `json:"group_id"`
@@ -45,17 +64,7 @@ type GroupMessageRequest struct {
 }
 
 func HandleGroupWebSocket(w http.ResponseWriter, r *http.Request) {
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "No authentication token", http.StatusUnauthorized)
-		return
-	}
-
-	userID, ok := session.GetUserIDFromToken(token.Value)
-	if !ok {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	conn, err := groupUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -126,6 +135,12 @@ func HandleGroupWebSocket(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		if !auth.IsVerified(userID) {
+			errorMsg := map[string]string{"error": "Please verify your email address first"}
+			conn.WriteJSON(errorMsg)
+			continue
+		}
+
 		messageID, err := uuid.NewV4()
 		if err != nil {
 			log.Printf("Error generating UUID: %v", err)
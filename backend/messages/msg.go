@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"social-net/config"
 	"social-net/db"
 	"social-net/session"
 )
@@ -17,27 +18,17 @@ type User struct {
 }
 
 func OpenChat(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "No authentication token", http.StatusUnauthorized)
-		return
-	}
-
-	userID, ok := session.GetUserIDFromToken(token.Value)
-	if !ok {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	query := `
 		SELECT DISTINCT u.username, u.id, u.avatar, u.first_name || ' ' || u.last_name
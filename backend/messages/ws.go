@@ -8,6 +8,8 @@ import (
 	"sync"
 	"time"
 
+	"social-net/auth"
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
 	"social-net/notification"
@@ -38,6 +40,33 @@ var (
 	}
 )
 
+// Connections are keyed by username, so a rename moves them to the new key.
+func init() {
+	session.OnUsernameChange(func(oldName string, newName string) {
+		clientsMutex.Lock()
+		if conns, ok := clients[oldName]; ok {
+			clients[newName] = append(clients[newName], conns...)
+			delete(clients, oldName)
+		}
+		if onlineUsers[oldName] {
+			onlineUsers[newName] = true
+			delete(onlineUsers, oldName)
+		}
+		clientsMutex.Unlock()
+		broadcastOnlineUsers()
+	})
+	// Closing the connections of a suspended user ends their read loops,
+	// which then unregister them as usual.
+	session.OnUserSuspended(func(userID string, username string) {
+		clientsMutex.Lock()
+		conns := append([]*websocket.Conn{}, clients[username]...)
+		clientsMutex.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+}
+
 func Handleconnections(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrade.Upgrade(w, r, nil)
 	if err != nil {
@@ -47,23 +76,8 @@ func Handleconnections(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	sessionn, err := r.Cookie("token")
-	if err != nil {
-
-		logger.LogError("Error getting token", err)
-		return
-	}
-	token := sessionn.Value
-	userid, ok := session.GetUserIDFromToken(token)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
-	username, ok := session.GetUsernameFromUserID(userid)
-	if !ok {
-		http.Error(w, "Unauthorized: Invalid username", http.StatusUnauthorized)
-		return
-	}
+	user, _ := session.CurrentUser(r)
+	userid, username := user.ID, user.Username
 	clientsMutex.Lock()
 
 	clients[username] = append(clients[username], conn)
@@ -81,10 +95,28 @@ func Handleconnections(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
+		if !auth.IsVerified(userid) {
+			conn.WriteJSON(map[string]string{
+				"type":    "error",
+				"message": "Please verify your email address first",
+			})
+			continue
+		}
+
+		// The sender is always the connected user, and the receiver may
+		// have been addressed by a name they have since changed.
+		if current, ok := session.GetUsernameFromUserID(userid); ok {
+			msg.Username = current
+		}
+		msg.Receiver = session.CurrentUsername(msg.Receiver)
+
 		sendMessageToRecipient(msg)
 		notification.CreateNotificationMessage(msg.Receiver, msg.Username, "message", msg.Message)
 		saveMessageToDB(msg.Username, msg.Receiver, msg.Message, msg.Type)
 	}
+	if current, ok := session.GetUsernameFromUserID(userid); ok {
+		username = current
+	}
 	clientsMutex.Lock()
 	conns := clients[username]
 	for i, c := range conns {
@@ -141,10 +173,10 @@ func saveMessageToDB(sender string, receiver string, message string, typee strin
 }
 
 func GetMessages(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization") //
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token") //
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -156,26 +188,11 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionn, err := r.Cookie("token")
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
-	token := sessionn.Value
-	userid, ok := session.GetUserIDFromToken(token)
-	if !ok || userid == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
-	username, ok := session.GetUsernameFromUserID(userid)
-	if !ok {
-		http.Error(w, "Unauthorized: Invalid username", http.StatusUnauthorized)
-		return
-	}
+	user, _ := session.CurrentUser(r)
+	username := user.Username
 
-	sender := r.URL.Query().Get("sender")
-	receiver := r.URL.Query().Get("receiver")
+	sender := session.CurrentUsername(r.URL.Query().Get("sender"))
+	receiver := session.CurrentUsername(r.URL.Query().Get("receiver"))
 
 	if sender == "" || receiver == "" {
 		http.Error(w, "Sender and receiver are required", http.StatusBadRequest)
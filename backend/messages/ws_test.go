@@ -0,0 +1,71 @@
+package messages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMessagingRequiresVerifiedEmail(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.User(t, "u-verified", "verified", "verified@test.local", true)
+	dbtest.User(t, "u-unverified", "unverified", "unverified@test.local", false)
+	dbtest.User(t, "u-receiver", "receiver", "receiver@test.local", true)
+	server := httptest.NewServer(session.RequireAuth(Handleconnections))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		user      string
+		wantError bool
+	}{
+		{"u-unverified", true},
+		{"u-verified", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			header := http.Header{"Cookie": {dbtest.SignedIn(t, http.MethodGet, "/", nil, tt.user).Header.Get("Cookie")}}
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if err := conn.WriteJSON(Message{Message: "Hello from " + tt.user, Receiver: "receiver", Type: "message"}); err != nil {
+				t.Fatal(err)
+			}
+			stored := "SELECT 1 FROM messages WHERE sender_id = '" + tt.user + "' AND receiver_id = 'u-receiver'"
+
+			if !tt.wantError {
+				deadline := time.Now().Add(5 * time.Second)
+				for !dbtest.Exists(t, stored) {
+					if time.Now().After(deadline) {
+						t.Fatal("the message was not stored")
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				return
+			}
+
+			// Skip the online user lists broadcast on connect.
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for {
+				var reply map[string]interface{}
+				if err := conn.ReadJSON(&reply); err != nil {
+					t.Fatalf("no error reply: %v", err)
+				}
+				if reply["type"] == "error" {
+					break
+				}
+			}
+			if dbtest.Exists(t, stored) {
+				t.Error("the message of an unverified user was stored")
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"social-net/config"
 	"social-net/db"
 	"social-net/session"
 
@@ -35,6 +36,9 @@ const (
 	TypeGroupRequest  = "group_request"
 	TypeEventCreated  = "event_created"
 	TypeGroupMessage  = "group_message"
+	TypeReaction      = "reaction"
+	TypeMention       = "mention"
+	TypeRepost        = "repost"
 )
 
 type NotificationWebSocketMessage struct {
@@ -42,6 +46,27 @@ type NotificationWebSocketMessage struct {
 	Notification Notification `json:"notification"`
 }
 
+// Connections are keyed by username, so a rename moves them to the new key.
+// Those of a suspended user are closed.
+func init() {
+	session.OnUsernameChange(func(oldName string, newName string) {
+		notificationMutex.Lock()
+		defer notificationMutex.Unlock()
+		if conns, ok := notificationClients[oldName]; ok {
+			notificationClients[newName] = append(notificationClients[newName], conns...)
+			delete(notificationClients, oldName)
+		}
+	})
+	session.OnUserSuspended(func(userID string, username string) {
+		notificationMutex.Lock()
+		conns := append([]*websocket.Conn{}, notificationClients[username]...)
+		notificationMutex.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+}
+
 func HandleNotificationWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := notificationUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -50,24 +75,8 @@ func HandleNotificationWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	sessionCookie, err := r.Cookie("token")
-	if err != nil {
-		log.Printf("Error getting token for notification WebSocket: %v", err)
-		return
-	}
-
-	token := sessionCookie.Value
-	userID, ok := session.GetUserIDFromToken(token)
-	if !ok || userID == "" {
-		log.Printf("Invalid token for notification WebSocket")
-		return
-	}
-
-	username, ok := session.GetUsernameFromUserID(userID)
-	if !ok {
-		log.Printf("Invalid username for notification WebSocket")
-		return
-	}
+	user, _ := session.CurrentUser(r)
+	userID, username := user.ID, user.Username
 
 	notificationMutex.Lock()
 	notificationClients[username] = append(notificationClients[username], conn)
@@ -83,6 +92,9 @@ func HandleNotificationWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if current, ok := session.GetUsernameFromUserID(userID); ok {
+		username = current
+	}
 	notificationMutex.Lock()
 	conns := notificationClients[username]
 	for i, c := range conns {
@@ -100,6 +112,7 @@ func HandleNotificationWebSocket(w http.ResponseWriter, r *http.Request) {
 }
 
 func BroadcastNotificationToUser(username string, notification Notification) {
+	username = session.CurrentUsername(username)
 	notificationMutex.Lock()
 	defer notificationMutex.Unlock()
 
@@ -183,23 +196,17 @@ type Notification struct {
 }
 
 func GetNotifications(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, _ := r.Cookie("token")
-	tok := token.Value
-	userID, ok := session.GetUserIDFromToken(tok)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	query := `
 		SELECT 
@@ -259,10 +266,10 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
 }
 
 func MarkNotificationAsRead(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -278,8 +285,7 @@ func MarkNotificationAsRead(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println("requestBody", requestBody)
 
-	token, _ := r.Cookie("token")
-	userID, _ := session.GetUserIDFromToken(token.Value)
+	userID := session.CurrentUserID(r)
 
 	query := `
 		UPDATE notifications 
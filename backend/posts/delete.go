@@ -0,0 +1,51 @@
+package posts
+
+import (
+	"database/sql"
+
+	"social-net/db"
+	"social-net/utils"
+)
+
+// plainReposts selects the plain reposts of the post given as argument.
+const plainReposts = "SELECT id FROM posts WHERE repost_of = ? AND content = ''"
+
+// RemovePost deletes a post together with its comments, audience list,
+// revisions, reactions, tags and plain reposts, then the images they used
+// that no other row refers to. Quotes keep their own text and only lose the
+// link to the post. It returns sql.ErrNoRows for an unknown post.
+func RemovePost(postID string) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)", postID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	files, err := utils.UploadNames(`SELECT image FROM posts WHERE id = ?1 UNION ALL SELECT image FROM comments WHERE post_id = ?1
+		UNION ALL SELECT image FROM post_revisions WHERE post_id = ?1
+		UNION ALL SELECT image FROM comments WHERE post_id IN (SELECT id FROM posts WHERE repost_of = ?1 AND content = '')`, postID)
+	if err != nil {
+		return err
+	}
+	queries := append(utils.TargetCleanup("comment", "SELECT id FROM comments WHERE post_id = ?"), utils.TargetCleanup("post", "?")...)
+	queries = append(queries, utils.TargetCleanup("comment", "SELECT id FROM comments WHERE post_id IN ("+plainReposts+")")...)
+	queries = append(queries, utils.TargetCleanup("post", plainReposts)...)
+	err = utils.ExecAll(append(queries,
+		"DELETE FROM comments WHERE post_id IN ("+plainReposts+")",
+		"DELETE FROM notifications WHERE related_entity_id IN ("+plainReposts+")",
+		"DELETE FROM posts WHERE id IN ("+plainReposts+")",
+		"UPDATE posts SET repost_of = NULL WHERE repost_of = ?",
+		"DELETE FROM comments WHERE post_id = ?",
+		"DELETE FROM postsPrivacy WHERE post_id = ?",
+		"DELETE FROM post_revisions WHERE post_id = ?",
+		"DELETE FROM notifications WHERE related_entity_id = ?",
+		"DELETE FROM posts WHERE id = ?",
+	), postID)
+	if err != nil {
+		return err
+	}
+	utils.RemoveUploads(files)
+	return nil
+}
@@ -0,0 +1,104 @@
+package posts
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+// insertRepost adds a repost of repostOf by userID, a quote when content is
+// not empty.
+func insertRepost(t *testing.T, id string, userID string, repostOf string, content string) {
+	t.Helper()
+	if _, err := db.DB.Exec("INSERT INTO posts (id, user_id, author, title, content, creation_date, status, repost_of) VALUES (?, ?, '', '', ?, ?, 'public', ?)",
+		id, userID, content, time.Now(), repostOf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemovePostCleansUpReposts(t *testing.T) {
+	dbtest.Open(t)
+	owner := dbtest.User(t, "u-owner", "owner", "owner@test.local", true)
+	sharer := dbtest.User(t, "u-sharer", "sharer", "sharer@test.local", true)
+	insertPost(t, "p-removed", owner, "public")
+	insertPost(t, "p-kept", owner, "public")
+	insertRepost(t, "p-plain", sharer, "p-removed", "")
+	insertRepost(t, "p-quote", sharer, "p-removed", "Look at this")
+	insertRepost(t, "p-other-plain", sharer, "p-kept", "")
+	dbtest.Exec(t,
+		"INSERT INTO comments (id, post_id, author, content, creation_date) VALUES ('c-plain', 'p-plain', 'owner', 'Nice', CURRENT_TIMESTAMP)",
+		"INSERT INTO reactions (id, target_type, target_id, user_id, reaction, created_at) VALUES ('r-plain', 'post', 'p-plain', 'u-owner', 'like', CURRENT_TIMESTAMP)",
+		"INSERT INTO reactions (id, target_type, target_id, user_id, reaction, created_at) VALUES ('r-comment', 'comment', 'c-plain', 'u-sharer', 'like', CURRENT_TIMESTAMP)",
+	)
+
+	if err := RemovePost("p-removed"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"removed post", "SELECT 1 FROM posts WHERE id = 'p-removed'", false},
+		{"plain repost", "SELECT 1 FROM posts WHERE id = 'p-plain'", false},
+		{"comment on the plain repost", "SELECT 1 FROM comments WHERE id = 'c-plain'", false},
+		{"reactions on the plain repost and its comment", "SELECT 1 FROM reactions WHERE id IN ('r-plain', 'r-comment')", false},
+		{"quote", "SELECT 1 FROM posts WHERE id = 'p-quote' AND repost_of IS NULL", true},
+		{"repost of another post", "SELECT 1 FROM posts WHERE id = 'p-other-plain' AND repost_of = 'p-kept'", true},
+	}
+	for _, tt := range tests {
+		if got := dbtest.Exists(t, tt.query); got != tt.want {
+			t.Errorf("%s: exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := RemovePost("p-removed"); err != sql.ErrNoRows {
+		t.Errorf("removing again: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestRemovePostKeepsSharedImages(t *testing.T) {
+	dbtest.Open(t)
+	previous := config.Current.UploadsDir
+	config.Current.UploadsDir = t.TempDir()
+	t.Cleanup(func() { config.Current.UploadsDir = previous })
+
+	owner := dbtest.User(t, "u-owner", "owner", "owner@test.local", true)
+	// A semi-private post is stored once per allowed user, all copies with
+	// the same image; the last copy also had it in an earlier version.
+	for _, id := range []string{"p-semi-1", "p-semi-2", "p-semi-3"} {
+		insertPost(t, id, owner, "semi-private")
+	}
+	dbtest.Exec(t,
+		"UPDATE posts SET image = 'shared.png' WHERE id IN ('p-semi-1', 'p-semi-2')",
+		"INSERT INTO post_revisions (id, post_id, title, content, image, status, created_at) VALUES ('rev-1', 'p-semi-3', 'Title', 'Content', 'shared.png', 'semi-private', CURRENT_TIMESTAMP)",
+	)
+	file := filepath.Join(config.Current.UploadsDir, "shared.png")
+	if err := os.WriteFile(file, []byte("png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remove   string
+		wantFile bool
+	}{
+		{"p-semi-1", true},
+		{"p-semi-2", true},
+		{"p-semi-3", false},
+	}
+	for _, tt := range tests {
+		if err := RemovePost(tt.remove); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(file); (err == nil) != tt.wantFile {
+			t.Errorf("after removing %s: image exists = %v, want %v", tt.remove, err == nil, tt.wantFile)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package posts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-net/auth"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+	"social-net/tags"
+	"social-net/utils"
+
+	"github.com/gofrs/uuid"
+)
+
+type Revision struct {
+	ID        string    `json:"id"`
+	PostID    string    `json:"post_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Image     string    `json:"image"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ownPost loads the editable fields of a post owned by userID. Posts of other
+// users are reported as missing.
+func ownPost(postID string, userID string) (Revision, time.Time, error) {
+	var p Revision
+	var createdAt time.Time
+	var editedAt sql.NullTime
+	var owner string
+	err := db.DB.QueryRow("SELECT id, user_id, title, content, COALESCE(image, ''), status, creation_date, edited_at FROM posts WHERE id = ?", postID).
+		Scan(&p.PostID, &owner, &p.Title, &p.Content, &p.Image, &p.Status, &createdAt, &editedAt)
+	if err != nil {
+		return p, createdAt, err
+	}
+	if owner != userID {
+		return p, createdAt, sql.ErrNoRows
+	}
+	// The version being replaced dates from the last edit, or the creation.
+	if editedAt.Valid {
+		createdAt = editedAt.Time
+	}
+	return p, createdAt, nil
+}
+
+// EditPost updates the title, content, image or audience of one of the
+// caller's posts. The replaced version is kept in post_revisions, together
+// with its image, until the post is deleted.
+func EditPost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := session.CurrentUserID(r)
+	if !auth.RequireVerified(w, userID) {
+		return
+	}
+	if err := r.ParseMultipartForm(config.Current.MaxRequestSize); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	old, versionDate, err := ownPost(r.FormValue("post_id"), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		logger.LogError("Error loading post", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Fields left out of the form keep their current value.
+	post := old
+	if _, ok := r.MultipartForm.Value["title"]; ok {
+		post.Title = r.FormValue("title")
+	}
+	if _, ok := r.MultipartForm.Value["content"]; ok {
+		post.Content = r.FormValue("content")
+	}
+	if status := strings.ToLower(r.FormValue("status")); status != "" {
+		post.Status = status
+	}
+	if post.Status != "public" && post.Status != "private" && post.Status != "semi-private" {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	// A repost has no title of its own, and its audience stays within what
+	// the shared post allows.
+	var repostOf, ownerID, originalStatus string
+	if err := db.DB.QueryRow(`SELECT COALESCE(r.repost_of, ''), COALESCE(o.user_id, ''), COALESCE(o.status, '')
+		FROM posts r LEFT JOIN posts o ON o.id = r.repost_of WHERE r.id = ?`, post.PostID).Scan(&repostOf, &ownerID, &originalStatus); err != nil {
+		logger.LogError("Error loading post", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if repostOf == "" {
+		if msg := checkPostFields(post.Title, post.Content); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	} else {
+		if post.Title != "" || len(post.Content) > 1000 {
+			http.Error(w, "Reposts have no title and at most 1000 characters of content", http.StatusBadRequest)
+			return
+		}
+		if post.Status != old.Status && (ownerID == "" || !canShare(ownerID, originalStatus, userID, post.Status)) {
+			http.Error(w, "This post cannot be shared with that audience", http.StatusForbidden)
+			return
+		}
+	}
+
+	var audience []string
+	if post.Status == "semi-private" {
+		if _, ok := r.MultipartForm.Value["allowed_users"]; ok || old.Status != "semi-private" {
+			for _, name := range strings.Split(r.FormValue("allowed_users"), ",") {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				id, err := session.GetUserIDFromUsername(name)
+				if err != nil || id == "" {
+					http.Error(w, "User not found: "+name, http.StatusBadRequest)
+					return
+				}
+				audience = append(audience, id)
+			}
+			if len(audience) == 0 {
+				http.Error(w, "allowed_users is required for semi-private posts", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if r.FormValue("remove_image") == "true" {
+		post.Image = ""
+	}
+	file, handler, err := r.FormFile("image")
+	if err == nil {
+		defer file.Close()
+		name, status, err := savePostImage(file, handler)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		post.Image = name
+	}
+
+	if post.Title == old.Title && post.Content == old.Content && post.Image == old.Image && post.Status == old.Status && audience == nil {
+		http.Error(w, "Nothing to change", http.StatusBadRequest)
+		return
+	}
+
+	if err := savePostEdit(old, versionDate, post, audience); err != nil {
+		if post.Image != old.Image {
+			utils.RemoveUploads([]string{post.Image})
+		}
+		logger.LogError("Error editing post", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	tags.Index("post", post.PostID, userID, post.Title+"\n"+post.Content)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Post updated successfully", "post_id": post.PostID})
+}
+
+// savePostEdit stores old as a revision and writes post over it. A non-nil
+// audience replaces the users a semi-private post is shared with.
+func savePostEdit(old Revision, versionDate time.Time, post Revision, audience []string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	revisionID, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO post_revisions (id, post_id, title, content, image, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		revisionID.String(), old.PostID, old.Title, old.Content, old.Image, old.Status, versionDate); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE posts SET title = ?, content = ?, image = ?, status = ?, edited_at = ? WHERE id = ?",
+		post.Title, post.Content, post.Image, post.Status, time.Now(), post.PostID); err != nil {
+		return err
+	}
+
+	if post.Status != "semi-private" || audience != nil {
+		if _, err := tx.Exec("DELETE FROM postsPrivacy WHERE post_id = ?", post.PostID); err != nil {
+			return err
+		}
+	}
+	for _, userID := range audience {
+		privacyID, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO postsPrivacy (id, post_id, user_id) VALUES (?, ?, ?)", privacyID.String(), post.PostID, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeletePost removes one of the caller's posts with its comments, audience
+// list, revisions and images.
+func DeletePost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		PostID string `json:"post_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.PostID == "" {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	_, _, err := ownPost(request.PostID, session.CurrentUserID(r))
+	if err == nil {
+		err = RemovePost(request.PostID)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		logger.LogError("Error deleting post", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Post deleted successfully"})
+}
+
+// PostRevisions lists the earlier versions of ?post_id=, newest first, to
+// the post's author only: an earlier version may hold text that was removed
+// since or that was written for a narrower audience than the current one.
+func PostRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID := r.URL.Query().Get("post_id")
+	userID := session.CurrentUserID(r)
+	var authorID string
+	err := db.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&authorID)
+	if err == sql.ErrNoRows || (err == nil && (userID == "" || authorID != userID)) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.LogError("Error loading post for revisions", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT id, post_id, title, content, image, status, created_at FROM post_revisions WHERE post_id = ? ORDER BY created_at DESC", postID)
+	if err != nil {
+		logger.LogError("Error listing post revisions", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.ID, &rev.PostID, &rev.Title, &rev.Content, &rev.Image, &rev.Status, &rev.CreatedAt); err != nil {
+			logger.LogError("Error scanning post revision", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if rev.Image != "" {
+			rev.Image = config.Current.UploadURL(rev.Image)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
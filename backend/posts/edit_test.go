@@ -0,0 +1,60 @@
+package posts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+// insertPost adds a post of userID with the given status.
+func insertPost(t *testing.T, id string, userID string, status string) {
+	t.Helper()
+	if _, err := db.DB.Exec("INSERT INTO posts (id, user_id, author, title, content, creation_date, status) VALUES (?, ?, '', 'Title', 'Content', ?, ?)",
+		id, userID, time.Now(), status); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostRevisionsOnlyForAuthor(t *testing.T) {
+	dbtest.Open(t)
+	author := dbtest.User(t, "u-author", "author", "author@test.local", true)
+	reader := dbtest.User(t, "u-reader", "reader", "reader@test.local", true)
+	insertPost(t, "p-edited", author, "public")
+	if _, err := db.DB.Exec("INSERT INTO post_revisions (id, post_id, title, content, image, status, created_at) VALUES ('r1', 'p-edited', 'Title', 'For close friends only', '', 'private', ?)",
+		time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		viewer string
+		post   string
+		want   int
+	}{
+		{"author", author, "p-edited", http.StatusOK},
+		{"reader of the public post", reader, "p-edited", http.StatusNotFound},
+		{"unknown post", author, "p-missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			session.RequireAuth(PostRevisions)(w, dbtest.SignedIn(t, http.MethodGet, "/api/posts/revisions?post_id="+tt.post, nil, tt.viewer))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var revisions []Revision
+			if err := json.NewDecoder(w.Body).Decode(&revisions); err != nil || len(revisions) != 1 || revisions[0].Status != "private" {
+				t.Errorf("revisions = %+v, %v", revisions, err)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package posts
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
+	"social-net/reactions"
 	"social-net/session"
 )
 
@@ -20,70 +26,248 @@ type GetPost struct {
 	Image         string
 	Creation_date string
 	Status        string
+	Edited        bool
+	Edited_at     *time.Time
+	Reactions     reactions.Summary
+	// Repost_of is the id of the post shared by a repost or quote, and
+	// Original that post, nil when the viewer cannot see it (any more).
+	Repost_of string
+	Original  *GetPost
 }
 
+// feedCursor marks a position in the feed: the stored creation_date of a
+// post, as text so it compares exactly, and its id to break ties.
+type feedCursor struct {
+	date string
+	id   string
+}
+
+func (c feedCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.date + "|" + c.id))
+}
+
+func parseFeedCursor(s string) (feedCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return feedCursor{}, false
+	}
+	date, id, ok := strings.Cut(string(raw), "|")
+	return feedCursor{date, id}, ok && date != "" && id != ""
+}
+
+// offsetCursor is the cursor of ranked feeds, which page by position.
+func offsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func parseOffsetCursor(s string) (int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, false
+	}
+	offset, err := strconv.Atoi(string(raw))
+	return offset, err == nil && offset >= 0
+}
+
+// discoverScore ranks discover posts: engagement, with comments counting
+// double, decays with the square of the age in hours.
+const discoverScore = `(1.0 + 2 * (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id)
+		+ (SELECT COUNT(*) FROM reactions rx WHERE rx.target_type = 'post' AND rx.target_id = p.id))
+		/ ((julianday('now') - julianday(p.creation_date)) * 24 + 2)
+		/ ((julianday('now') - julianday(p.creation_date)) * 24 + 2)`
+
+// Getposts pages through the posts the caller can see. ?mode= picks the
+// feed: "all" (the default) mixes everything, "following" keeps the accounts
+// the caller follows and their own posts, and "discover" ranks public posts
+// from everyone else by discoverScore.
+//
+// ?limit= sets the page size and ?cursor= continues after the next_cursor of
+// the previous page. The chronological modes also take ?since=, which only
+// returns posts newer than a cursor, so a client can poll with the
+// latest_cursor it was given. When more new posts arrived than fit in a
+// page, cursor and since together fill the gap.
 func Getposts(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	userID := session.CurrentUserID(r)
+	q := r.URL.Query()
 
-	tokene, err := r.Cookie("token")
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	visible, args := VisibleTo(userID)
+	where := " WHERE " + visible
+	order := " ORDER BY p.creation_date DESC, p.id DESC"
+	mode := q.Get("mode")
+	switch mode {
+	case "", "all":
+		mode = "all"
+	case "following":
+		where += ` AND (p.user_id = ? OR p.user_id IN
+			(SELECT followed_id FROM Followers WHERE follower_id = ? AND status = 'accepted'))`
+		args = append(args, userID, userID)
+	case "discover":
+		where += ` AND p.status = 'public' AND p.user_id != ? AND p.user_id NOT IN
+			(SELECT followed_id FROM Followers WHERE follower_id = ? AND status = 'accepted')`
+		args = append(args, userID, userID)
+		order = " ORDER BY " + discoverScore + " DESC, p.creation_date DESC, p.id DESC"
+	default:
+		http.Error(w, "Invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	// Ranked pages move by offset, since scores change over time; the
+	// chronological ones by keyset on (creation_date, id).
+	var before, since feedCursor
+	offset := 0
+	if c := q.Get("cursor"); c != "" {
+		var ok bool
+		if mode == "discover" {
+			offset, ok = parseOffsetCursor(c)
+		} else if before, ok = parseFeedCursor(c); ok {
+			where += " AND (p.creation_date < ? OR (p.creation_date = ? AND p.id < ?))"
+			args = append(args, before.date, before.date, before.id)
+		}
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	if c := q.Get("since"); c != "" {
+		if mode == "discover" {
+			http.Error(w, "since is not supported in discover mode", http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		if since, ok = parseFeedCursor(c); !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		where += " AND (p.creation_date > ? OR (p.creation_date = ? AND p.id > ?))"
+		args = append(args, since.date, since.date, since.id)
+	}
+
+	// One extra row tells whether another page follows.
+	posts, cursors, err := queryPosts(where, args, order, limit+1, offset)
 	if err != nil {
-		logger.LogError("Missing token", err)
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
+		logger.LogError("Error fetching posts", err)
+		http.Error(w, fmt.Sprintf("Error fetching posts: %v", err), http.StatusInternalServerError)
 		return
 	}
-	token := tokene.Value
-	userID, error1 := session.GetUserIDFromToken(token)
-	if !error1 || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
+
+	nextCursor := ""
+	if len(posts) > limit {
+		posts, cursors = posts[:limit], cursors[:limit]
+		nextCursor = cursors[limit-1].String()
+		if mode == "discover" {
+			nextCursor = offsetCursor(offset + limit)
+		}
+	}
+	// Polling resumes from the newest post seen so far.
+	latestCursor := q.Get("since")
+	if len(cursors) > 0 && before.id == "" && mode != "discover" {
+		latestCursor = cursors[0].String()
+	}
+
+	if err := attachOriginals(posts, userID); err != nil {
+		logger.LogError("Error fetching reposted posts", err)
+		http.Error(w, fmt.Sprintf("Error fetching posts: %v", err), http.StatusInternalServerError)
 		return
 	}
+	attachReactions(posts, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":          mode,
+		"posts":         posts,
+		"next_cursor":   nextCursor,
+		"latest_cursor": latestCursor,
+	})
+}
 
+// queryPosts runs a feed query: where and order apply to the posts table
+// aliased p. It returns the posts with the cursor of each.
+func queryPosts(where string, args []interface{}, order string, limit int, offset int) ([]GetPost, []feedCursor, error) {
 	query := `
-        SELECT DISTINCT p.id, p.author, p.content, p.title, p.user_id, p.creation_date, p.status, u.avatar, p.Image
+        SELECT p.id, p.author, p.content, p.title, p.user_id, p.creation_date, CAST(p.creation_date AS TEXT), p.status, u.avatar, p.Image, p.edited_at,
+			COALESCE(p.repost_of, '')
         FROM posts p
-        LEFT JOIN postsPrivacy pp ON p.id = pp.post_id
-        LEFT JOIN Followers f ON p.user_id = f.followed_id
-		LEFT JOIN users u ON p.user_id = u.id
-        WHERE 
-            p.status = 'public' OR
-            (p.status = 'semi-private' AND pp.user_id = ?) OR
-            (f.follower_id = ? AND f.status = 'accepted') OR
-            p.user_id = ?
-        ORDER BY p.creation_date DESC
+		LEFT JOIN users u ON p.user_id = u.id` + where + order + `
+        LIMIT ? OFFSET ?
     `
 
-	rows, err := db.DB.Query(query, userID, userID, userID)
+	rows, err := db.DB.Query(query, append(args, limit, offset)...)
 	if err != nil {
-		logger.LogError("Error fetching posts", err)
-		http.Error(w, fmt.Sprintf("Error fetching posts: %v", err), http.StatusInternalServerError)
-		return
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var posts []GetPost
+	posts := []GetPost{}
+	cursors := []feedCursor{}
 	for rows.Next() {
 		var post GetPost
-		err := rows.Scan(&post.Id, &post.Author, &post.Content, &post.Title, &post.User_id, &post.Creation_date, &post.Status, &post.Avatar, &post.Image)
+		var date string
+		err := rows.Scan(&post.Id, &post.Author, &post.Content, &post.Title, &post.User_id, &post.Creation_date, &date, &post.Status, &post.Avatar, &post.Image, &post.Edited_at, &post.Repost_of)
 		if err != nil {
-			logger.LogError("Error scanning post", err)
-			http.Error(w, fmt.Sprintf("Error scanning post: %v", err), http.StatusInternalServerError)
-			return
-		}
-		allowed := CheckUserPostPermission(userID, post.Id)
-		if !allowed {
-			logger.LogError("Unauthorized access to post", fmt.Errorf("user %s not allowed to access post %s", userID, post.Id))
-			continue
+			return nil, nil, err
 		}
 
+		post.Edited = post.Edited_at != nil
 		if post.Image != "" {
-			post.Image = "http://localhost:8080/uploads/" + post.Image
+			post.Image = config.Current.UploadURL(post.Image)
 		}
 		posts = append(posts, post)
+		cursors = append(cursors, feedCursor{date, post.Id})
 	}
+	return posts, cursors, rows.Err()
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+// attachReactions fills in the reaction summaries of posts for viewerID.
+func attachReactions(posts []GetPost, viewerID string) {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	summaries := reactions.LoadOrEmpty("post", ids, viewerID)
+	for i := range posts {
+		posts[i].Reactions = summaries.For(posts[i].Id)
+	}
+}
+
+// attachOriginals embeds in each repost the post it shares, if viewerID can
+// see it.
+func attachOriginals(posts []GetPost, viewerID string) error {
+	var ids []interface{}
+	for _, post := range posts {
+		if post.Repost_of != "" {
+			ids = append(ids, post.Repost_of)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	visible, args := VisibleTo(viewerID)
+	originals, _, err := queryPosts(" WHERE "+visible+" AND p.id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		append(args, ids...), "", len(ids), 0)
+	if err != nil {
+		return err
+	}
+	attachReactions(originals, viewerID)
+
+	byID := map[string]*GetPost{}
+	for i := range originals {
+		byID[originals[i].Id] = &originals[i]
+	}
+	for i := range posts {
+		if posts[i].Repost_of != "" {
+			posts[i].Original = byID[posts[i].Repost_of]
+		}
+	}
+	return nil
 }
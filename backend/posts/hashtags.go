@@ -0,0 +1,80 @@
+package posts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"social-net/config"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+// PostsByHashtag pages through the posts tagged ?tag= that the caller can
+// see, newest first, with the same ?limit= and ?cursor= as Getposts.
+func PostsByHashtag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(q.Get("tag")), "#"))
+	if tag == "" {
+		http.Error(w, "tag is required", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	userID := session.CurrentUserID(r)
+	visible, args := VisibleTo(userID)
+	where := " WHERE " + visible + " AND p.id IN (SELECT target_id FROM hashtags WHERE target_type = 'post' AND tag = ?)"
+	args = append(args, tag)
+	if c := q.Get("cursor"); c != "" {
+		before, ok := parseFeedCursor(c)
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		where += " AND (p.creation_date < ? OR (p.creation_date = ? AND p.id < ?))"
+		args = append(args, before.date, before.date, before.id)
+	}
+
+	posts, cursors, err := queryPosts(where, args, " ORDER BY p.creation_date DESC, p.id DESC", limit+1, 0)
+	if err != nil {
+		logger.LogError("Error fetching posts by hashtag", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		nextCursor = cursors[limit-1].String()
+	}
+	if err := attachOriginals(posts, userID); err != nil {
+		logger.LogError("Error fetching reposted posts", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	attachReactions(posts, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tag":         tag,
+		"posts":       posts,
+		"next_cursor": nextCursor,
+	})
+}
@@ -3,6 +3,7 @@ package posts
 import (
 	"encoding/json"
 	"net/http"
+	"social-net/config"
 	"social-net/db"
 )
 
@@ -14,10 +15,10 @@ type PostPrv struct {
 }
 
 func PostPrivacy(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	rows, err := db.DB.Query("SELECT * FROM postsPrivacy")
 	if err != nil {
@@ -2,9 +2,11 @@ package posts
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,10 +14,12 @@ import (
 	"time"
 
 	"social-net/auth"
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
 
 	"social-net/session"
+	"social-net/tags"
 
 	"github.com/gofrs/uuid"
 )
@@ -31,10 +35,10 @@ type Posts struct {
 }
 
 func Post(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -42,20 +46,12 @@ func Post(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "POST" {
-		tokene, err := r.Cookie("token")
-		if err != nil {
-			logger.LogError("Error getting token", err)
-			http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-			return
-		}
-		token := tokene.Value
-		userid, ok := session.GetUserIDFromToken(token)
-		if !ok || userid == "" {
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
+		userid := session.CurrentUserID(r)
+		if !auth.RequireVerified(w, userid) {
 			return
 		}
 
-		err = r.ParseMultipartForm(10 << 20)
+		err := r.ParseMultipartForm(config.Current.MaxRequestSize)
 		if err != nil {
 			http.Error(w, "Failed to parse form", http.StatusBadRequest)
 			return
@@ -74,27 +70,8 @@ func Post(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if len(post.Title) < 1 {
-			logger.LogError("Title too short", nil)
-			http.Error(w, "Title must be at least 3 characters long", http.StatusBadRequest)
-			return
-		}
-
-		if len(post.Title) > 100 {
-			logger.LogError("Title too long", nil)
-			http.Error(w, "Title must not exceed 100 characters", http.StatusBadRequest)
-			return
-		}
-
-		if len(post.Content) < 1 {
-			logger.LogError("Content too short", nil)
-			http.Error(w, "Content must be at least 10 characters long", http.StatusBadRequest)
-			return
-		}
-
-		if len(post.Content) > 1000 {
-			logger.LogError("Content too long", nil)
-			http.Error(w, "Content must not exceed 1000 characters", http.StatusBadRequest)
+		if msg := checkPostFields(post.Title, post.Content); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
 			return
 		}
 
@@ -109,53 +86,12 @@ func Post(w http.ResponseWriter, r *http.Request) {
 		if err == nil && file != nil {
 			defer file.Close()
 
-			if handler.Size > 2*1024*1024 {
-				http.Error(w, "image file too large", http.StatusBadRequest)
-				return
-			}
-
-			buff := make([]byte, 512)
-			_, _ = file.Read(buff)
-			contentType := http.DetectContentType(buff)
-			file.Seek(0, io.SeekStart)
-
-			allowedTypes := []string{"image/jpeg", "image/png", "image/gif"}
-			valid := false
-			for _, t := range allowedTypes {
-				if t == contentType {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				http.Error(w, "Invalid image file type", http.StatusBadRequest)
-				return
-			}
-
-			ext := filepath.Ext(handler.Filename)
-			safeFilename := fmt.Sprintf("%s_%d%s", post.Image, time.Now().Unix(), ext)
-
-			path := "./uploads"
-			_, err := os.Stat(path)
-			if os.IsNotExist(err) {
-				os.Mkdir(path, os.ModePerm)
-			}
-			savePath := filepath.Join(path, safeFilename)
-
-			out, err := os.Create(savePath)
-			if err != nil {
-				log.Println("Failed to save image:", err)
-				http.Error(w, "Failed to save image", http.StatusInternalServerError)
-				return
-			}
-			defer out.Close()
-			_, err = io.Copy(out, file)
+			name, status, err := savePostImage(file, handler)
 			if err != nil {
-				log.Println("Failed to write image:", err)
-				http.Error(w, "Failed to write image", http.StatusInternalServerError)
+				http.Error(w, err.Error(), status)
 				return
 			}
-			post.Image = safeFilename
+			post.Image = name
 		}
 		if strings.ToLower(post.Status) == "public" || strings.ToLower(post.Status) == "private" {
 
@@ -172,6 +108,7 @@ func Post(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, fmt.Sprintf("Error inserting post: %v", err), http.StatusInternalServerError)
 				return
 			}
+			tags.Index("post", postID, userid, post.Title+"\n"+post.Content)
 		}
 		if post.Status == "semi-private" {
 			var userSlice []string
@@ -205,6 +142,7 @@ func Post(w http.ResponseWriter, r *http.Request) {
 					http.Error(w, fmt.Sprintf("Error inserting post privacy: %v", err), http.StatusInternalServerError)
 					return
 				}
+				tags.Index("post", postID.String(), userid, post.Title+"\n"+post.Content)
 			}
 		}
 
@@ -212,3 +150,60 @@ func Post(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"message": "Post created successfully"})
 	}
 }
+
+// checkPostFields returns the error message for an invalid title or
+// content, or "" when both are acceptable.
+func checkPostFields(title string, content string) string {
+	switch {
+	case len(title) < 1:
+		return "Title must be at least 3 characters long"
+	case len(title) > 100:
+		return "Title must not exceed 100 characters"
+	case len(content) < 1:
+		return "Content must be at least 10 characters long"
+	case len(content) > 1000:
+		return "Content must not exceed 1000 characters"
+	}
+	return ""
+}
+
+// savePostImage checks an uploaded image and stores it in the uploads
+// directory. On failure it also returns the status to answer with.
+func savePostImage(file multipart.File, handler *multipart.FileHeader) (string, int, error) {
+	if handler.Size > config.Current.MaxImageSize {
+		return "", http.StatusBadRequest, errors.New("image file too large")
+	}
+
+	buff := make([]byte, 512)
+	_, _ = file.Read(buff)
+	contentType := http.DetectContentType(buff)
+	file.Seek(0, io.SeekStart)
+
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return "", http.StatusBadRequest, errors.New("Invalid image file type")
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	name := fmt.Sprintf("%s_%d%s", id, time.Now().Unix(), filepath.Ext(handler.Filename))
+
+	path := config.Current.UploadsDir
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		os.Mkdir(path, os.ModePerm)
+	}
+	out, err := os.Create(filepath.Join(path, name))
+	if err != nil {
+		log.Println("Failed to save image:", err)
+		return "", http.StatusInternalServerError, errors.New("Failed to save image")
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, file); err != nil {
+		log.Println("Failed to write image:", err)
+		return "", http.StatusInternalServerError, errors.New("Failed to write image")
+	}
+	return name, 0, nil
+}
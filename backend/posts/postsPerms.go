@@ -57,3 +57,13 @@ func CheckUserPostPermission(userID string, postID string) bool {
 
 	return false
 }
+
+// VisibleTo is CheckUserPostPermission as a WHERE condition on the posts
+// table aliased p, so listings can filter in SQL instead of per row.
+func VisibleTo(userID string) (string, []interface{}) {
+	return `(p.user_id = ? OR p.status = 'public'
+		OR (p.status = 'semi-private' AND EXISTS (SELECT 1 FROM postsPrivacy pp WHERE pp.post_id = p.id AND pp.user_id = ?))
+		OR (p.status = 'private' AND EXISTS (SELECT 1 FROM Followers f
+			WHERE f.follower_id = ? AND f.followed_id = p.user_id AND f.status = 'accepted')))`,
+		[]interface{}{userID, userID, userID}
+}
@@ -0,0 +1,73 @@
+package posts
+
+import (
+	"testing"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+// TestVisibleToMatchesCheckUserPostPermission checks that the SQL filter
+// used by listings agrees with the per-post check for every viewer.
+func TestVisibleToMatchesCheckUserPostPermission(t *testing.T) {
+	dbtest.Open(t)
+	owner := dbtest.User(t, "u-owner", "owner", "owner@test.local", true)
+	follower := dbtest.User(t, "u-follower", "follower", "follower@test.local", true)
+	pending := dbtest.User(t, "u-pending", "pending", "pending@test.local", true)
+	chosen := dbtest.User(t, "u-chosen", "chosen", "chosen@test.local", true)
+	stranger := dbtest.User(t, "u-stranger", "stranger", "stranger@test.local", true)
+
+	insertPost(t, "p-public", owner, "public")
+	insertPost(t, "p-private", owner, "private")
+	insertPost(t, "p-semi", owner, "semi-private")
+	insertPost(t, "p-unknown", owner, "draft")
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO Followers (id, follower_id, followed_id, status) VALUES ('f-test-1', ?, ?, 'accepted')", []interface{}{follower, owner}},
+		{"INSERT INTO Followers (id, follower_id, followed_id, status) VALUES ('f-test-2', ?, ?, 'pending')", []interface{}{pending, owner}},
+		{"INSERT INTO postsPrivacy (id, post_id, user_id) VALUES ('pp-test-1', 'p-semi', ?)", []interface{}{chosen}},
+	} {
+		if _, err := db.DB.Exec(q.query, q.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		viewer string
+		post   string
+		want   bool
+	}{
+		{owner, "p-public", true},
+		{owner, "p-private", true},
+		{owner, "p-semi", true},
+		{owner, "p-unknown", true},
+		{follower, "p-public", true},
+		{follower, "p-private", true},
+		{follower, "p-semi", false},
+		{follower, "p-unknown", false},
+		{pending, "p-private", false},
+		{chosen, "p-private", false},
+		{chosen, "p-semi", true},
+		{stranger, "p-public", true},
+		{stranger, "p-private", false},
+		{stranger, "p-semi", false},
+		{"", "p-public", true},
+		{"", "p-private", false},
+		{"", "p-semi", false},
+	}
+	for _, tt := range tests {
+		visible, args := VisibleTo(tt.viewer)
+		var listed bool
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = ? AND "+visible+")",
+			append([]interface{}{tt.post}, args...)...).Scan(&listed); err != nil {
+			t.Fatal(err)
+		}
+		checked := CheckUserPostPermission(tt.viewer, tt.post)
+		if listed != checked || checked != tt.want {
+			t.Errorf("viewer %q, post %s: VisibleTo = %v, CheckUserPostPermission = %v, want %v",
+				tt.viewer, tt.post, listed, checked, tt.want)
+		}
+	}
+}
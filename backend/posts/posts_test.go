@@ -0,0 +1,55 @@
+package posts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-net/db/dbtest"
+	"social-net/session"
+)
+
+func TestPostingRequiresVerifiedEmail(t *testing.T) {
+	dbtest.Open(t)
+	verified := dbtest.User(t, "u-verified", "verified", "verified@test.local", true)
+	unverified := dbtest.User(t, "u-unverified", "unverified", "unverified@test.local", false)
+	insertPost(t, "p-shared", verified, "public")
+	insertPost(t, "p-own-u-verified", verified, "public")
+	insertPost(t, "p-own-u-unverified", unverified, "public")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		request func(userID string) *http.Request
+		// written finds what the request stores, with ? for the user.
+		written string
+		want    int
+	}{
+		{"post", Post, func(userID string) *http.Request {
+			return dbtest.SignedInForm(t, "/api/posts", map[string]string{"title": "Fresh", "content": "Fresh", "status": "public"}, userID)
+		}, "SELECT 1 FROM posts WHERE user_id = ? AND title = 'Fresh'", http.StatusOK},
+		{"repost", Repost, func(userID string) *http.Request {
+			return dbtest.SignedIn(t, http.MethodPost, "/api/posts/repost", strings.NewReader(`{"post_id": "p-shared"}`), userID)
+		}, "SELECT 1 FROM posts WHERE user_id = ? AND repost_of = 'p-shared'", http.StatusCreated},
+		{"edit", EditPost, func(userID string) *http.Request {
+			return dbtest.SignedInForm(t, "/api/posts/edit", map[string]string{"post_id": "p-own-" + userID, "title": "Edited", "content": "Edited"}, userID)
+		}, "SELECT 1 FROM posts WHERE user_id = ? AND title = 'Edited'", http.StatusOK},
+	}
+	for _, tt := range tests {
+		for _, user := range []struct {
+			id   string
+			want int
+		}{{unverified, http.StatusForbidden}, {verified, tt.want}} {
+			w := httptest.NewRecorder()
+			session.RequireAuth(tt.handler)(w, tt.request(user.id))
+			if w.Code != user.want {
+				t.Errorf("%s by %s: status = %d, want %d: %s", tt.name, user.id, w.Code, user.want, w.Body)
+			}
+			query := strings.Replace(tt.written, "?", "'"+user.id+"'", 1)
+			if got := dbtest.Exists(t, query); got != (user.id == verified) {
+				t.Errorf("%s by %s: stored = %v", tt.name, user.id, got)
+			}
+		}
+	}
+}
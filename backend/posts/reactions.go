@@ -0,0 +1,18 @@
+package posts
+
+import (
+	"social-net/db"
+	"social-net/reactions"
+)
+
+func init() {
+	reactions.RegisterTarget("post", reactions.Target{
+		Noun: "post",
+		Author: func(id string) (string, error) {
+			var userID string
+			err := db.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", id).Scan(&userID)
+			return userID, err
+		},
+		CanSee: CheckUserPostPermission,
+	})
+}
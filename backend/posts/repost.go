@@ -0,0 +1,153 @@
+package posts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-net/auth"
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/notification"
+	"social-net/session"
+	"social-net/tags"
+
+	"github.com/gofrs/uuid"
+)
+
+// canShare reports whether a post with status, by ownerID, may be shared by
+// userID to an audience of the given status. Sharing must not widen who
+// sees the post: public posts can go anywhere, private ones only back to
+// the owner's own followers, and semi-private ones nowhere.
+func canShare(ownerID string, status string, userID string, audience string) bool {
+	switch status {
+	case "public":
+		return true
+	case "private":
+		return ownerID == userID && audience == "private"
+	}
+	return false
+}
+
+// Repost shares {post_id} with the caller's audience, as a plain repost or,
+// with content, as a quote. Reposting a repost shares the post behind it.
+// The original author is notified.
+func Repost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := session.CurrentUser(r)
+	if !auth.RequireVerified(w, user.ID) {
+		return
+	}
+
+	var request struct {
+		PostID  string `json:"post_id"`
+		Content string `json:"content"`
+		Status  string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.PostID == "" {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+	request.Content = strings.TrimSpace(request.Content)
+	if len(request.Content) > 1000 {
+		http.Error(w, "Content must not exceed 1000 characters", http.StatusBadRequest)
+		return
+	}
+	request.Status = strings.ToLower(request.Status)
+	if request.Status == "" {
+		request.Status = "public"
+	}
+	if request.Status != "public" && request.Status != "private" {
+		http.Error(w, "Reposts must be public or private", http.StatusBadRequest)
+		return
+	}
+
+	if !CheckUserPostPermission(user.ID, request.PostID) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	var ownerID, status, repostOf, content string
+	err := db.DB.QueryRow("SELECT user_id, status, COALESCE(repost_of, ''), content FROM posts WHERE id = ?", request.PostID).
+		Scan(&ownerID, &status, &repostOf, &content)
+	if err == nil && repostOf != "" && content == "" {
+		request.PostID = repostOf
+		if !CheckUserPostPermission(user.ID, request.PostID) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		err = db.DB.QueryRow("SELECT user_id, status FROM posts WHERE id = ?", request.PostID).Scan(&ownerID, &status)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		logger.LogError("Error loading post", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !canShare(ownerID, status, user.ID, request.Status) {
+		http.Error(w, "This post cannot be shared with that audience", http.StatusForbidden)
+		return
+	}
+
+	if request.Content == "" {
+		var exists bool
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE user_id = ? AND repost_of = ? AND content = '')",
+			user.ID, request.PostID).Scan(&exists); err != nil {
+			logger.LogError("Error checking reposts", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			http.Error(w, "Already reposted", http.StatusConflict)
+			return
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		http.Error(w, "Failed to generate post ID", http.StatusInternalServerError)
+		return
+	}
+	_, err = db.DB.Exec("INSERT INTO posts (id, title, content, user_id, author, creation_date, status, image, repost_of) VALUES (?, '', ?, ?, ?, ?, ?, '', ?)",
+		id.String(), request.Content, user.ID, user.Username, time.Now(), request.Status, request.PostID)
+	if err != nil {
+		logger.LogError("Error inserting repost", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if request.Content != "" {
+		tags.Index("post", id.String(), user.ID, request.Content)
+	}
+
+	if ownerID != user.ID {
+		if owner, ok := session.GetUsernameFromUserID(ownerID); ok {
+			message := "reposted your post"
+			if request.Content != "" {
+				message = "quoted your post"
+			}
+			notification.CreateNotificationMessage(owner, user.Username, notification.TypeRepost, message)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Post shared successfully", "post_id": id.String()})
+}
@@ -0,0 +1,10 @@
+package posts
+
+import "social-net/search"
+
+func init() {
+	search.RegisterType("post", func(userID string) (string, []interface{}) {
+		visible, args := VisibleTo(userID)
+		return "d.doc_id IN (SELECT p.id FROM posts p WHERE " + visible + ")", args
+	})
+}
@@ -0,0 +1,18 @@
+package posts
+
+import (
+	"social-net/db"
+	"social-net/tags"
+)
+
+func init() {
+	tags.RegisterTarget("post", tags.Target{
+		Noun:   "post",
+		CanSee: CheckUserPostPermission,
+		Preview: func(id string) (tags.Preview, error) {
+			var p tags.Preview
+			err := db.DB.QueryRow("SELECT content FROM posts WHERE id = ?", id).Scan(&p.Text)
+			return p, err
+		},
+	})
+}
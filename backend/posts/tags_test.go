@@ -0,0 +1,72 @@
+package posts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+	"social-net/session"
+	"social-net/tags"
+)
+
+func TestMentionsRespectPostPrivacy(t *testing.T) {
+	dbtest.Open(t)
+	author := dbtest.User(t, "u-author", "author", "author@test.local", true)
+	follower := dbtest.User(t, "u-follower", "follower", "follower@test.local", true)
+	stranger := dbtest.User(t, "u-stranger", "stranger", "stranger@test.local", true)
+	dbtest.Exec(t, "INSERT INTO Followers (id, follower_id, followed_id, status) VALUES ('f-mention', 'u-follower', 'u-author', 'accepted')")
+	insertPost(t, "p-private", author, "private")
+	insertPost(t, "p-public", author, "public")
+
+	tags.Index("post", "p-private", author, "Only for followers @follower @stranger")
+	tags.Index("post", "p-public", author, "For everyone @stranger")
+
+	myMentions := func(userID string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		session.RequireAuth(tags.MyMentions)(w, dbtest.SignedIn(t, http.MethodGet, "/api/mentions", nil, userID))
+		var page struct {
+			Mentions []tags.Mention `json:"mentions"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatalf("status %d: %v", w.Code, err)
+		}
+		var ids []string
+		for _, m := range page.Mentions {
+			ids = append(ids, m.TargetID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name              string
+		user              string
+		wantNotifications int
+		wantMentions      string
+	}{
+		{"follower", follower, 1, "p-private"},
+		{"stranger", stranger, 1, "p-public"},
+	}
+	for _, tt := range tests {
+		var count int
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = 'mention'", tt.user).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != tt.wantNotifications {
+			t.Errorf("%s: %d mention notification(s), want %d", tt.name, count, tt.wantNotifications)
+		}
+		if got := strings.Join(myMentions(tt.user), ","); got != tt.wantMentions {
+			t.Errorf("%s: mentions = %q, want %q", tt.name, got, tt.wantMentions)
+		}
+	}
+
+	// Mentions drop out of the list once the post is out of sight.
+	dbtest.Exec(t, "DELETE FROM Followers WHERE id = 'f-mention'")
+	if got := myMentions(follower); len(got) != 0 {
+		t.Errorf("after unfollowing: mentions = %v", got)
+	}
+}
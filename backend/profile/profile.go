@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"social-net/audit"
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
+	"social-net/reactions"
 	"social-net/session"
 )
 
@@ -31,16 +35,20 @@ type UserInfo struct {
 }
 
 type GetPost struct {
-	Id            string `json:"id"`
-	User_id       string `json:"user_id"`
-	Author        string `json:"author"`
-	Content       string `json:"content"`
-	Title         string `json:"title"`
-	Creation_date string `json:"creation_date"`
-	Status        string `json:"status"`
-	Avatar        string `json:"avatar"`
-	Image         string `json:"image"`
-	CommentsCount int    `json:"comments_count"`
+	Id            string            `json:"id"`
+	User_id       string            `json:"user_id"`
+	Author        string            `json:"author"`
+	Content       string            `json:"content"`
+	Title         string            `json:"title"`
+	Creation_date string            `json:"creation_date"`
+	Status        string            `json:"status"`
+	Avatar        string            `json:"avatar"`
+	Image         string            `json:"image"`
+	CommentsCount int               `json:"comments_count"`
+	Edited        bool              `json:"edited"`
+	EditedAt      *time.Time        `json:"edited_at"`
+	Reactions     reactions.Summary `json:"reactions"`
+	RepostOf      string            `json:"repost_of,omitempty"`
 }
 
 type Comments struct {
@@ -52,26 +60,16 @@ type Comments struct {
 }
 
 func GetUserInfo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	token, err := r.Cookie("token")
-	if token == nil || err != nil {
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-	sessionToken := token.Value
-	user_id, ok := session.GetUserIDFromToken(sessionToken)
-	if !ok || user_id == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	user_id := session.CurrentUserID(r)
 	username := r.URL.Query().Get("user_id")
 	if username == "" {
 		logger.LogError("Username is required", nil)
@@ -79,21 +77,20 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userID string
-	err1 := db.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
+	userID, err1 := session.ResolveUsername(username)
 	if err1 != nil {
 		if err1 == sql.ErrNoRows {
 			fmt.Println("No user found with the given username")
 			http.Error(w, "No user found", http.StatusNotFound)
 			return
 		}
-		logger.LogError("Error fetching user ID", err)
+		logger.LogError("Error fetching user ID", err1)
 		http.Error(w, "Error fetching user ID", http.StatusInternalServerError)
 		return
 	}
 
 	var userInfo UserInfo
-	err = db.DB.QueryRow("SELECT username, email, first_name, last_name, bio, date_of_birth, privacy, avatar, nickname FROM users WHERE id = ?", userID).Scan(
+	err := db.DB.QueryRow("SELECT username, email, first_name, last_name, bio, date_of_birth, privacy, avatar, nickname FROM users WHERE id = ?", userID).Scan(
 		&userInfo.Username, &userInfo.Email, &userInfo.FirstName, &userInfo.LastName, &userInfo.Bio, &userInfo.DateOfBirth, &userInfo.Privacy, &userInfo.Avatar, &userInfo.Nickname)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -167,10 +164,10 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -181,18 +178,7 @@ func UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
 		Privacy string `json:"privacy"`
 	}
 
-	token, err := r.Cookie("token")
-	fmt.Println("TokenVAlue:", token.Value)
-	fmt.Println("Token:", token)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userID, ok := session.GetUserIDFromToken(token.Value)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -210,7 +196,7 @@ func UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = db.DB.Exec("UPDATE users SET privacy = ? WHERE username = ?", request.Privacy, username)
+	_, err := db.DB.Exec("UPDATE users SET privacy = ? WHERE username = ?", request.Privacy, username)
 	if err != nil {
 		logger.LogError("Failed to update privacy", err)
 		http.Error(w, "Failed to update privacy", http.StatusInternalServerError)
@@ -226,11 +212,37 @@ func UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	audit.Log(r, userID, "privacy_changed", "user", userID, audit.Meta{"privacy": request.Privacy})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
+// LoadUserInfo fills a UserInfo for the given user id, without the viewer
+// specific follow status.
+func LoadUserInfo(userID string) (UserInfo, error) {
+	var userInfo UserInfo
+	err := db.DB.QueryRow("SELECT username, email, first_name, last_name, bio, date_of_birth, privacy, avatar, nickname FROM users WHERE id = ?", userID).Scan(
+		&userInfo.Username, &userInfo.Email, &userInfo.FirstName, &userInfo.LastName, &userInfo.Bio, &userInfo.DateOfBirth, &userInfo.Privacy, &userInfo.Avatar, &userInfo.Nickname)
+	if err != nil {
+		return userInfo, err
+	}
+	if userInfo.FollowersCount, err = GetFollowersCount(userID); err != nil {
+		return userInfo, err
+	}
+	if userInfo.FollowingCount, err = GetFollowingCount(userID); err != nil {
+		return userInfo, err
+	}
+	if userInfo.FollowerUsernames, err = GetFollowerUsernames(userID); err != nil {
+		return userInfo, err
+	}
+	if userInfo.FollowingUsernames, err = GetFollowingUsernames(userID); err != nil {
+		return userInfo, err
+	}
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM posts WHERE user_id = ?", userID).Scan(&userInfo.PostsCount)
+	return userInfo, err
+}
+
 func GetFollowersCount(userID string) (int, error) {
 	var count int
 	err := db.DB.QueryRow("SELECT COUNT(*) FROM followers WHERE followed_id = ? AND status = 'accepted'", userID).Scan(&count)
@@ -294,26 +306,15 @@ func GetFollowingUsernames(userID string) ([]string, error) {
 }
 
 func IsFollowing(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-	sessionToken := token.Value
-	userID, ok := session.GetUserIDFromToken(sessionToken)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
 
 	followerUsername := r.URL.Query().Get("follower_id")
 	followedUsername := r.URL.Query().Get("followed_id")
@@ -327,13 +328,13 @@ func IsFollowing(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var followerID, followedID string
-	err = db.DB.QueryRow("SELECT id FROM users WHERE username = ?", followerUsername).Scan(&followerID)
+	followerID, err := session.ResolveUsername(followerUsername)
 	if err != nil {
 		http.Error(w, "Error finding follower user", http.StatusInternalServerError)
 		return
 	}
 
-	err = db.DB.QueryRow("SELECT id FROM users WHERE username = ?", followedUsername).Scan(&followedID)
+	followedID, err = session.ResolveUsername(followedUsername)
 	if err != nil {
 		http.Error(w, "Error finding followed user", http.StatusInternalServerError)
 		return
@@ -363,27 +364,16 @@ func IsAcceptedFollower(viewerID, ownerID string) (bool, error) {
 }
 
 func GetOwnPosts(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	token, err1 := r.Cookie("token")
-	if err1 != nil {
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-	sessionToken := token.Value
-	CurrentUserid, ok := session.GetUserIDFromToken(sessionToken)
-	if !ok || CurrentUserid == "" {
-		fmt.Println("Invalid token")
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	CurrentUserid := session.CurrentUserID(r)
 	username := r.URL.Query().Get("username")
 
 	if username == "" {
@@ -391,8 +381,7 @@ func GetOwnPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userID string
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
+	userID, err := session.ResolveUsername(username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println("No user found with the given username")
@@ -404,7 +393,7 @@ func GetOwnPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := `
-		SELECT DISTINCT p.id, p.user_id, p.author, p.content, p.title, p.creation_date, p.status, u.avatar, p.image
+		SELECT DISTINCT p.id, p.user_id, p.author, p.content, p.title, p.creation_date, p.status, u.avatar, p.image, p.edited_at, COALESCE(p.repost_of, '')
 		FROM posts p
 		LEFT JOIN postsPrivacy pp ON p.id = pp.post_id
 		LEFT JOIN users u ON p.user_id = u.id
@@ -429,15 +418,23 @@ ORDER BY p.creation_date DESC
 	var posts []GetPost
 	for rows.Next() {
 		var post GetPost
-		err := rows.Scan(&post.Id, &post.User_id, &post.Author, &post.Content, &post.Title, &post.Creation_date, &post.Status, &post.Avatar, &post.Image)
+		err := rows.Scan(&post.Id, &post.User_id, &post.Author, &post.Content, &post.Title, &post.Creation_date, &post.Status, &post.Avatar, &post.Image, &post.EditedAt, &post.RepostOf)
 		if err != nil {
 			http.Error(w, "Error scanning posts", http.StatusInternalServerError)
 			return
 		}
+		post.Edited = post.EditedAt != nil
 		posts = append(posts, post)
 	}
 
+	ids := make([]string, len(posts))
 	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	summaries := reactions.LoadOrEmpty("post", ids, CurrentUserid)
+
+	for i, post := range posts {
+		posts[i].Reactions = summaries.For(post.Id)
 
 		var commentsCount int
 		err := db.DB.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = ?", post.Id).Scan(&commentsCount)
@@ -454,10 +451,10 @@ ORDER BY p.creation_date DESC
 }
 
 func GetFollowersAndFollowing(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	profileUser := r.URL.Query().Get("profileUser")
 	if profileUser == "" {
@@ -465,17 +462,7 @@ func GetFollowersAndFollowing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	tokenValue := token.Value
-	userID, ok := session.GetUserIDFromToken(tokenValue)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 	currentUser, _ := session.GetUsernameFromUserID(userID)
 
 	followersQuery := `
@@ -539,18 +526,12 @@ func GetFollowersAndFollowing(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetFollowersAndFollowingPosts(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
-	token, _ := r.Cookie("token")
-	tokenValue := token.Value
-	userID, ok := session.GetUserIDFromToken(tokenValue)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	followersQuery := `
 		SELECT follower_id
@@ -615,17 +596,12 @@ func GetFollowersAndFollowingPosts(w http.ResponseWriter, r *http.Request) {
 }
 
 func CheckMyPrivacy(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
-	token, _ := r.Cookie("token")
-	username1, ok := session.GetUserIDFromToken(token.Value)
-	if !ok || username1 == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	username1 := session.CurrentUserID(r)
 	username, _ := session.GetUsernameFromUserID(username1)
 
 	row := db.DB.QueryRow(`SELECT privacy FROM users WHERE username=?`, username)
@@ -641,18 +617,12 @@ func CheckMyPrivacy(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetInvitationsFollow(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
-	token, _ := r.Cookie("token")
-	tokenValue := token.Value
-	userID, ok := session.GetUserIDFromToken(tokenValue)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	rows, err := db.DB.Query("SELECT follower_id FROM Followers WHERE followed_id = ? AND status = 'pending'", userID)
 	if err != nil {
@@ -695,18 +665,12 @@ func GetInvitationsFollow(w http.ResponseWriter, r *http.Request) {
 }
 
 func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
-	token, _ := r.Cookie("token")
-	tokenValue := token.Value
-	userID, ok := session.GetUserIDFromToken(tokenValue)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	userID := session.CurrentUserID(r)
 
 	var data struct {
 		FollowerID string `json:"follower_id"`
@@ -727,6 +691,7 @@ func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to update invitation status", http.StatusInternalServerError)
 		return
 	}
+	audit.Log(r, userID, "follow_request_accepted", "user", follower_id, nil)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
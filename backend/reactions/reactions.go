@@ -0,0 +1,227 @@
+package reactions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/notification"
+	"social-net/session"
+
+	"github.com/gofrs/uuid"
+)
+
+// Kinds is the fixed set of reactions, by name, with the emoji shown for
+// each.
+var Kinds = map[string]string{
+	"like":  "👍",
+	"love":  "❤️",
+	"haha":  "😂",
+	"wow":   "😮",
+	"sad":   "😢",
+	"angry": "😠",
+}
+
+// Target describes something users can react to. The packages owning the
+// content register it, since this one cannot import them.
+type Target struct {
+	// Noun names the target in notifications, e.g. "post".
+	Noun string
+	// Author returns the user id of the author, or sql.ErrNoRows.
+	Author func(id string) (string, error)
+	// CanSee reports whether userID may view, and so react to, the target.
+	CanSee func(userID string, id string) bool
+}
+
+var (
+	targetsMu sync.RWMutex
+	targets   = map[string]Target{}
+)
+
+func RegisterTarget(targetType string, t Target) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	targets[targetType] = t
+}
+
+func lookupTarget(targetType string) (Target, bool) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	t, ok := targets[targetType]
+	return t, ok
+}
+
+// Summary is what listings show for one target: the count per reaction and
+// the reaction of the viewer, if any.
+type Summary struct {
+	Counts     map[string]int `json:"counts"`
+	Total      int            `json:"total"`
+	MyReaction string         `json:"my_reaction"`
+}
+
+type Summaries map[string]Summary
+
+// For returns the summary of id, empty when nobody reacted.
+func (s Summaries) For(id string) Summary {
+	if summary, ok := s[id]; ok {
+		return summary
+	}
+	return Summary{Counts: map[string]int{}}
+}
+
+// Load returns the summaries of the given targets as seen by viewerID.
+func Load(targetType string, ids []string, viewerID string) (Summaries, error) {
+	summaries := Summaries{}
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+	args := []interface{}{viewerID, targetType}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(`SELECT target_id, reaction, COUNT(*), MAX(user_id = ?) FROM reactions
+		WHERE target_type = ? AND target_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		GROUP BY target_id, reaction`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, reaction string
+		var count int
+		var mine bool
+		if err := rows.Scan(&id, &reaction, &count, &mine); err != nil {
+			return nil, err
+		}
+		summary := summaries.For(id)
+		summary.Counts[reaction] = count
+		summary.Total += count
+		if mine {
+			summary.MyReaction = reaction
+		}
+		summaries[id] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// LoadOrEmpty is Load for listings: on failure it logs and returns no
+// summaries, so the listing still renders without counts.
+func LoadOrEmpty(targetType string, ids []string, viewerID string) Summaries {
+	summaries, err := Load(targetType, ids, viewerID)
+	if err != nil {
+		logger.LogError("Error loading reactions", err)
+		return Summaries{}
+	}
+	return summaries
+}
+
+// setReaction applies the toggle: reacting again with the same reaction
+// removes it, another reaction replaces it. It returns the user's reaction
+// afterwards and whether it is new.
+func setReaction(targetType string, targetID string, userID string, reaction string) (string, bool, error) {
+	var current string
+	err := db.DB.QueryRow("SELECT reaction FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ?",
+		targetType, targetID, userID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return "", false, err
+	}
+	if current == reaction {
+		_, err := db.DB.Exec("DELETE FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ?", targetType, targetID, userID)
+		return "", false, err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", false, err
+	}
+	_, err = db.DB.Exec(`INSERT INTO reactions (id, target_type, target_id, user_id, reaction, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(target_type, target_id, user_id) DO UPDATE SET reaction = excluded.reaction, created_at = excluded.created_at`,
+		id.String(), targetType, targetID, userID, reaction, time.Now())
+	return reaction, err == nil, err
+}
+
+// React toggles the caller's reaction on {target_type, target_id} and
+// answers with the updated summary. The author is notified of new reactions.
+func React(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		TargetType string `json:"target_type"`
+		TargetID   string `json:"target_id"`
+		Reaction   string `json:"reaction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.TargetID == "" {
+		http.Error(w, "target_type, target_id and reaction are required", http.StatusBadRequest)
+		return
+	}
+	target, ok := lookupTarget(request.TargetType)
+	if !ok {
+		http.Error(w, "Unknown target type", http.StatusBadRequest)
+		return
+	}
+	emoji, ok := Kinds[request.Reaction]
+	if !ok {
+		http.Error(w, "Unknown reaction", http.StatusBadRequest)
+		return
+	}
+
+	user, _ := session.CurrentUser(r)
+	authorID, err := target.Author(request.TargetID)
+	if err != nil || !target.CanSee(user.ID, request.TargetID) {
+		if err != nil && err != sql.ErrNoRows {
+			logger.LogError("Error loading reaction target", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	mine, added, err := setReaction(request.TargetType, request.TargetID, user.ID, request.Reaction)
+	if err != nil {
+		logger.LogError("Error saving reaction", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if added && authorID != user.ID {
+		if author, ok := session.GetUsernameFromUserID(authorID); ok {
+			notification.CreateNotificationMessage(author, user.Username, notification.TypeReaction,
+				"reacted "+emoji+" to your "+target.Noun)
+		}
+	}
+
+	summaries, err := Load(request.TargetType, []string{request.TargetID}, user.ID)
+	if err != nil {
+		logger.LogError("Error loading reactions", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	summary := summaries.For(request.TargetID)
+	summary.MyReaction = mine
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"target_type": request.TargetType,
+		"target_id":   request.TargetID,
+		"reactions":   summary,
+	})
+}
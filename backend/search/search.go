@@ -0,0 +1,315 @@
+package search
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/session"
+)
+
+// Visibility returns a condition on the search_documents row aliased d
+// selecting what userID may see, with its arguments.
+type Visibility func(userID string) (string, []interface{})
+
+var (
+	typesMu sync.RWMutex
+	types   = map[string]Visibility{}
+)
+
+// RegisterType makes documents of docType searchable. The packages owning
+// the content register it, since this one cannot import them; documents of
+// unregistered types are never returned.
+func RegisterType(docType string, visible Visibility) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	types[docType] = visible
+}
+
+// hasFTS is set by Init when the driver supports FTS5. Without it searches
+// fall back to substring matching, newest first.
+var hasFTS bool
+
+// Init creates the FTS5 index over search_documents and the triggers keeping
+// it in sync, rebuilding it when they were missing. Builds without FTS5 drop
+// those triggers instead, or every write to indexed tables would fail.
+func Init() {
+	var available, exists bool
+	err := db.DB.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5'),
+		EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'search_fts_ai')`).Scan(&available, &exists)
+	if err != nil {
+		logger.LogError("Error checking the search index", err)
+		return
+	}
+
+	if !available {
+		log.Println("Full-text search unavailable (build with -tags sqlite_fts5), using substring search")
+		for _, name := range []string{"search_fts_ai", "search_fts_ad", "search_fts_au"} {
+			if _, err := db.DB.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				logger.LogError("Error dropping search trigger", err)
+			}
+		}
+		return
+	}
+	if exists {
+		hasFTS = true
+		return
+	}
+
+	for _, query := range []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_fts USING fts5(title, body,
+			content = 'search_documents', content_rowid = 'id', tokenize = 'unicode61 remove_diacritics 2')`,
+		`CREATE TRIGGER IF NOT EXISTS search_fts_ai AFTER INSERT ON search_documents BEGIN
+			INSERT INTO search_fts (rowid, title, body) VALUES (new.id, new.title, new.body);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS search_fts_ad AFTER DELETE ON search_documents BEGIN
+			INSERT INTO search_fts (search_fts, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS search_fts_au AFTER UPDATE ON search_documents BEGIN
+			INSERT INTO search_fts (search_fts, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+			INSERT INTO search_fts (rowid, title, body) VALUES (new.id, new.title, new.body);
+		END`,
+		"INSERT INTO search_fts (search_fts) VALUES ('rebuild')",
+	} {
+		if _, err := db.DB.Exec(query); err != nil {
+			logger.LogError("Error creating the search index", err)
+			return
+		}
+	}
+	hasFTS = true
+}
+
+var termPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// matchQuery turns free text into an FTS5 query: every word must appear,
+// as a prefix, so user input can never be a syntax error.
+func matchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Result is one search hit. ParentID is the post of a comment and the group
+// of a group post or event.
+type Result struct {
+	Type      string     `json:"type"`
+	ID        string     `json:"id"`
+	ParentID  string     `json:"parent_id,omitempty"`
+	Title     string     `json:"title"`
+	Snippet   string     `json:"snippet"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// Search answers ?q= with the matching documents the caller can see, best
+// first. ?type= restricts the results to a comma-separated list of types;
+// ?limit= and ?offset= page through them.
+func Search(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	terms := termPattern.FindAllString(strings.ToLower(q.Get("q")), 10)
+	if len(terms) == 0 {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	typesMu.RLock()
+	var wanted []string
+	if t := q.Get("type"); t != "" {
+		for _, name := range strings.Split(t, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := types[name]; !ok {
+				typesMu.RUnlock()
+				http.Error(w, "Unknown type: "+name, http.StatusBadRequest)
+				return
+			}
+			wanted = append(wanted, name)
+		}
+	} else {
+		for name := range types {
+			wanted = append(wanted, name)
+		}
+		sort.Strings(wanted)
+	}
+
+	userID := session.CurrentUserID(r)
+	var visible []string
+	var args []interface{}
+	for _, name := range wanted {
+		cond, condArgs := types[name](userID)
+		visible = append(visible, "(d.doc_type = ? AND "+cond+")")
+		args = append(append(args, name), condArgs...)
+	}
+	typesMu.RUnlock()
+	where := " AND (" + strings.Join(visible, " OR ") + ")"
+
+	var results []Result
+	var err error
+	if hasFTS {
+		results, err = searchFTS(terms, where, args, limit+1, offset)
+	} else {
+		results, err = searchLike(terms, where, args, limit+1, offset)
+	}
+	if err != nil {
+		logger.LogError("Error searching", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":       strings.Join(terms, " "),
+		"results":     results,
+		"offset":      offset,
+		"next_offset": offset + len(results),
+		"has_more":    hasMore,
+	})
+}
+
+// searchFTS ranks by bm25, with title matches weighing double, and lets
+// FTS5 cut the snippet around the matched terms.
+func searchFTS(terms []string, where string, args []interface{}, limit int, offset int) ([]Result, error) {
+	return queryResults(`SELECT d.doc_type, d.doc_id, d.parent_id, d.title,
+		snippet(search_fts, 1, '', '', '…', 24), d.created_at
+		FROM search_fts JOIN search_documents d ON d.id = search_fts.rowid
+		WHERE search_fts MATCH ?`+where+`
+		ORDER BY bm25(search_fts, 2.0, 1.0), d.id DESC LIMIT ? OFFSET ?`,
+		append(append([]interface{}{matchQuery(terms)}, args...), limit, offset), nil)
+}
+
+// searchLike is the fallback without FTS5: every term must appear in the
+// title or body, and the newest documents come first.
+func searchLike(terms []string, where string, args []interface{}, limit int, offset int) ([]Result, error) {
+	match := ""
+	var matchArgs []interface{}
+	for _, term := range terms {
+		match += " AND (d.title LIKE ? OR d.body LIKE ?)"
+		matchArgs = append(matchArgs, "%"+term+"%", "%"+term+"%")
+	}
+	return queryResults(`SELECT d.doc_type, d.doc_id, d.parent_id, d.title, d.body, d.created_at
+		FROM search_documents d
+		WHERE 1=1`+match+where+`
+		ORDER BY d.created_at DESC, d.id DESC LIMIT ? OFFSET ?`,
+		append(append(matchArgs, args...), limit, offset),
+		func(body string) string { return excerpt(body, terms[0]) })
+}
+
+// queryResults scans search hits; the fifth column is the snippet, passed
+// through cut when given.
+func queryResults(query string, args []interface{}, cut func(string) string) ([]Result, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []Result{}
+	for rows.Next() {
+		var res Result
+		if err := rows.Scan(&res.Type, &res.ID, &res.ParentID, &res.Title, &res.Snippet, &res.CreatedAt); err != nil {
+			return nil, err
+		}
+		if cut != nil {
+			res.Snippet = cut(res.Snippet)
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+// excerpt returns about 160 characters of text around the first occurrence
+// of term.
+func excerpt(text string, term string) string {
+	const width = 160
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	start := 0
+	if i := indexFold(runes, []rune(term)); i >= 0 {
+		start = i - width/3
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(runes) {
+		end, start = len(runes), len(runes)-width
+	}
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// indexFold returns the position in runes of the first match of term under
+// Unicode case folding, or -1. It works on runes rather than on a lowered
+// copy of the text, whose byte offsets can differ from the original's.
+func indexFold(runes []rune, term []rune) int {
+	for i := 0; i+len(term) <= len(runes); i++ {
+		match := true
+		for j, r := range term {
+			if !equalFold(runes[i+j], r) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// equalFold reports whether a and b are the same rune up to case.
+func equalFold(a rune, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
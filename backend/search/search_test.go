@@ -0,0 +1,45 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExcerpt(t *testing.T) {
+	filler := strings.Repeat("a", 300)
+	tests := []struct {
+		name string
+		text string
+		term string
+		// want is a part the excerpt must contain.
+		want       string
+		wantPrefix bool
+		wantSuffix bool
+	}{
+		{"short text is kept", "a short post", "post", "a short post", false, false},
+		{"term in the middle", filler + " needle " + filler, "needle", "needle", true, true},
+		{"term in another case", filler + " NeEdLe " + filler, "needle", "NeEdLe", true, true},
+		{"term at the end", filler + " needle", "needle", "needle", true, false},
+		{"missing term starts at the beginning", "needle" + filler, "thread", "needle", false, true},
+		// Lowering Ⱥ makes it a byte longer and İ a byte shorter, so offsets
+		// into a lowered copy do not fit the original text.
+		{"text that grows when lowered", strings.Repeat("Ⱥ", 400) + " needle " + filler, "needle", "needle", true, true},
+		{"text that shrinks when lowered", strings.Repeat("İ", 400) + " needle " + filler, "needle", "needle", true, true},
+		{"multi-byte term", filler + " Ärger " + filler, "ärger", "Ärger", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := excerpt(tt.text, tt.term)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("excerpt %q does not contain %q", got, tt.want)
+			}
+			if strings.HasPrefix(got, "…") != tt.wantPrefix || strings.HasSuffix(got, "…") != tt.wantSuffix {
+				t.Errorf("excerpt %q: ellipsis before = %v, after = %v", got, tt.wantPrefix, tt.wantSuffix)
+			}
+			if n := utf8.RuneCountInString(strings.Trim(got, "…")); n > 160 {
+				t.Errorf("excerpt has %d characters", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"social-net/config"
+)
+
+// User is the authenticated caller of a request, as stored in its context
+// by RequireAuth and OptionalAuth.
+type User struct {
+	ID       string
+	Username string
+	Role     string
+	// SessionID is empty when the request used an access token.
+	SessionID string
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+type contextKey struct{}
+
+var errNotAuthenticated = errors.New("not authenticated")
+
+// Authenticate resolves the caller from the bearer token or session cookie.
+// Sessions are touched the same way GetUserIDFromToken does.
+func Authenticate(r *http.Request) (User, error) {
+	var u User
+	cookie, err := AuthCookie(r)
+	if err != nil {
+		return u, err
+	}
+	if isAccessToken(cookie.Value) {
+		userID, ok := accessTokenUser(cookie.Value)
+		if !ok {
+			return u, errInvalidToken
+		}
+		u.ID = userID
+	} else {
+		rec, ok := activeSession(cookie.Value)
+		if !ok {
+			return u, errNotAuthenticated
+		}
+		rec.touch()
+		u.ID, u.SessionID = rec.UserID, rec.SessionID
+	}
+
+	username, ok := GetUsernameFromUserID(u.ID)
+	if !ok {
+		return u, errNotAuthenticated
+	}
+	u.Username = username
+	u.Role = UserRole(u.ID)
+	return u, nil
+}
+
+// CurrentUser returns the caller stored by the auth middleware.
+func CurrentUser(r *http.Request) (User, bool) {
+	u, ok := r.Context().Value(contextKey{}).(User)
+	return u, ok
+}
+
+// CurrentUserID is CurrentUser for handlers that only need the id.
+func CurrentUserID(r *http.Request) string {
+	u, _ := CurrentUser(r)
+	return u.ID
+}
+
+func withUser(r *http.Request, u User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, u))
+}
+
+// RequireAuth only calls next for authenticated requests; the others get a
+// JSON 401, or 403 when an access token lacks the scope. Preflight requests
+// go straight through since browsers send them without credentials.
+func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		u, err := Authenticate(r)
+		if err != nil {
+			if err == ErrInsufficientScope {
+				writeAuthError(w, r, http.StatusForbidden, "forbidden", err.Error())
+				return
+			}
+			message := "Invalid or expired session"
+			if err == http.ErrNoCookie {
+				message = "Missing token"
+			}
+			writeAuthError(w, r, http.StatusUnauthorized, "unauthorized", message)
+			return
+		}
+		next(w, withUser(r, u))
+	}
+}
+
+// OptionalAuth stores the caller when there is one and lets anonymous
+// requests through.
+func OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if u, err := Authenticate(r); err == nil {
+			r = withUser(r, u)
+		}
+		next(w, r)
+	}
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   code,
+		"message": message,
+	})
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-net/db/dbtest"
+)
+
+// recordCaller is a handler that remembers the caller it was given.
+func recordCaller(called *bool, caller *User) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		*caller, _ = CurrentUser(r)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	dbtest.Open(t)
+	userID := dbtest.User(t, "u-caller", "caller", "caller@test.local", true)
+	token := Setsession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), userID)
+	readToken, _, err := CreateAccessToken(userID, "read", []string{ScopeRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	insertSession(t, "s-expired", userID, "t-expired", "", now.Add(-3*time.Hour), now.Add(-3*time.Hour), now.Add(-time.Minute))
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		bearer string
+		// wantStatus and wantMessage are RequireAuth's answer; 0 means it
+		// calls the handler.
+		wantStatus  int
+		wantMessage string
+		wantCaller  bool
+	}{
+		{"session cookie", http.MethodGet, token, "", 0, "", true},
+		{"access token", http.MethodGet, "", readToken, 0, "", true},
+		{"no cookie", http.MethodGet, "", "", http.StatusUnauthorized, "Missing token", false},
+		{"unknown cookie", http.MethodGet, "t-unknown", "", http.StatusUnauthorized, "Invalid or expired session", false},
+		{"expired session", http.MethodGet, "t-expired", "", http.StatusUnauthorized, "Invalid or expired session", false},
+		{"unknown access token", http.MethodGet, "", TokenPrefix + "unknown", http.StatusUnauthorized, "Invalid or expired session", false},
+		{"access token without the scope", http.MethodPost, "", readToken, http.StatusForbidden, "token does not have the required scope", false},
+		{"preflight", http.MethodOptions, "", "", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newRequest := func() *http.Request {
+				r := httptest.NewRequest(tt.method, "/", nil)
+				if tt.cookie != "" {
+					r.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+				}
+				if tt.bearer != "" {
+					r.Header.Set("Authorization", "Bearer "+tt.bearer)
+				}
+				return r
+			}
+
+			var called bool
+			var caller User
+			w := httptest.NewRecorder()
+			RequireAuth(recordCaller(&called, &caller))(w, newRequest())
+			if tt.wantStatus == 0 {
+				if !called {
+					t.Fatalf("RequireAuth did not call the handler: %d %s", w.Code, w.Body)
+				}
+			} else {
+				var body map[string]string
+				if called {
+					t.Fatal("RequireAuth called the handler")
+				}
+				if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != "application/json" {
+					t.Errorf("status = %d, content type = %q", w.Code, w.Header().Get("Content-Type"))
+				}
+				if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["message"] != tt.wantMessage || body["error"] == "" {
+					t.Errorf("body = %v, %v, want message %q", body, err, tt.wantMessage)
+				}
+			}
+			if tt.wantCaller && (caller.ID != userID || caller.Username != "caller" || caller.Role != RoleUser) {
+				t.Errorf("RequireAuth stored caller %+v", caller)
+			}
+
+			// OptionalAuth calls the handler either way, with the same caller.
+			called, caller = false, User{}
+			OptionalAuth(recordCaller(&called, &caller))(httptest.NewRecorder(), newRequest())
+			if !called {
+				t.Fatal("OptionalAuth did not call the handler")
+			}
+			if (caller.ID == userID) != tt.wantCaller {
+				t.Errorf("OptionalAuth stored caller %+v", caller)
+			}
+		})
+	}
+}
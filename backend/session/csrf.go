@@ -0,0 +1,121 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"social-net/config"
+)
+
+// State-changing requests authenticated by cookie must echo the csrf_token
+// cookie in the X-CSRF-Token header (double submit). The cookie is readable
+// by scripts on allowed origins only, so a cross-site form cannot copy it.
+// Requests carrying an Origin header must also come from a configured
+// origin.
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if config.OriginAllowed(origin) {
+		return true
+	}
+	// Same-origin requests, e.g. from pages served under /static/.
+	return strings.EqualFold(strings.TrimPrefix(strings.TrimPrefix(origin, "http://"), "https://"), r.Host)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func newCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func setCSRFCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(config.Current.SessionAbsoluteTimeout.Seconds()),
+		Secure:   config.Current.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CSRFProtect checks every request before it reaches the mux. Bearer token
+// requests are exempt since browsers never attach that header on their own.
+// Websocket handshakes are GETs, so they are only checked for their origin.
+func CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !originAllowed(r) {
+			writeAuthError(w, r, http.StatusForbidden, "csrf", "Origin not allowed")
+			return
+		}
+		if safeMethod(r.Method) || bearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(CSRFCookieName)
+		header := r.Header.Get(CSRFHeaderName)
+		if err != nil || cookie.Value == "" || header == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			writeAuthError(w, r, http.StatusForbidden, "csrf", "Missing or invalid CSRF token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFToken hands the frontend its token, issuing the cookie if needed.
+func CSRFToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := ""
+	if cookie, err := r.Cookie(CSRFCookieName); err == nil && len(cookie.Value) == 64 {
+		token = cookie.Value
+	} else {
+		if token, err = newCSRFToken(); err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+	}
+	setCSRFCookie(w, token)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"csrf_token": token,
+		"header":     CSRFHeaderName,
+	})
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	handler := CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		cookie string
+		header string
+		bearer bool
+		want   int
+	}{
+		{"GET needs no token", http.MethodGet, "", "", "", false, http.StatusNoContent},
+		{"OPTIONS needs no token", http.MethodOptions, "http://localhost:8081", "", "", false, http.StatusNoContent},
+		{"POST with matching cookie and header", http.MethodPost, "http://localhost:8081", token, token, false, http.StatusNoContent},
+		{"POST without cookie", http.MethodPost, "", "", token, false, http.StatusForbidden},
+		{"POST without header", http.MethodPost, "", token, "", false, http.StatusForbidden},
+		{"POST with mismatched header", http.MethodPost, "", token, token[:63] + "0", false, http.StatusForbidden},
+		{"DELETE without token", http.MethodDelete, "", "", "", false, http.StatusForbidden},
+		{"bearer token request is exempt", http.MethodPost, "", "", "", true, http.StatusNoContent},
+		{"POST from a foreign origin", http.MethodPost, "https://evil.example", token, token, false, http.StatusForbidden},
+		{"GET from a foreign origin", http.MethodGet, "https://evil.example", "", "", false, http.StatusForbidden},
+		{"same-host origin", http.MethodPost, "http://example.com", token, token, false, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com/api/posts", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeaderName, tt.header)
+			}
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer "+TokenPrefix+"abc")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenReusesCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	CSRFToken(w, httptest.NewRequest(http.MethodGet, "/api/csrf", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookieName || len(cookies[0].Value) != 64 {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/csrf", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	CSRFToken(w, r)
+	if again := w.Result().Cookies(); len(again) != 1 || again[0].Value != cookies[0].Value {
+		t.Errorf("token changed on the second request: %v", again)
+	}
+}
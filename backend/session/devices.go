@@ -0,0 +1,234 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+)
+
+type DeviceSession struct {
+	SessionID  string    `json:"session_id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// DeviceName returns the name the client gave for this device, or a rough
+// guess based on the user agent when none was sent.
+func DeviceName(r *http.Request) string {
+	if name := strings.TrimSpace(r.Header.Get("X-Device-Name")); name != "" {
+		if len(name) > 64 {
+			name = name[:64]
+		}
+		return name
+	}
+
+	ua := strings.ToLower(r.UserAgent())
+	var platform string
+	switch {
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	default:
+		return "Unknown device"
+	}
+
+	switch {
+	case strings.Contains(ua, "edg/"):
+		return "Edge on " + platform
+	case strings.Contains(ua, "firefox/"):
+		return "Firefox on " + platform
+	case strings.Contains(ua, "chrome/"):
+		return "Chrome on " + platform
+	case strings.Contains(ua, "safari/"):
+		return "Safari on " + platform
+	}
+	return platform
+}
+
+// ClientIP is the address of the client behind r. X-Forwarded-For is only
+// believed when the connection comes from a configured proxy, and is read
+// from the right so entries a client added itself are never used.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !config.Current.TrustedProxy(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !config.Current.TrustedProxy(ip) {
+			break
+		}
+	}
+	return host
+}
+
+func GetUserSessions(userID string) ([]DeviceSession, error) {
+	rows, err := db.DB.Query(`
+		SELECT session_id, device, user_agent, ip, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_used_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []DeviceSession{}
+	for rows.Next() {
+		var s DeviceSession
+		var createdAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&s.SessionID, &s.Device, &s.UserAgent, &s.IP, &createdAt, &lastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		s.CreatedAt = createdAt.Time
+		s.LastUsedAt = lastUsedAt.Time
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func DeleteSessionByID(userID string, sessionID string) (bool, error) {
+	res, err := db.DB.Exec("DELETE FROM sessions WHERE user_id=? AND session_id=?", userID, sessionID)
+	if err != nil {
+		logger.LogError("Error deleting session", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func CurrentSessionID(token string) string {
+	rec, _ := activeSession(token)
+	return rec.SessionID
+}
+
+func DeleteOtherSessions(userID string, keepSessionID string) error {
+	_, err := db.DB.Exec("DELETE FROM sessions WHERE user_id=? AND session_id!=?", userID, keepSessionID)
+	if err != nil {
+		logger.LogError("Error deleting sessions", err)
+	}
+	return err
+}
+
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := CurrentUser(r)
+	userID := user.ID
+
+	sessions, err := GetUserSessions(userID)
+	if err != nil {
+		logger.LogError("Error listing sessions", err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == user.SessionID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession ends one session by id, or every session except the calling
+// one when "all" is set. Revoking the current session also clears its cookie.
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := CurrentUser(r)
+	userID := user.ID
+
+	var request struct {
+		SessionID string `json:"session_id"`
+		All       bool   `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if request.All {
+		if err := DeleteOtherSessions(userID, user.SessionID); err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+		securityEvent(r, "sessions_revoked", "user", userID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Other sessions revoked"})
+		return
+	}
+
+	if request.SessionID == "" {
+		http.Error(w, "session_id is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := DeleteSessionByID(userID, request.SessionID)
+	if err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	securityEvent(r, "session_revoked", "session", request.SessionID)
+	if request.SessionID == user.SessionID {
+		ClearTokenCookie(w)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
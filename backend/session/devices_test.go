@@ -0,0 +1,46 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"social-net/config"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := config.Default()
+	cfg.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.Current
+	config.Current = cfg
+	t.Cleanup(func() { config.Current = previous })
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"untrusted sender cannot spoof", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"client-supplied hops are skipped", "10.0.0.1:5000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:5000", "198.51.100.1, 192.168.4.4", "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.1:5000", "", "10.0.0.1"},
+		{"garbage from a trusted proxy", "10.0.0.1:5000", "not-an-ip", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package session
+
+import (
+	"net/http"
+	"sync"
+)
+
+// The audit package depends on this one, so revocations and tokens handled
+// here are reported to it through these hooks.
+var (
+	eventHooksMu sync.Mutex
+	eventHooks   []func(r *http.Request, action string, targetType string, targetID string)
+)
+
+// OnSecurityEvent registers fn to run when the session package changes a
+// credential on behalf of the caller of r.
+func OnSecurityEvent(fn func(r *http.Request, action string, targetType string, targetID string)) {
+	eventHooksMu.Lock()
+	defer eventHooksMu.Unlock()
+	eventHooks = append(eventHooks, fn)
+}
+
+func securityEvent(r *http.Request, action string, targetType string, targetID string) {
+	eventHooksMu.Lock()
+	hooks := append([]func(*http.Request, string, string, string){}, eventHooks...)
+	eventHooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(r, action, targetType, targetID)
+	}
+}
@@ -3,7 +3,7 @@ package session
 import "net/http"
 
 func IsLoggedIn(r *http.Request) bool {
-	tokene, err := r.Cookie("token")
+	tokene, err := AuthCookie(r)
 	if err != nil {
 		return false
 	}
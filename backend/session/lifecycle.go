@@ -0,0 +1,169 @@
+package session
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+
+	"github.com/gofrs/uuid"
+)
+
+// sessionRecord is a row of sessions. A session ends after the configured
+// idle timeout without requests, or the absolute timeout after login,
+// whichever comes first. Tokens older than SessionRotateAfter are replaced on
+// the next renewal; the replaced token keeps working for SessionRotationGrace
+// so requests already in flight are not rejected.
+type sessionRecord struct {
+	SessionID string
+	UserID    string
+	Token     string
+	CreatedAt time.Time
+	RotatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// activeSession finds the unexpired session of token. Sessions of suspended
+// users are treated as missing.
+func activeSession(token string) (sessionRecord, bool) {
+	var rec sessionRecord
+	if token == "" {
+		return rec, false
+	}
+
+	now := time.Now()
+	var createdAt, rotatedAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT session_id, user_id, token, created_at, rotated_at, expires_at
+		FROM sessions
+		WHERE (token = ? OR (previous_token = ? AND rotated_at > ?)) AND expires_at > ?`,
+		token, token, now.Add(-config.Current.SessionRotationGrace), now).Scan(&rec.SessionID, &rec.UserID, &rec.Token, &createdAt, &rotatedAt, &rec.ExpiresAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error looking up session", err)
+		}
+		return rec, false
+	}
+	if IsSuspended(rec.UserID) {
+		return rec, false
+	}
+
+	rec.CreatedAt = createdAt.Time
+	if !createdAt.Valid {
+		rec.CreatedAt = now
+	}
+	rec.RotatedAt = rotatedAt.Time
+	if !rotatedAt.Valid {
+		rec.RotatedAt = rec.CreatedAt
+	}
+	return rec, true
+}
+
+func (rec sessionRecord) absoluteExpiry() time.Time {
+	return rec.CreatedAt.Add(config.Current.SessionAbsoluteTimeout)
+}
+
+// touch records activity on the session and slides its idle deadline,
+// never past the absolute one.
+func (rec *sessionRecord) touch() {
+	now := time.Now()
+	expires := now.Add(config.Current.SessionIdleTimeout)
+	if absolute := rec.absoluteExpiry(); absolute.Before(expires) {
+		expires = absolute
+	}
+
+	_, err := db.DB.Exec("UPDATE sessions SET last_used_at=?, expires_at=? WHERE session_id=?", now, expires, rec.SessionID)
+	if err != nil {
+		logger.LogError("Error updating session expiry", err)
+		return
+	}
+	rec.ExpiresAt = expires
+}
+
+func (rec *sessionRecord) rotate() (string, error) {
+	newToken, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = db.DB.Exec("UPDATE sessions SET previous_token=token, token=?, rotated_at=? WHERE session_id=? AND token=?",
+		newToken.String(), now, rec.SessionID, rec.Token)
+	if err != nil {
+		return "", err
+	}
+	rec.Token = newToken.String()
+	rec.RotatedAt = now
+	return rec.Token, nil
+}
+
+func setTokenCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    token,
+		Expires:  expires,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   config.Current.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearTokenCookie removes the session cookie from the browser.
+func ClearTokenCookie(w http.ResponseWriter) {
+	setTokenCookie(w, "", time.Now().Add(-time.Hour))
+}
+
+// RenewSession validates the request's token cookie, extends the session and
+// hands out a fresh token once the current one is older than SessionRotateAfter.
+func RenewSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		return "", false
+	}
+
+	rec, ok := activeSession(cookie.Value)
+	if !ok {
+		return "", false
+	}
+	rec.touch()
+
+	if rec.Token == cookie.Value && time.Since(rec.RotatedAt) > config.Current.SessionRotateAfter {
+		token, err := rec.rotate()
+		if err != nil {
+			logger.LogError("Error rotating session token", err)
+			return rec.UserID, true
+		}
+		setTokenCookie(w, token, rec.absoluteExpiry())
+	}
+
+	return rec.UserID, true
+}
+
+func PurgeExpired() (int64, error) {
+	res, err := db.DB.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartSweeper removes expired sessions now and then every interval.
+func StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := PurgeExpired()
+			if err != nil {
+				logger.LogError("Error purging expired sessions", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired session(s)", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
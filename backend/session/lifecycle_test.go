@@ -0,0 +1,158 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+// useSessionTimeouts sets the session timeouts for the test so it does not
+// depend on the defaults.
+func useSessionTimeouts(t *testing.T) {
+	previous := config.Current
+	cfg := *previous
+	cfg.SessionIdleTimeout = 2 * time.Hour
+	cfg.SessionAbsoluteTimeout = 24 * time.Hour
+	cfg.SessionRotateAfter = 15 * time.Minute
+	cfg.SessionRotationGrace = time.Minute
+	config.Current = &cfg
+	t.Cleanup(func() { config.Current = previous })
+}
+
+// insertSession adds a session of userID whose token was last replaced at
+// rotated, taking over from previous.
+func insertSession(t *testing.T, id string, userID string, token string, previous string, created time.Time, rotated time.Time, expires time.Time) {
+	t.Helper()
+	_, err := db.DB.Exec(`INSERT INTO sessions (session_id, user_id, token, previous_token, expires_at, created_at, last_used_at, rotated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, id, userID, token, previous, expires, created, created, rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActiveSession(t *testing.T) {
+	dbtest.Open(t)
+	useSessionTimeouts(t)
+	user := dbtest.User(t, "u-session", "session", "session@test.local", true)
+	now := time.Now()
+
+	insertSession(t, "s-fresh", user, "t-fresh", "", now.Add(-time.Minute), now.Add(-time.Minute), now.Add(time.Hour))
+	insertSession(t, "s-idle", user, "t-idle", "", now.Add(-3*time.Hour), now.Add(-3*time.Hour), now.Add(-time.Hour))
+	insertSession(t, "s-rotated", user, "t-rotated", "t-in-grace", now.Add(-time.Hour), now.Add(-30*time.Second), now.Add(time.Hour))
+	insertSession(t, "s-rotated-earlier", user, "t-rotated-earlier", "t-past-grace", now.Add(-time.Hour), now.Add(-2*time.Minute), now.Add(time.Hour))
+
+	tests := []struct {
+		name        string
+		token       string
+		wantSession string
+	}{
+		{"fresh session", "t-fresh", "s-fresh"},
+		{"idle past its expiry", "t-idle", ""},
+		{"current token after a rotation", "t-rotated", "s-rotated"},
+		{"replaced token within the grace period", "t-in-grace", "s-rotated"},
+		{"replaced token after the grace period", "t-past-grace", ""},
+		{"unknown token", "t-unknown", ""},
+		{"no token", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, ok := activeSession(tt.token)
+			if ok != (tt.wantSession != "") || (ok && rec.SessionID != tt.wantSession) {
+				t.Errorf("activeSession(%q) = %q, %v, want %q", tt.token, rec.SessionID, ok, tt.wantSession)
+			}
+		})
+	}
+}
+
+func TestRenewSession(t *testing.T) {
+	dbtest.Open(t)
+	useSessionTimeouts(t)
+	user := dbtest.User(t, "u-session", "session", "session@test.local", true)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		created time.Duration
+		rotated time.Duration
+		// cookie is the token sent, the current one unless set.
+		cookie       string
+		wantRotation bool
+		// wantExpires is when the session should end, from now.
+		wantExpires time.Duration
+	}{
+		{"recent token slides the idle deadline", -time.Hour, -time.Minute, "", false, 2 * time.Hour},
+		{"old token is replaced", -time.Hour, -20 * time.Minute, "", true, 2 * time.Hour},
+		{"replaced token within the grace period is not rotated again", -time.Hour, -30 * time.Second, "t-previous", false, 2 * time.Hour},
+		{"idle deadline stops at the absolute one", -23 * time.Hour, -time.Minute, "", false, time.Hour},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "s-renew-" + string(rune('a'+i))
+			token := "t-renew-" + string(rune('a'+i))
+			insertSession(t, id, user, token, "t-previous", now.Add(tt.created), now.Add(tt.rotated), now.Add(time.Minute))
+			cookie := tt.cookie
+			if cookie == "" {
+				cookie = token
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: "token", Value: cookie})
+			w := httptest.NewRecorder()
+			if userID, ok := RenewSession(w, r); !ok || userID != user {
+				t.Fatalf("RenewSession = %q, %v", userID, ok)
+			}
+
+			var current, previous string
+			var expires time.Time
+			if err := db.DB.QueryRow("SELECT token, previous_token, expires_at FROM sessions WHERE session_id = ?", id).Scan(&current, &previous, &expires); err != nil {
+				t.Fatal(err)
+			}
+			if want := now.Add(tt.wantExpires); expires.Before(want.Add(-time.Minute)) || expires.After(want.Add(time.Minute)) {
+				t.Errorf("expires_at = %v, want about %v", expires, want)
+			}
+
+			cookies := w.Result().Cookies()
+			if !tt.wantRotation {
+				if current != token || len(cookies) != 0 {
+					t.Errorf("token = %q, cookies = %v, want %q kept", current, cookies, token)
+				}
+				return
+			}
+			if current == token || previous != token || len(cookies) != 1 || cookies[0].Value != current {
+				t.Fatalf("token = %q, previous = %q, cookies = %v", current, previous, cookies)
+			}
+			if want := now.Add(tt.created).Add(config.Current.SessionAbsoluteTimeout); cookies[0].Expires.Sub(want).Abs() > time.Second {
+				t.Errorf("cookie expires %v, want %v", cookies[0].Expires, want)
+			}
+			if _, ok := activeSession(token); !ok {
+				t.Error("replaced token stopped working within the grace period")
+			}
+		})
+	}
+}
+
+func TestSessionSweeper(t *testing.T) {
+	dbtest.Open(t)
+	user := dbtest.User(t, "u-session", "session", "session@test.local", true)
+	now := time.Now()
+	insertSession(t, "s-expired", user, "t-expired", "", now.Add(-3*time.Hour), now.Add(-3*time.Hour), now.Add(-time.Minute))
+	insertSession(t, "s-live", user, "t-live", "", now.Add(-time.Hour), now.Add(-time.Hour), now.Add(time.Hour))
+
+	// The sweeper purges once right away, then waits for the interval.
+	StartSweeper(time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for dbtest.Exists(t, "SELECT 1 FROM sessions WHERE session_id = 's-expired'") {
+		if time.Now().After(deadline) {
+			t.Fatal("the sweeper did not remove the expired session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !dbtest.Exists(t, "SELECT 1 FROM sessions WHERE session_id = 's-live'") {
+		t.Error("the sweeper removed a live session")
+	}
+}
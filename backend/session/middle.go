@@ -5,14 +5,14 @@ import (
 	"fmt"
 	"net/http"
 
-	"social-net/db"
+	"social-net/config"
 )
 
 func Middleware(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token")
 	re, err := r.Cookie("token")
 	fmt.Println("Cookie:", re)
 	if err != nil {
@@ -23,18 +23,7 @@ func Middleware(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	var sessionCount int
-	err = db.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE token=?", re.Value).Scan(&sessionCount)
-	if err != nil {
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "Database query failed",
-		})
-		http.Error(w, "Database query failed", http.StatusInternalServerError)
-		return
-	}
-
-	if sessionCount > 0 {
-
+	if _, ok := RenewSession(w, r); ok {
 		json.NewEncoder(w).Encode(map[string]string{
 			"message": "Login successful",
 		})
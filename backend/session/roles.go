@@ -0,0 +1,93 @@
+package session
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"social-net/db"
+	logger "social-net/log"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Suspension describes why and until when an account is blocked. A nil
+// Until means the account is banned until an admin lifts it.
+type Suspension struct {
+	Since  time.Time  `json:"suspended_at"`
+	Until  *time.Time `json:"suspended_until"`
+	Reason string     `json:"reason"`
+}
+
+var (
+	suspendHooks   []func(userID string, username string)
+	suspendHooksMu sync.Mutex
+)
+
+// UserRole returns the role of the user, RoleUser when it cannot be loaded.
+func UserRole(userID string) string {
+	var role string
+	err := db.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error loading user role", err)
+		}
+		return RoleUser
+	}
+	return role
+}
+
+func IsAdmin(userID string) bool {
+	return UserRole(userID) == RoleAdmin
+}
+
+// UserSuspension reports whether the user is currently suspended or banned.
+// Suspensions past their end date no longer count.
+func UserSuspension(userID string) (Suspension, bool) {
+	var s Suspension
+	var since, until sql.NullTime
+	err := db.DB.QueryRow("SELECT suspended_at, suspended_until, suspension_reason FROM users WHERE id = ?", userID).
+		Scan(&since, &until, &s.Reason)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error checking suspension", err)
+		}
+		return s, false
+	}
+	if !since.Valid {
+		return s, false
+	}
+	if until.Valid {
+		if !until.Time.After(time.Now()) {
+			return s, false
+		}
+		s.Until = &until.Time
+	}
+	s.Since = since.Time
+	return s, true
+}
+
+func IsSuspended(userID string) bool {
+	_, suspended := UserSuspension(userID)
+	return suspended
+}
+
+// OnUserSuspended registers fn to run when a user is suspended, so packages
+// holding live connections can drop the ones of that user.
+func OnUserSuspended(fn func(userID string, username string)) {
+	suspendHooksMu.Lock()
+	defer suspendHooksMu.Unlock()
+	suspendHooks = append(suspendHooks, fn)
+}
+
+func UserSuspended(userID string, username string) {
+	suspendHooksMu.Lock()
+	hooks := append([]func(string, string){}, suspendHooks...)
+	suspendHooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(userID, username)
+	}
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-net/db"
+	"social-net/db/dbtest"
+)
+
+func TestSuspendedUsersAreRejected(t *testing.T) {
+	dbtest.Open(t)
+
+	tests := []struct {
+		name string
+		// since and until set the suspension; a zero since means none.
+		since    time.Duration
+		until    *time.Duration
+		wantAuth bool
+	}{
+		{"not suspended", 0, nil, true},
+		{"suspended", -time.Hour, durationPtr(time.Hour), false},
+		{"banned", -time.Hour, nil, false},
+		{"suspension over", -2 * time.Hour, durationPtr(-time.Hour), true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := dbtest.User(t, "u-suspension-"+string(rune('a'+i)), "suspension"+string(rune('a'+i)), string(rune('a'+i))+"@test.local", true)
+			cookie := Setsession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), userID)
+			pat, _, err := CreateAccessToken(userID, "cli", []string{ScopeRead}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.since != 0 {
+				var until interface{}
+				if tt.until != nil {
+					until = time.Now().Add(*tt.until)
+				}
+				if _, err := db.DB.Exec("UPDATE users SET suspended_at = ?, suspended_until = ? WHERE id = ?", time.Now().Add(tt.since), until, userID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			withCookie := httptest.NewRequest(http.MethodGet, "/", nil)
+			withCookie.AddCookie(&http.Cookie{Name: "token", Value: cookie})
+			withToken := httptest.NewRequest(http.MethodGet, "/", nil)
+			withToken.Header.Set("Authorization", "Bearer "+pat)
+			for name, r := range map[string]*http.Request{"session cookie": withCookie, "access token": withToken} {
+				if _, err := Authenticate(r); (err == nil) != tt.wantAuth {
+					t.Errorf("%s: authenticated = %v, want %v (%v)", name, err == nil, tt.wantAuth, err)
+				}
+			}
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"social-net/config"
 	"social-net/db"
 	logger "social-net/log"
 
@@ -13,46 +14,34 @@ import (
 )
 
 func Setsession(w http.ResponseWriter, r *http.Request, userID string) string {
-	Deletesession(userID)
-
 	token, _ := uuid.NewV7()
 	sessionID, _ := uuid.NewV7()
 
-	_, err := db.DB.Exec("INSERT INTO sessions (session_id,user_id, token, expires_at) VALUES (?,?, ?, ?)",
-		sessionID, userID, token.String(), time.Now().Add(time.Hour*24))
+	now := time.Now()
+	userAgent := r.UserAgent()
+	_, err := db.DB.Exec(`INSERT INTO sessions (session_id, user_id, token, expires_at, device, user_agent, ip, created_at, last_used_at, rotated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionID, userID, token.String(), now.Add(config.Current.SessionIdleTimeout), DeviceName(r), userAgent, ClientIP(r), now, now, now)
 	if err != nil {
 		fmt.Println("Error inserting session:", err)
 		return ""
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   token.String(),
-		Expires: time.Now().Add(time.Hour * 2),
-		Path:    "/",
-	})
+	setTokenCookie(w, token.String(), now.Add(config.Current.SessionAbsoluteTimeout))
 
 	return token.String()
 }
 
 func Validatesession(id string, token string) bool {
-	var count int
-	var expiresAt time.Time
-
-	err := db.DB.QueryRow("SELECT COUNT(*), expires_at FROM sessions WHERE user_id=? AND token=? LIMIT 1",
-		id, token).Scan(&count, &expiresAt)
-	if err != nil {
-		logger.LogError("Error validating session", err)
-		return false
+	if isAccessToken(token) {
+		userID, ok := accessTokenUser(token)
+		return ok && userID == id
 	}
-
-	if count == 0 || expiresAt.Before(time.Now()) {
-		if count > 0 {
-			Deletesession(id)
-		}
+	rec, ok := activeSession(token)
+	if !ok || rec.UserID != id {
 		return false
 	}
-
+	rec.touch()
 	return true
 }
 
@@ -64,6 +53,14 @@ func Deletesession(id string) error {
 	return nil
 }
 
+func DeleteSessionByToken(token string) error {
+	_, err := db.DB.Exec("DELETE FROM sessions WHERE token=? OR previous_token=?", token, token)
+	if err != nil {
+		logger.LogError("Error deleting session", err)
+	}
+	return err
+}
+
 func Hassession(id string) int {
 	var sessionCount int
 	err := db.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id=? AND expires_at > ?",
@@ -81,19 +78,17 @@ func GetUserIDFromToken(token string) (string, bool) {
 		fmt.Println("Error: Empty token provided")
 		return "", false
 	}
-	var userID string
-	err := db.DB.QueryRow("SELECT user_id FROM sessions WHERE token=? AND expires_at > ?",
-		token, time.Now()).Scan(&userID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Println("Error: No valid session found for token")
-		} else {
-			fmt.Println("Database error getting user from token:", err)
-		}
+	if isAccessToken(token) {
+		return accessTokenUser(token)
+	}
+	rec, ok := activeSession(token)
+	if !ok {
+		fmt.Println("Error: No valid session found for token")
 		return "", false
 	}
+	rec.touch()
 
-	return userID, true
+	return rec.UserID, true
 }
 
 func GetUsernameFromUserID(id string) (string, bool) {
@@ -114,6 +109,9 @@ func GetUserIDFromUsername(username string) (string, error) {
 	err := db.DB.QueryRow("SELECT id FROM users WHERE username=? OR email=?",
 		username,
 		username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		userID, err = ResolveUsername(username)
+	}
 	fmt.Println("User ID from username:", userID)
 	if err != nil {
 		fmt.Println("Error getting user from username:", err)
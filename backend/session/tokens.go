@@ -0,0 +1,375 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+
+	"github.com/gofrs/uuid"
+)
+
+// Personal access tokens let scripts and mobile clients call the API with an
+// "Authorization: Bearer" header instead of the session cookie. Only a hash
+// of each token is stored; the token itself is shown once, on creation.
+const (
+	TokenPrefix = "snpat_"
+
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+var (
+	ErrInsufficientScope = errors.New("token does not have the required scope")
+	errInvalidToken      = errors.New("invalid access token")
+)
+
+type AccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAccessToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// requiredScope is write for anything that can change data, websocket
+// connections included, and read otherwise.
+func requiredScope(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return ScopeWrite
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// AuthCookie returns the "token" cookie of the request, or a stand-in built
+// from an "Authorization: Bearer" header so handlers treat both the same.
+// Access tokens are checked against the scope the request method needs.
+func AuthCookie(r *http.Request) (*http.Cookie, error) {
+	cookie := &http.Cookie{Name: "token", Value: bearerToken(r)}
+	if cookie.Value == "" {
+		var err error
+		if cookie, err = r.Cookie("token"); err != nil {
+			return nil, err
+		}
+	}
+	if !isAccessToken(cookie.Value) {
+		return cookie, nil
+	}
+
+	scopes, ok := accessTokenScopes(cookie.Value)
+	if !ok {
+		return nil, errInvalidToken
+	}
+	if !hasScope(scopes, requiredScope(r)) {
+		return nil, ErrInsufficientScope
+	}
+	return cookie, nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func accessTokenScopes(token string) ([]string, bool) {
+	var scopes string
+	err := db.DB.QueryRow(`SELECT scopes FROM personal_access_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`,
+		hashAccessToken(token), time.Now()).Scan(&scopes)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error checking access token", err)
+		}
+		return nil, false
+	}
+	return strings.Split(scopes, ","), true
+}
+
+// accessTokenUser resolves an access token to its owner and records the use.
+func accessTokenUser(token string) (string, bool) {
+	var tokenID, userID string
+	now := time.Now()
+	err := db.DB.QueryRow(`SELECT id, user_id FROM personal_access_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`,
+		hashAccessToken(token), now).Scan(&tokenID, &userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogError("Error checking access token", err)
+		}
+		return "", false
+	}
+	if IsSuspended(userID) {
+		return "", false
+	}
+	if _, err := db.DB.Exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?", now, tokenID); err != nil {
+		logger.LogError("Error updating access token", err)
+	}
+	return userID, true
+}
+
+// CreateAccessToken stores a new token for the user and returns it in clear;
+// it cannot be recovered afterwards.
+func CreateAccessToken(userID string, name string, scopes []string, expiresAt *time.Time) (string, AccessToken, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", AccessToken{}, err
+	}
+	token := TokenPrefix + hex.EncodeToString(buf)
+
+	tokenID, err := uuid.NewV7()
+	if err != nil {
+		return "", AccessToken{}, err
+	}
+	t := AccessToken{
+		ID:        tokenID.String(),
+		Name:      name,
+		Prefix:    token[:len(TokenPrefix)+8],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	var expires interface{}
+	if expiresAt != nil {
+		expires = *expiresAt
+	}
+	_, err = db.DB.Exec(`INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, userID, name, hashAccessToken(token), t.Prefix, strings.Join(scopes, ","), t.CreatedAt, expires)
+	if err != nil {
+		return "", AccessToken{}, err
+	}
+	return token, t, nil
+}
+
+func GetAccessTokens(userID string) ([]AccessToken, error) {
+	rows, err := db.DB.Query(`SELECT id, name, token_prefix, scopes, created_at, last_used_at, expires_at
+		FROM personal_access_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []AccessToken{}
+	for rows.Next() {
+		var t AccessToken
+		var scopes string
+		var lastUsed, expires sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &t.CreatedAt, &lastUsed, &expires); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		if expires.Valid {
+			t.ExpiresAt = &expires.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func RevokeAccessToken(userID string, tokenID string) (bool, error) {
+	res, err := db.DB.Exec("UPDATE personal_access_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeAccessTokens revokes every token of the user. Password changes,
+// resets and suspensions call it so a token minted before a compromise
+// does not outlive it.
+func RevokeAccessTokens(userID string) error {
+	_, err := db.DB.Exec("UPDATE personal_access_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), userID)
+	if err != nil {
+		logger.LogError("Error revoking access tokens", err)
+	}
+	return err
+}
+
+// cookieUser returns the caller of a token management request. Only a
+// browser session may manage tokens, so a leaked token cannot be used to mint
+// new ones.
+func cookieUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, _ := CurrentUser(r)
+	if user.SessionID == "" {
+		http.Error(w, "Access tokens cannot manage tokens", http.StatusForbidden)
+		return "", false
+	}
+	return user.ID, true
+}
+
+// AccessTokens lists the caller's tokens on GET and creates one on POST from
+// {name, scopes, expires_in_days}.
+func AccessTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cookieUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		tokens, err := GetAccessTokens(userID)
+		if err != nil {
+			logger.LogError("Error listing access tokens", err)
+			http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+		return
+	}
+
+	var request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 64 {
+		http.Error(w, "Token name must be 1 to 64 characters", http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > 365 {
+		http.Error(w, "expires_in_days must be between 0 and 365", http.StatusBadRequest)
+		return
+	}
+
+	// Write access implies read access.
+	var scopes []string
+	for _, s := range request.Scopes {
+		switch s {
+		case ScopeRead, ScopeWrite:
+		default:
+			http.Error(w, "Unknown scope: "+s, http.StatusBadRequest)
+			return
+		}
+	}
+	if hasScope(request.Scopes, ScopeWrite) {
+		scopes = []string{ScopeRead, ScopeWrite}
+	} else {
+		scopes = []string{ScopeRead}
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, t, err := CreateAccessToken(userID, request.Name, scopes, expiresAt)
+	if err != nil {
+		logger.LogError("Error creating access token", err)
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	securityEvent(r, "access_token_created", "access_token", t.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		AccessToken
+		Token string `json:"token"`
+	}{t, token})
+}
+
+func RevokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cookieUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ID == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := RevokeAccessToken(userID, request.ID)
+	if err != nil {
+		logger.LogError("Error revoking access token", err)
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	securityEvent(r, "access_token_revoked", "access_token", request.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked"})
+}
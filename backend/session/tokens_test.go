@@ -0,0 +1,80 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-net/db/dbtest"
+)
+
+func TestAccessTokenScopes(t *testing.T) {
+	dbtest.Open(t)
+	userID := dbtest.User(t, "u-pat", "patuser", "pat@test.local", true)
+
+	readToken, _, err := CreateAccessToken(userID, "read", []string{ScopeRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToken, _, err := CreateAccessToken(userID, "write", []string{ScopeRead, ScopeWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	expiredToken, _, err := CreateAccessToken(userID, "expired", []string{ScopeRead, ScopeWrite}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedToken, revoked, err := CreateAccessToken(userID, "revoked", []string{ScopeRead, ScopeWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := RevokeAccessToken(userID, revoked.ID); !ok || err != nil {
+		t.Fatalf("RevokeAccessToken = %v, %v", ok, err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		method    string
+		websocket bool
+		wantErr   error
+	}{
+		{"read token on GET", readToken, http.MethodGet, false, nil},
+		{"read token on POST", readToken, http.MethodPost, false, ErrInsufficientScope},
+		{"read token on DELETE", readToken, http.MethodDelete, false, ErrInsufficientScope},
+		{"read token opening a websocket", readToken, http.MethodGet, true, ErrInsufficientScope},
+		{"write token on GET", writeToken, http.MethodGet, false, nil},
+		{"write token on POST", writeToken, http.MethodPost, false, nil},
+		{"write token opening a websocket", writeToken, http.MethodGet, true, nil},
+		{"expired token", expiredToken, http.MethodGet, false, errInvalidToken},
+		{"revoked token", revokedToken, http.MethodGet, false, errInvalidToken},
+		{"unknown token", TokenPrefix + "0000", http.MethodGet, false, errInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.websocket {
+				r.Header.Set("Upgrade", "websocket")
+			}
+			_, err := AuthCookie(r)
+			if err != tt.wantErr {
+				t.Errorf("AuthCookie error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, ok := accessTokenUser(writeToken); !ok {
+		t.Fatal("a valid token did not resolve to its user")
+	}
+	if err := RevokeAccessTokens(userID); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{readToken, writeToken} {
+		if _, ok := accessTokenUser(token); ok {
+			t.Error("a token survived RevokeAccessTokens")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"social-net/db"
+)
+
+var (
+	renameHooks   []func(oldName string, newName string)
+	renameHooksMu sync.Mutex
+)
+
+// ResolveUsername returns the id of the user currently known by name, or who
+// was until a recent rename.
+func ResolveUsername(name string) (string, error) {
+	var userID string
+	err := db.DB.QueryRow("SELECT id FROM users WHERE username = ?", name).Scan(&userID)
+	if err != sql.ErrNoRows {
+		return userID, err
+	}
+	err = db.DB.QueryRow("SELECT user_id FROM username_history WHERE old_username = ? AND expires_at > ?", name, time.Now()).Scan(&userID)
+	return userID, err
+}
+
+// CurrentUsername maps a possibly outdated username to the one in use now.
+// Unknown names are returned unchanged.
+func CurrentUsername(name string) string {
+	userID, err := ResolveUsername(name)
+	if err != nil {
+		return name
+	}
+	if current, ok := GetUsernameFromUserID(userID); ok {
+		return current
+	}
+	return name
+}
+
+// OnUsernameChange registers fn to run after a user is renamed, so packages
+// that key live state on usernames can move it to the new name.
+func OnUsernameChange(fn func(oldName string, newName string)) {
+	renameHooksMu.Lock()
+	defer renameHooksMu.Unlock()
+	renameHooks = append(renameHooks, fn)
+}
+
+func UsernameChanged(oldName string, newName string) {
+	renameHooksMu.Lock()
+	hooks := append([]func(string, string){}, renameHooks...)
+	renameHooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(oldName, newName)
+	}
+}
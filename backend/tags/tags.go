@@ -0,0 +1,256 @@
+package tags
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"social-net/config"
+	"social-net/db"
+	logger "social-net/log"
+	"social-net/notification"
+	"social-net/session"
+)
+
+// A tag or mention starts a word: "#go" and "@bob22" count, the fragment of
+// "page#top" and the domain of "me@mail.io" do not.
+var (
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]{1,50})`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([A-Za-z0-9_]{3,30})`)
+)
+
+// Parse returns the distinct hashtags and mentioned usernames of text, both
+// lowercased, in order of appearance.
+func Parse(text string) ([]string, []string) {
+	return matches(hashtagPattern, text), matches(mentionPattern, text)
+}
+
+func matches(pattern *regexp.Regexp, text string) []string {
+	seen := map[string]bool{}
+	var found []string
+	for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(m[1])
+		if !seen[name] {
+			seen[name] = true
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// Target describes content that can carry tags and mentions. The packages
+// owning the content register it, since this one cannot import them.
+type Target struct {
+	// Noun names the target in notifications, e.g. "post".
+	Noun string
+	// CanSee reports whether userID may view the target.
+	CanSee func(userID string, id string) bool
+	// Preview loads what mention listings show of the target.
+	Preview func(id string) (Preview, error)
+}
+
+// Preview is the text of a target and the id of what it belongs to: the
+// post of a comment, the group of a group post.
+type Preview struct {
+	ParentID string `json:"parent_id,omitempty"`
+	Text     string `json:"text"`
+}
+
+var (
+	targetsMu sync.RWMutex
+	targets   = map[string]Target{}
+)
+
+func RegisterTarget(targetType string, t Target) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	targets[targetType] = t
+}
+
+func lookupTarget(targetType string) (Target, bool) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	t, ok := targets[targetType]
+	return t, ok
+}
+
+// Index records the hashtags and mentions of a target written by authorID,
+// replacing those of a previous version. Users mentioned for the first time
+// are notified if they can see the target. Failures are logged but never
+// block the write they follow.
+func Index(targetType string, targetID string, authorID string, text string) {
+	hashtags, names := Parse(text)
+	var mentioned []string
+	for _, name := range names {
+		if id, err := session.GetUserIDFromUsername(name); err == nil && id != "" && id != authorID {
+			mentioned = append(mentioned, id)
+		}
+	}
+
+	added, err := saveIndex(targetType, targetID, authorID, hashtags, mentioned)
+	if err != nil {
+		logger.LogError("Error indexing tags and mentions", err)
+		return
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	target, ok := lookupTarget(targetType)
+	author, found := session.GetUsernameFromUserID(authorID)
+	if !ok || !found {
+		return
+	}
+	for _, userID := range added {
+		if !target.CanSee(userID, targetID) {
+			continue
+		}
+		if name, ok := session.GetUsernameFromUserID(userID); ok {
+			notification.CreateNotificationMessage(name, author, notification.TypeMention, "mentioned you in a "+target.Noun)
+		}
+	}
+}
+
+// saveIndex brings the index rows of a target in line with hashtags and
+// mentioned, keeping the rows that did not change. It returns the users
+// that were not mentioned before.
+func saveIndex(targetType string, targetID string, authorID string, hashtags []string, mentioned []string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec("DELETE FROM hashtags WHERE target_type = ? AND target_id = ?"+notIn("tag", len(hashtags)),
+		append([]interface{}{targetType, targetID}, strArgs(hashtags)...)...); err != nil {
+		return nil, err
+	}
+	for _, tag := range hashtags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO hashtags (target_type, target_id, tag, created_at) VALUES (?, ?, ?, ?)",
+			targetType, targetID, tag, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM mentions WHERE target_type = ? AND target_id = ?"+notIn("user_id", len(mentioned)),
+		append([]interface{}{targetType, targetID}, strArgs(mentioned)...)...); err != nil {
+		return nil, err
+	}
+	var added []string
+	for _, userID := range mentioned {
+		res, err := tx.Exec("INSERT OR IGNORE INTO mentions (target_type, target_id, user_id, author_id, created_at) VALUES (?, ?, ?, ?, ?)",
+			targetType, targetID, userID, authorID, now)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added = append(added, userID)
+		}
+	}
+	return added, tx.Commit()
+}
+
+func notIn(column string, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return " AND " + column + " NOT IN (?" + strings.Repeat(", ?", n-1) + ")"
+}
+
+func strArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// Mention is one entry of MyMentions.
+type Mention struct {
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	Author     string    `json:"author"`
+	Preview    Preview   `json:"preview"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MyMentions pages through the places the caller was mentioned, newest
+// first. Content the caller can no longer see is skipped, so a page may
+// scan past ?limit= rows; next_offset continues after the last one scanned.
+func MyMentions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	userID := session.CurrentUserID(r)
+	rows, err := db.DB.Query(`SELECT m.target_type, m.target_id, COALESCE(u.username, ''), m.created_at
+		FROM mentions m LEFT JOIN users u ON u.id = m.author_id
+		WHERE m.user_id = ? ORDER BY m.created_at DESC, m.target_id DESC LIMIT -1 OFFSET ?`, userID, offset)
+	if err != nil {
+		logger.LogError("Error listing mentions", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	mentions := []Mention{}
+	scanned, hasMore := 0, false
+	for rows.Next() {
+		if len(mentions) == limit {
+			hasMore = true
+			break
+		}
+		var m Mention
+		if err := rows.Scan(&m.TargetType, &m.TargetID, &m.Author, &m.CreatedAt); err != nil {
+			logger.LogError("Error scanning mention", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		scanned++
+		target, ok := lookupTarget(m.TargetType)
+		if !ok || !target.CanSee(userID, m.TargetID) {
+			continue
+		}
+		if m.Preview, err = target.Preview(m.TargetID); err != nil {
+			if err != sql.ErrNoRows {
+				logger.LogError("Error loading mention preview", err)
+			}
+			continue
+		}
+		mentions = append(mentions, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mentions":    mentions,
+		"offset":      offset,
+		"next_offset": offset + scanned,
+		"has_more":    hasMore,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"social-net/config"
 	"social-net/db"
 	"social-net/session"
 )
@@ -18,27 +19,17 @@ type Userss struct {
 }
 
 func Users(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-		return
-	}
-	tokenn := token.Value
-	user, ok := session.GetUserIDFromToken(tokenn)
-	if !ok || user == "" {
-		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return
-	}
+	user := session.CurrentUserID(r)
 	username, ok := session.GetUsernameFromUserID(user)
 	if !ok {
 		http.Error(w, "Failed to get username", http.StatusInternalServerError)
@@ -3,6 +3,8 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
+
+	"social-net/config"
 )
 
 type Response struct {
@@ -12,10 +14,10 @@ type Response struct {
 }
 
 func SendJSONResponse(w http.ResponseWriter, r *http.Request, data interface{}, statusCode int) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == "OPTIONS" {
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"path/filepath"
+
+	"social-net/config"
+	"social-net/db"
+)
+
+// UploadNames returns the non-empty file names selected by query, typically
+// the image column of rows about to be deleted.
+func UploadNames(query string, args ...interface{}) ([]string, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name sql.NullString
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if name.String != "" {
+			names = append(names, name.String)
+		}
+	}
+	return names, rows.Err()
+}
+
+// uploadReferences finds a row still using an uploaded file. The copies of a
+// semi-private post, for one, all share the same image.
+const uploadReferences = `SELECT EXISTS(SELECT 1 FROM posts WHERE image = ?1)
+	OR EXISTS(SELECT 1 FROM post_revisions WHERE image = ?1)
+	OR EXISTS(SELECT 1 FROM comments WHERE image = ?1)
+	OR EXISTS(SELECT 1 FROM group_posts WHERE image = ?1)
+	OR EXISTS(SELECT 1 FROM group_comments WHERE image = ?1)
+	OR EXISTS(SELECT 1 FROM users WHERE avatar = ?1)`
+
+// RemoveUploads deletes the given files from the uploads directory once no
+// row refers to them any more, so call it after the rows are gone. Missing
+// files are ignored.
+func RemoveUploads(names []string) {
+	for _, name := range names {
+		var used bool
+		if err := db.DB.QueryRow(uploadReferences, name).Scan(&used); err != nil {
+			log.Println("Failed to check upload references:", err)
+			continue
+		}
+		if used {
+			continue
+		}
+		if err := os.Remove(filepath.Join(config.Current.UploadsDir, filepath.Base(name))); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to remove upload:", err)
+		}
+	}
+}
+
+// ExecAll runs every query with the same arguments inside one transaction.
+func ExecAll(queries []string, args ...interface{}) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TargetCleanup returns the statements deleting the rows that reference
+// content of targetType by id: reactions, hashtags, mentions and bookmarks.
+// ids is "?" for a single target or a subquery selecting them.
+func TargetCleanup(targetType string, ids string) []string {
+	var queries []string
+	for _, table := range []string{"reactions", "hashtags", "mentions", "bookmarks"} {
+		queries = append(queries, "DELETE FROM "+table+" WHERE target_type = '"+targetType+"' AND target_id IN ("+ids+")")
+	}
+	return queries
+}
@@ -6,14 +6,15 @@ import (
 	"strconv"
 	"strings"
 
+	"social-net/config"
 	"social-net/db"
 )
 
 func SearchUsers(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
+	w.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin(r))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -24,15 +25,16 @@ func SearchUsers(w http.ResponseWriter, r *http.Request) {
 	groupID := r.URL.Query().Get("group_id")
 
 	query := `
-		SELECT DISTINCT u.id, u.username, u.email, u.avatar
+		SELECT DISTINCT u.id, u.username, u.avatar
 		FROM users u
 		WHERE 1=1
 	`
 	args := []interface{}{}
 	whereClause := ""
 
+	// Email addresses are private: they are neither matched nor returned.
 	if search != "" {
-		whereClause += " AND (LOWER(u.username) LIKE LOWER($1) OR LOWER(u.email) LIKE LOWER($1))"
+		whereClause += " AND (LOWER(u.username) LIKE LOWER($1) OR LOWER(u.first_name || ' ' || u.last_name) LIKE LOWER($1))"
 		args = append(args, "%"+search+"%")
 	}
 
@@ -57,14 +59,13 @@ func SearchUsers(w http.ResponseWriter, r *http.Request) {
 	type User struct {
 		ID       string `json:"id"`
 		Username string `json:"username"`
-		Email    string `json:"email"`
 		Avatar   string `json:"avatar"`
 	}
 
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Avatar)
+		err := rows.Scan(&user.ID, &user.Username, &user.Avatar)
 		if err != nil {
 			http.Error(w, "Failed to scan user", http.StatusInternalServerError)
 			return
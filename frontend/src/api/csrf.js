@@ -0,0 +1,60 @@
+// The backend rejects every POST, PUT, PATCH or DELETE that does not echo
+// its csrf_token cookie in the X-CSRF-Token header. installCsrf wraps
+// window.fetch so each such call to the API gets the header, fetching the
+// token from /api/csrf once and again if the backend refuses it.
+const API_ORIGIN = "http://localhost:8080";
+const SAFE_METHODS = ["GET", "HEAD", "OPTIONS"];
+
+let tokenPromise = null;
+
+function fetchToken(originalFetch) {
+  tokenPromise = originalFetch(`${API_ORIGIN}/api/csrf`, {
+    method: "GET",
+    credentials: "include",
+  })
+    .then((response) => {
+      if (!response.ok) {
+        throw new Error("Failed to fetch CSRF token");
+      }
+      return response.json();
+    })
+    .then((data) => data.csrf_token)
+    .catch((error) => {
+      tokenPromise = null;
+      throw error;
+    });
+  return tokenPromise;
+}
+
+function needsToken(input, init) {
+  const url = typeof input === "string" ? input : input.url;
+  const method = (init.method || (typeof input === "string" ? "GET" : input.method) || "GET").toUpperCase();
+  return url.startsWith(API_ORIGIN) && !SAFE_METHODS.includes(method);
+}
+
+export function installCsrf() {
+  const originalFetch = window.fetch.bind(window);
+
+  window.fetch = async (input, init = {}) => {
+    if (!needsToken(input, init)) {
+      return originalFetch(input, init);
+    }
+
+    const send = (token) => {
+      const headers = new Headers(init.headers || {});
+      headers.set("X-CSRF-Token", token);
+      return originalFetch(input, { ...init, headers, credentials: "include" });
+    };
+
+    const response = await send(await (tokenPromise || fetchToken(originalFetch)));
+    if (response.status !== 403) {
+      return response;
+    }
+    // The cookie may have expired or been cleared; retry once with a new one.
+    const body = await response.clone().json().catch(() => null);
+    if (!body || body.error !== "csrf") {
+      return response;
+    }
+    return send(await fetchToken(originalFetch));
+  };
+}
@@ -1,5 +1,8 @@
 import { createApp } from 'vue';
 import App from './App.vue';
 import router from './router';
+import { installCsrf } from './api/csrf';
+
+installCsrf();
 
 createApp(App).use(router).mount('#app');